@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseASPath parses an AS-path fragment written as ASNs separated by
+// spaces or commas, "701 3356 174", into the form of RisFilter.ASPath. Each
+// ASN is a plain integer or asdot, "65000.1" being 65000*65536+1.
+func ParseASPath(s string) ([]uint32, error) {
+	tokens := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("as path(%q) has no ASNs", s)
+	}
+	path := make([]uint32, 0, len(tokens))
+	for _, tok := range tokens {
+		asn, err := ParseASN(tok)
+		if err != nil {
+			return nil, fmt.Errorf("as path(%q): %v", s, err)
+		}
+		path = append(path, asn)
+	}
+	return path, nil
+}
+
+// ParseASN parses an ASN written plain, "131074", or in asdot or asdot+,
+// "2.2", the high and low 16 bits separated by a dot. Zero is reserved and
+// rejected.
+func ParseASN(s string) (uint32, error) {
+	var asn uint64
+	if high, low, ok := strings.Cut(s, "."); ok {
+		h, herr := strconv.ParseUint(high, 10, 16)
+		l, lerr := strconv.ParseUint(low, 10, 16)
+		if herr != nil || lerr != nil {
+			return 0, fmt.Errorf("asn(%v) is not asdot, two numbers 0-65535", s)
+		}
+		asn = h<<16 | l
+	} else {
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("asn(%v) is not a number 1-4294967295", s)
+		}
+		asn = n
+	}
+	if asn == 0 {
+		return 0, fmt.Errorf("asn(%v) is reserved", s)
+	}
+	return uint32(asn), nil
+}
+
+// FormatASN renders an ASN plain or, with asdot, in asdot: ASNs above 65535
+// as high.low, the rest plain.
+func FormatASN(asn uint32, asdot bool) string {
+	if asdot && asn > math.MaxUint16 {
+		return strconv.FormatUint(uint64(asn>>16), 10) + "." + strconv.FormatUint(uint64(asn&math.MaxUint16), 10)
+	}
+	return strconv.FormatUint(uint64(asn), 10)
+}
+
+// asnConfig is an ASN in a filter file, either a number or a string read by
+// ParseASN, so that asdot may be written "1.10".
+type asnConfig uint32
+
+func (a *asnConfig) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		asn, err := ParseASN(s)
+		if err != nil {
+			return err
+		}
+		*a = asnConfig(asn)
+		return nil
+	}
+	var asn uint32
+	if err := json.Unmarshal(b, &asn); err != nil {
+		return err
+	}
+	*a = asnConfig(asn)
+	return nil
+}
+
+// asnsConfig converts filter file ASNs to uint32.
+func asnsConfig(asns []asnConfig) []uint32 {
+	if asns == nil {
+		return nil
+	}
+	out := make([]uint32, len(asns))
+	for i, asn := range asns {
+		out[i] = uint32(asn)
+	}
+	return out
+}
+
+// asPathConfig is the as_path of a filter file, either a list of ASNs or a
+// string read by ParseASPath.
+type asPathConfig []uint32
+
+func (p *asPathConfig) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		path, err := ParseASPath(s)
+		if err != nil {
+			return err
+		}
+		*p = path
+		return nil
+	}
+	var path []asnConfig
+	if err := json.Unmarshal(b, &path); err != nil {
+		return err
+	}
+	*p = asnsConfig(path)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseASPath(t *testing.T) {
+	tests := []struct {
+		desc    string
+		path    string
+		want    []uint32
+		wantErr bool
+	}{{
+		desc: "Success plain",
+		path: "701 3356 174",
+		want: []uint32{701, 3356, 174},
+	}, {
+		desc: "Success commas and extra spaces",
+		path: " 701,3356,  174 ",
+		want: []uint32{701, 3356, 174},
+	}, {
+		desc: "Success asdot",
+		path: "701 1.10 3.0",
+		want: []uint32{701, 65546, 196608},
+	}, {
+		desc: "Success asdot above 2147483647",
+		path: "3356 65000.1",
+		want: []uint32{3356, 4259840001},
+	}, {
+		desc:    "Failure empty",
+		path:    " ",
+		wantErr: true,
+	}, {
+		desc:    "Failure not a number",
+		path:    "701 AS3356",
+		wantErr: true,
+	}, {
+		desc:    "Failure negative",
+		path:    "701 -1",
+		wantErr: true,
+	}, {
+		desc:    "Failure zero",
+		path:    "0 701",
+		wantErr: true,
+	}, {
+		desc:    "Failure asdot half too large",
+		path:    "1.65536",
+		wantErr: true,
+	}, {
+		desc:    "Failure asdot missing half",
+		path:    "65000.",
+		wantErr: true,
+	}, {
+		desc:    "Failure asdot with three parts",
+		path:    "1.2.3",
+		wantErr: true,
+	}, {
+		desc:    "Failure above 32 bits",
+		path:    "4294967296",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseASPath(test.path)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestParseASN(t *testing.T) {
+	tests := []struct {
+		desc    string
+		asn     string
+		want    uint32
+		wantErr bool
+	}{{
+		desc: "Success plain",
+		asn:  "131074",
+		want: 131074,
+	}, {
+		desc: "Success asdot",
+		asn:  "2.2",
+		want: 131074,
+	}, {
+		desc: "Success asdot+ below 65536",
+		asn:  "0.701",
+		want: 701,
+	}, {
+		desc: "Success largest ASN",
+		asn:  "65535.65535",
+		want: 4294967295,
+	}, {
+		desc:    "Failure zero",
+		asn:     "0.0",
+		wantErr: true,
+	}, {
+		desc:    "Failure prefixed",
+		asn:     "AS701",
+		wantErr: true,
+	}, {
+		desc:    "Failure asdot half too large",
+		asn:     "65536.0",
+		wantErr: true,
+	}, {
+		desc:    "Failure above 32 bits",
+		asn:     "4294967296",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseASN(test.asn)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil && got != test.want:
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestFormatASNRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc         string
+		asn          uint32
+		plain, asdot string
+	}{{
+		desc:  "Two byte ASN, plain in both",
+		asn:   701,
+		plain: "701",
+		asdot: "701",
+	}, {
+		desc:  "Largest two byte ASN",
+		asn:   65535,
+		plain: "65535",
+		asdot: "65535",
+	}, {
+		desc:  "Smallest four byte ASN",
+		asn:   65536,
+		plain: "65536",
+		asdot: "1.0",
+	}, {
+		desc:  "Four byte ASN",
+		asn:   131074,
+		plain: "131074",
+		asdot: "2.2",
+	}, {
+		desc:  "Four byte ASN above 2147483647",
+		asn:   4200000000,
+		plain: "4200000000",
+		asdot: "64086.59904",
+	}}
+
+	for _, test := range tests {
+		for asdot, want := range map[bool]string{false: test.plain, true: test.asdot} {
+			got := FormatASN(test.asn, asdot)
+			if got != want {
+				t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, want)
+			}
+			back, err := ParseASN(got)
+			if err != nil {
+				t.Errorf("[%v]: got error parsing %v: %v", test.desc, got, err)
+				continue
+			}
+			if back != test.asn {
+				t.Errorf("[%v]: round trip of %v got %v wanted %v", test.desc, got, back, test.asn)
+			}
+		}
+	}
+}
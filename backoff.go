@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff produces exponentially growing delays, with jitter, between retries
+// of a failing operation: Base, then twice that, and so on up to Max. Each
+// delay is reduced by a random part of up to Jitter of itself, so clients
+// failing together don't retry together. A Backoff is not safe for
+// concurrent use.
+type Backoff struct {
+	Base   time.Duration // The first delay.
+	Max    time.Duration // The longest delay, before jitter.
+	Jitter float64       // The fraction, 0 to 1, of each delay which may be taken off.
+	// Rand returns the jitter source, in [0, 1). Nil uses math/rand.
+	Rand func() float64
+
+	attempt int // Delays returned since the last Reset.
+}
+
+// NewBackoff creates a Backoff from base up to max, with jitter.
+func NewBackoff(base, max time.Duration, jitter float64) *Backoff {
+	return &Backoff{Base: base, Max: max, Jitter: jitter}
+}
+
+// Next returns the delay before the next retry.
+func (b *Backoff) Next() time.Duration {
+	d := b.Base
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.attempt++
+
+	if b.Jitter > 0 {
+		random := rand.Float64
+		if b.Rand != nil {
+			random = b.Rand
+		}
+		d -= time.Duration(float64(d) * b.Jitter * random())
+	}
+	return d
+}
+
+// Reset starts the delays from Base again, once the operation succeeds.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		desc  string
+		b     *Backoff
+		reset int // Reset after this many delays, 0 never resets.
+		n     int
+		want  []time.Duration
+	}{{
+		desc: "Doubles from the base",
+		b:    NewBackoff(time.Second, time.Minute, 0),
+		n:    5,
+		want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second},
+	}, {
+		desc: "Capped at the max",
+		b:    NewBackoff(time.Second, 5*time.Second, 0),
+		n:    5,
+		want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second},
+	}, {
+		desc:  "Reset starts from the base",
+		b:     NewBackoff(time.Second, time.Minute, 0),
+		reset: 3,
+		n:     5,
+		want:  []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, time.Second, 2 * time.Second},
+	}, {
+		desc: "Jitter takes off a fixed part",
+		b:    &Backoff{Base: time.Second, Max: 4 * time.Second, Jitter: 0.5, Rand: func() float64 { return 0.5 }},
+		n:    4,
+		want: []time.Duration{750 * time.Millisecond, 1500 * time.Millisecond, 3 * time.Second, 3 * time.Second},
+	}, {
+		desc: "Many attempts don't overflow",
+		b:    NewBackoff(time.Second, time.Hour, 0),
+		n:    100,
+	}}
+
+	for _, test := range tests {
+		var got []time.Duration
+		for i := 0; i < test.n; i++ {
+			if test.reset > 0 && i == test.reset {
+				test.b.Reset()
+			}
+			got = append(got, test.b.Next())
+		}
+		if test.want == nil {
+			if last := got[len(got)-1]; last != test.b.Max {
+				t.Errorf("[%v]: got last delay %v wanted %v", test.desc, last, test.b.Max)
+			}
+			continue
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		}
+	}
+}
+
+func TestBackoffJitterBounds(t *testing.T) {
+	b := NewBackoff(time.Second, time.Second, 0.2)
+	for i := 0; i < 1000; i++ {
+		if d := b.Next(); d > time.Second || d < 800*time.Millisecond {
+			t.Fatalf("got delay %v outside [800ms, 1s]", d)
+		}
+	}
+}
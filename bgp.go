@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// BGP message and path attribute type codes, RFC 4271 and RFC 4760.
+const (
+	bgpHeaderLen = 19 // 16 byte marker, 2 byte length, 1 byte type.
+	bgpUpdate    = 2
+
+	attrOrigin      = 1
+	attrASPath      = 2
+	attrNextHop     = 3
+	attrCommunities = 8
+	attrMPReach     = 14
+	attrMPUnreach   = 15
+
+	afiIPv4 = 1
+	afiIPv6 = 2
+
+	flagExtendedLength = 0x10
+)
+
+// bgpOrigins are the names of the values of the ORIGIN attribute.
+var bgpOrigins = []string{"igp", "egp", "incomplete"}
+
+// PathAttribute is a single undecoded path attribute from a BGP UPDATE.
+type PathAttribute struct {
+	Flags byte
+	Type  byte
+	Value []byte
+}
+
+// ParsedUpdate is a BGP UPDATE message decoded from RisMessageData.Raw.
+// Prefixes from the IPv4 fields and from the MP_REACH_NLRI/MP_UNREACH_NLRI
+// attributes are merged into Announced and Withdrawn.
+type ParsedUpdate struct {
+	Withdrawn   []string        // Withdrawn prefixes.
+	Attributes  []PathAttribute // Every path attribute, in the order received.
+	Origin      string          // The ORIGIN attribute: igp, egp or incomplete.
+	Path        []uint32        // The AS_PATH, with AS_SET members flattened in place.
+	NextHops    []string        // The NEXT_HOP, or the MP_REACH_NLRI next-hops.
+	Communities [][]uint32      // Standard communities, as ASN:value pairs.
+	Announced   []string        // Announced prefixes.
+}
+
+// ParseRaw decodes the BGP UPDATE carried in Raw, recovering any fields the
+// RIS Live JSON did not include. AS_PATH is decoded with 4 byte ASNs, as
+// RIS Live sessions use.
+func (r *RisMessageData) ParseRaw() (*ParsedUpdate, error) {
+	b, err := r.RawBytes()
+	if err != nil {
+		return nil, err
+	}
+	return parseUpdate(b)
+}
+
+// parseUpdate decodes a whole BGP message, which must be an UPDATE.
+func parseUpdate(b []byte) (*ParsedUpdate, error) {
+	if len(b) < bgpHeaderLen {
+		return nil, fmt.Errorf("message of %d bytes is shorter than a BGP header", len(b))
+	}
+	if l := int(binary.BigEndian.Uint16(b[16:18])); l != len(b) {
+		return nil, fmt.Errorf("header length %d does not match message length %d", l, len(b))
+	}
+	if b[18] != bgpUpdate {
+		return nil, fmt.Errorf("message type %d is not an UPDATE", b[18])
+	}
+	b = b[bgpHeaderLen:]
+
+	u := &ParsedUpdate{}
+	withdrawn, b, err := splitLen16(b, "withdrawn routes")
+	if err != nil {
+		return nil, err
+	}
+	if u.Withdrawn, err = parsePrefixes(withdrawn, afiIPv4); err != nil {
+		return nil, fmt.Errorf("failed to parse withdrawn routes: %v", err)
+	}
+	attrs, b, err := splitLen16(b, "path attributes")
+	if err != nil {
+		return nil, err
+	}
+	if err := u.parseAttributes(attrs); err != nil {
+		return nil, err
+	}
+	// What remains is the IPv4 NLRI.
+	nlri, err := parsePrefixes(b, afiIPv4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NLRI: %v", err)
+	}
+	u.Announced = append(u.Announced, nlri...)
+	return u, nil
+}
+
+// splitLen16 splits a field preceded by its 2 byte length from the rest of b.
+func splitLen16(b []byte, field string) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, fmt.Errorf("message truncated before %v length", field)
+	}
+	l := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < l {
+		return nil, nil, fmt.Errorf("%v length %d exceeds remaining %d bytes", field, l, len(b))
+	}
+	return b[:l], b[l:], nil
+}
+
+// parseAttributes decodes the path attributes, keeping each one and decoding
+// those with a ParsedUpdate field.
+func (u *ParsedUpdate) parseAttributes(b []byte) error {
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return errors.New("path attribute header truncated")
+		}
+		a := PathAttribute{Flags: b[0], Type: b[1]}
+		var l int
+		if a.Flags&flagExtendedLength != 0 {
+			if len(b) < 4 {
+				return errors.New("path attribute header truncated")
+			}
+			l, b = int(binary.BigEndian.Uint16(b[2:4])), b[4:]
+		} else {
+			l, b = int(b[2]), b[3:]
+		}
+		if len(b) < l {
+			return fmt.Errorf("path attribute(%d) length %d exceeds remaining %d bytes", a.Type, l, len(b))
+		}
+		a.Value, b = b[:l], b[l:]
+		u.Attributes = append(u.Attributes, a)
+		if err := u.decodeAttribute(a); err != nil {
+			return fmt.Errorf("failed to decode path attribute(%d): %v", a.Type, err)
+		}
+	}
+	return nil
+}
+
+// decodeAttribute fills in the ParsedUpdate field for a, if there is one.
+func (u *ParsedUpdate) decodeAttribute(a PathAttribute) error {
+	v := a.Value
+	switch a.Type {
+	case attrOrigin:
+		if len(v) != 1 || int(v[0]) >= len(bgpOrigins) {
+			return fmt.Errorf("invalid ORIGIN: %x", v)
+		}
+		u.Origin = bgpOrigins[v[0]]
+	case attrASPath:
+		for len(v) > 0 {
+			if len(v) < 2 {
+				return errors.New("AS_PATH segment header truncated")
+			}
+			n := int(v[1]) * 4
+			if len(v)-2 < n {
+				return errors.New("AS_PATH segment truncated")
+			}
+			for i := 2; i < n+2; i += 4 {
+				u.Path = append(u.Path, binary.BigEndian.Uint32(v[i:i+4]))
+			}
+			v = v[n+2:]
+		}
+	case attrNextHop:
+		if len(v) != net.IPv4len {
+			return fmt.Errorf("invalid NEXT_HOP length %d", len(v))
+		}
+		u.NextHops = append(u.NextHops, net.IP(v).String())
+	case attrCommunities:
+		if len(v)%4 != 0 {
+			return fmt.Errorf("invalid COMMUNITIES length %d", len(v))
+		}
+		for i := 0; i < len(v); i += 4 {
+			u.Communities = append(u.Communities, []uint32{
+				uint32(binary.BigEndian.Uint16(v[i : i+2])),
+				uint32(binary.BigEndian.Uint16(v[i+2 : i+4])),
+			})
+		}
+	case attrMPReach:
+		// AFI(2), SAFI(1), next-hop length(1), next-hop(s), reserved(1), NLRI.
+		if len(v) < 5 || len(v) < 5+int(v[3]) {
+			return errors.New("MP_REACH_NLRI truncated")
+		}
+		afi, nhLen := binary.BigEndian.Uint16(v[:2]), int(v[3])
+		nh := v[4 : 4+nhLen]
+		size := net.IPv4len
+		if afi == afiIPv6 {
+			size = net.IPv6len
+		}
+		// An IPv6 next-hop may be a global address followed by a link-local one.
+		for len(nh) >= size {
+			u.NextHops = append(u.NextHops, net.IP(nh[:size]).String())
+			nh = nh[size:]
+		}
+		nlri, err := parsePrefixes(v[5+nhLen:], afi)
+		if err != nil {
+			return err
+		}
+		u.Announced = append(u.Announced, nlri...)
+	case attrMPUnreach:
+		// AFI(2), SAFI(1), withdrawn NLRI.
+		if len(v) < 3 {
+			return errors.New("MP_UNREACH_NLRI truncated")
+		}
+		nlri, err := parsePrefixes(v[3:], binary.BigEndian.Uint16(v[:2]))
+		if err != nil {
+			return err
+		}
+		u.Withdrawn = append(u.Withdrawn, nlri...)
+	}
+	return nil
+}
+
+// parsePrefixes decodes a run of NLRI encoded prefixes, each a 1 byte mask
+// length followed by just enough bytes to hold that many bits.
+func parsePrefixes(b []byte, afi uint16) ([]string, error) {
+	size := net.IPv4len
+	switch afi {
+	case afiIPv4:
+	case afiIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unsupported AFI %d", afi)
+	}
+
+	var prefixes []string
+	for len(b) > 0 {
+		ones := int(b[0])
+		n := (ones + 7) / 8
+		if ones > size*8 || len(b)-1 < n {
+			return nil, fmt.Errorf("invalid prefix of length %d with %d bytes remaining", ones, len(b)-1)
+		}
+		ip := make(net.IP, size)
+		copy(ip, b[1:1+n])
+		prefixes = append(prefixes, (&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, size*8)}).String())
+		b = b[1+n:]
+	}
+	return prefixes, nil
+}
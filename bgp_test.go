@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Every message in testdata/10-msg carries its raw UPDATE, parsing that must
+// agree with what RIS Live decoded into the JSON.
+func TestParseRawFixture(t *testing.T) {
+	fd, err := os.Open("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer fd.Close()
+
+	sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+	s := bufio.NewScanner(fd)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		var rm RisMessage
+		if err := json.Unmarshal(s.Bytes(), &rm); err != nil {
+			t.Fatalf("[message %d]: failed to decode fixture: %v", n, err)
+		}
+		rmd := rm.Data
+		if err := digestPath(rmd); err != nil {
+			t.Fatalf("[message %d]: failed to digest path: %v", n, err)
+		}
+		got, err := rmd.ParseRaw()
+		if err != nil {
+			t.Errorf("[message %d]: got error when not expecting one: %v", n, err)
+			continue
+		}
+
+		var announced, nextHops []string
+		seen := map[string]bool{}
+		for _, a := range rmd.Announcements {
+			nextHops = append(nextHops, a.NextHop)
+			for _, p := range a.Prefixes {
+				if !seen[p] {
+					announced = append(announced, p)
+				}
+				seen[p] = true
+			}
+		}
+		if len(rmd.DigestedPath) == 0 {
+			rmd.DigestedPath = nil
+		}
+		sort.Strings(nextHops)
+
+		if diff := cmp.Diff(got.Announced, announced, sorted); diff != "" {
+			t.Errorf("[message %d]: announced mismatch diff(-got, +want):\n%v\n", n, diff)
+		}
+		if diff := cmp.Diff(got.Withdrawn, rmd.Withdrawals, sorted); diff != "" {
+			t.Errorf("[message %d]: withdrawn mismatch diff(-got, +want):\n%v\n", n, diff)
+		}
+		if diff := cmp.Diff(got.NextHops, nextHops, sorted); diff != "" {
+			t.Errorf("[message %d]: next-hop mismatch diff(-got, +want):\n%v\n", n, diff)
+		}
+		if diff := cmp.Diff(got.Path, rmd.DigestedPath); diff != "" {
+			t.Errorf("[message %d]: path mismatch diff(-got, +want):\n%v\n", n, diff)
+		}
+		if diff := cmp.Diff(got.Communities, rmd.Community); diff != "" {
+			t.Errorf("[message %d]: community mismatch diff(-got, +want):\n%v\n", n, diff)
+		}
+		if got.Origin != rmd.Origin {
+			t.Errorf("[message %d]: origin mismatch got: %v want: %v", n, got.Origin, rmd.Origin)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	tests := []struct {
+		desc    string
+		raw     string
+		want    *ParsedUpdate
+		wantErr bool
+	}{{
+		desc: "Success testdata/1-msg",
+		raw:  "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF003E02000000234001010040020A02020000E15F00009312400304C43C09A5E00808E15F2EE0E15F2EE118C43246",
+		want: &ParsedUpdate{
+			Attributes: []PathAttribute{
+				{Flags: 0x40, Type: attrOrigin, Value: []byte{0}},
+				{Flags: 0x40, Type: attrASPath, Value: []byte{2, 2, 0, 0, 0xe1, 0x5f, 0, 0, 0x93, 0x12}},
+				{Flags: 0x40, Type: attrNextHop, Value: []byte{0xc4, 0x3c, 0x09, 0xa5}},
+				{Flags: 0xe0, Type: attrCommunities, Value: []byte{0xe1, 0x5f, 0x2e, 0xe0, 0xe1, 0x5f, 0x2e, 0xe1}},
+			},
+			Origin:      "igp",
+			Path:        []uint32{57695, 37650},
+			NextHops:    []string{"196.60.9.165"},
+			Communities: [][]uint32{{57695, 12000}, {57695, 12001}},
+			Announced:   []string{"196.50.70.0/24"},
+		},
+	}, {
+		desc:    "Failure not an UPDATE",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001304",
+		wantErr: true,
+	}, {
+		desc:    "Failure header length mismatch",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF003E0200000000",
+		wantErr: true,
+	}, {
+		desc:    "Failure empty ORIGIN attribute",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001D0200000004400100FF",
+		wantErr: true,
+	}, {
+		desc:    "Failure NLRI mask too long",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001C02000000002101020304",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := (&RisMessageData{Raw: test.raw}).ParseRaw()
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
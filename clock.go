@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// Clock tells the time for Listen: the wait before reconnecting, replay
+// pacing, polling a tailed file and when the last message was read. Tests
+// replace it to control time rather than wait on it.
+//
+// Flap detection, dedup and the other state kept across messages go by the
+// message timestamps, not a Clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock used without WithClock, the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock makes Listen tell the time by c rather than the system clock.
+func WithClock(c Clock) Option {
+	return func(r *RisLive) {
+		r.clock = c
+	}
+}
+
+// clk returns the Clock set by WithClock, or the system clock.
+func (r *RisLive) clk() Clock {
+	if r.clock == nil {
+		return systemClock{}
+	}
+	return r.clock
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestReplayClock(t *testing.T) {
+	const msgs = `{"type":"ris_message","data":{"timestamp":100,"id":"msg-1"}}` + "\n" +
+		`{"type":"ris_message","data":{"timestamp":160,"id":"msg-2"}}` + "\n"
+	file := filepath.Join(t.TempDir(), "2-msg")
+	if err := ioutil.WriteFile(file, []byte(msgs), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	start := time.Unix(1558620000, 0)
+	fc := newFakeClock(start)
+	r := &RisLive{File: proto.String(file), Chan: make(chan RisMessage, 2), ReplaySpeed: 2}
+	WithClock(fc)(r)
+	go r.Listen()
+	defer r.Close()
+
+	if rm := <-r.Chan; rm.Data.ID != "msg-1" {
+		t.Fatalf("got message %v first, wanted msg-1", rm.Data.ID)
+	}
+	if got := r.Status().LastMessage; !got.Equal(start) {
+		t.Errorf("got/want mismatch: got last message at %v wanted %v", got, start)
+	}
+
+	// The 60 second gap, replayed twice as fast, holds msg-2 for 30 seconds.
+	fc.BlockUntil(t, 1)
+	fc.Advance(29 * time.Second)
+	fc.BlockUntil(t, 1)
+	if n := len(r.Chan); n != 0 {
+		t.Fatalf("got %v messages before the replay gap, wanted none", n)
+	}
+	fc.Advance(time.Second)
+	if rm := <-r.Chan; rm.Data.ID != "msg-2" {
+		t.Fatalf("got message %v second, wanted msg-2", rm.Data.ID)
+	}
+	if got, want := r.Status().LastMessage, start.Add(30*time.Second); !got.Equal(want) {
+		t.Errorf("got/want mismatch: got last message at %v wanted %v", got, want)
+	}
+}
+
+// Close stops Listen part way through a replay gap, rather than after it.
+func TestReplayClose(t *testing.T) {
+	const msgs = `{"type":"ris_message","data":{"timestamp":100,"id":"msg-1"}}` + "\n" +
+		`{"type":"ris_message","data":{"timestamp":3700,"id":"msg-2"}}` + "\n"
+	file := filepath.Join(t.TempDir(), "2-msg")
+	if err := ioutil.WriteFile(file, []byte(msgs), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	fc := newFakeClock(time.Unix(1558620000, 0))
+	r := &RisLive{File: proto.String(file), Chan: make(chan RisMessage, 2), ReplaySpeed: 1}
+	WithClock(fc)(r)
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+
+	// Listen holds msg-2 back for the hour between the two.
+	fc.BlockUntil(t, 1)
+	r.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen did not return on Close during the replay gap")
+	}
+	if got := r.End(); got != EndClosed {
+		t.Errorf("got end %v, wanted %v", got, EndClosed)
+	}
+	if got := r.Records; got != 1 {
+		t.Errorf("got %v records, wanted 1", got)
+	}
+}
+
+func TestReconnectClock(t *testing.T) {
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		fmt.Fprint(w, "<html>\n<body>\n502 Bad Gateway\n</body>\n</html>\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	fc := newFakeClock(time.Unix(1558620000, 0))
+	r := &RisLive{
+		URL:                        &ts.URL,
+		File:                       proto.String(""),
+		Chan:                       make(chan RisMessage, 1),
+		MaxConsecutiveDecodeErrors: 3,
+		ReconnectBackoff:           NewBackoff(time.Minute, time.Minute, 0),
+	}
+	WithClock(fc)(r)
+	defer r.Close()
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+
+	// Listen waits out the backoff on the clock before connecting again.
+	fc.BlockUntil(t, 1)
+	if got := atomic.LoadInt64(&requests); got != 1 {
+		t.Errorf("got %v requests before the backoff, wanted 1", got)
+	}
+	fc.Advance(time.Minute)
+	fc.BlockUntil(t, 1)
+	if got := atomic.LoadInt64(&requests); got != 2 {
+		t.Errorf("got %v requests after the backoff, wanted 2", got)
+	}
+	if got := r.Status().Reconnects; got != 1 {
+		t.Errorf("got %v reconnects, wanted 1", got)
+	}
+
+	r.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen did not return after Close")
+	}
+}
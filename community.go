@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommunityPattern matches communities with any part a wildcard: 65000:*, any
+// value from AS65000, or *:666, blackhole from any ASN. A pattern of three
+// parts, 64500:*:2, matches large communities.
+type CommunityPattern struct {
+	Large bool      // Matches large communities, global:local1:local2, rather than asn:value.
+	Parts [3]uint32 // The values to match, the first two only for a standard community.
+	Any   [3]bool   // Parts written *, matching any value.
+}
+
+// ParseCommunityPattern parses a pattern written as a community, asn:value or
+// global:local1:local2, with * for any part. Standard community parts are
+// 0-65535, large community parts 0-4294967295.
+func ParseCommunityPattern(s string) (CommunityPattern, error) {
+	var p CommunityPattern
+	parts := strings.Split(s, ":")
+	bits := 16
+	switch len(parts) {
+	case 2:
+	case 3:
+		p.Large = true
+		bits = 32
+	default:
+		return p, fmt.Errorf("community pattern(%v) is not asn:value or global:local1:local2", s)
+	}
+	for i, part := range parts {
+		if part == "*" {
+			p.Any[i] = true
+			continue
+		}
+		v, err := strconv.ParseUint(part, 10, bits)
+		if err != nil {
+			return p, fmt.Errorf("community pattern(%v) part %q is not * or a number below 2^%d", s, part, bits)
+		}
+		p.Parts[i] = uint32(v)
+	}
+	return p, nil
+}
+
+// String writes the pattern as ParseCommunityPattern reads it.
+func (p CommunityPattern) String() string {
+	n := 2
+	if p.Large {
+		n = 3
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = "*"
+		if !p.Any[i] {
+			parts[i] = strconv.FormatUint(uint64(p.Parts[i]), 10)
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// match reports whether the community, its parts in order, matches.
+func (p CommunityPattern) match(c []uint32) bool {
+	for i, v := range c {
+		if !p.Any[i] && p.Parts[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether the message carries a community matching the
+// pattern, a standard community or, for a large pattern, a large community.
+func (p CommunityPattern) Matches(rm *RisMessageData) bool {
+	if p.Large {
+		for _, lc := range rm.LargeCommunity {
+			if p.match(lc[:]) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range rm.Community {
+		if len(c) == 2 && p.match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCommunityPattern checks the message carries a community matching any
+// one of the patterns.
+func (r *RisMessageData) CheckCommunityPattern(patterns []CommunityPattern) bool {
+	for _, p := range patterns {
+		if p.Matches(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlackholeCommunity is the well-known BLACKHOLE community of RFC 7999,
+// asking a neighbour to discard traffic to the prefix.
+var BlackholeCommunity = []uint32{65535, 666}
+
+// blackholeCommunity returns the first community the message carries which
+// is the well-known BLACKHOLE or one of the operator's.
+func blackholeCommunity(rm *RisMessageData, operator [][]uint32) ([]uint32, bool) {
+	for _, c := range rm.Community {
+		if len(c) != 2 {
+			continue
+		}
+		if c[0] == BlackholeCommunity[0] && c[1] == BlackholeCommunity[1] {
+			return c, true
+		}
+		for _, o := range operator {
+			if len(o) == 2 && c[0] == o[0] && c[1] == o[1] {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// blackhole returns the first announced prefix within the filter prefixes,
+// any prefix without them, carried with a blackhole community.
+func (pf *preparedFilter) blackhole(rm *RisMessageData) (string, []uint32, bool) {
+	var operator [][]uint32
+	if pf.filter != nil {
+		operator = pf.filter.BlackholeCommunities
+	}
+	community, ok := blackholeCommunity(rm, operator)
+	if !ok {
+		return "", nil, false
+	}
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			if !pf.prefix {
+				return prefix, community, true
+			}
+			ip, _, err := parsePrefix(prefix)
+			if err != nil {
+				continue
+			}
+			if _, ok := pf.match(ip); ok {
+				return prefix, community, true
+			}
+		}
+	}
+	return "", nil, false
+}
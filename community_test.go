@@ -0,0 +1,211 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCommunityPattern(t *testing.T) {
+	tests := []struct {
+		desc    string
+		pattern string
+		want    CommunityPattern
+		wantErr bool
+	}{{
+		desc:    "Success any value from an ASN",
+		pattern: "65000:*",
+		want:    CommunityPattern{Parts: [3]uint32{65000, 0, 0}, Any: [3]bool{false, true, false}},
+	}, {
+		desc:    "Success a value from any ASN",
+		pattern: "*:666",
+		want:    CommunityPattern{Parts: [3]uint32{0, 666, 0}, Any: [3]bool{true, false, false}},
+	}, {
+		desc:    "Success exact",
+		pattern: "65000:666",
+		want:    CommunityPattern{Parts: [3]uint32{65000, 666, 0}},
+	}, {
+		desc:    "Success large",
+		pattern: "4200000000:*:666",
+		want:    CommunityPattern{Large: true, Parts: [3]uint32{4200000000, 0, 666}, Any: [3]bool{false, true, false}},
+	}, {
+		desc:    "Failure one part",
+		pattern: "65000",
+		wantErr: true,
+	}, {
+		desc:    "Failure four parts",
+		pattern: "1:2:3:4",
+		wantErr: true,
+	}, {
+		desc:    "Failure standard part above 65535",
+		pattern: "65536:*",
+		wantErr: true,
+	}, {
+		desc:    "Failure part a partial wildcard",
+		pattern: "65000:6*",
+		wantErr: true,
+	}, {
+		desc:    "Failure empty part",
+		pattern: ":666",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseCommunityPattern(test.pattern)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+			if s := got.String(); s != test.pattern {
+				t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, s, test.pattern)
+			}
+		}
+	}
+}
+
+func TestCheckCommunityPattern(t *testing.T) {
+	rm := &RisMessageData{
+		Community:      [][]uint32{{65000, 100}, {3356, 666}},
+		LargeCommunity: [][3]uint32{{4200000000, 1, 666}},
+	}
+	tests := []struct {
+		desc     string
+		patterns []string
+		want     bool
+	}{{
+		desc:     "Success 65000:* any value from AS65000",
+		patterns: []string{"65000:*"},
+		want:     true,
+	}, {
+		desc:     "Failure 65001:* no community from AS65001",
+		patterns: []string{"65001:*"},
+	}, {
+		desc:     "Success *:666 blackhole from any ASN",
+		patterns: []string{"*:666"},
+		want:     true,
+	}, {
+		desc:     "Failure *:667 no community with the value",
+		patterns: []string{"*:667"},
+	}, {
+		desc:     "Failure parts from different communities",
+		patterns: []string{"65000:666"},
+	}, {
+		desc:     "Success any one pattern",
+		patterns: []string{"65001:*", "3356:666"},
+		want:     true,
+	}, {
+		desc:     "Success *:*:666 large community",
+		patterns: []string{"*:*:666"},
+		want:     true,
+	}, {
+		desc:     "Failure large pattern is not matched by a standard community",
+		patterns: []string{"3356:*:*"},
+	}, {
+		desc:     "Failure standard pattern is not matched by a large community",
+		patterns: []string{"*:1"},
+	}, {
+		desc: "Failure no patterns",
+	}}
+
+	for _, test := range tests {
+		var patterns []CommunityPattern
+		for _, s := range test.patterns {
+			p, err := ParseCommunityPattern(s)
+			if err != nil {
+				t.Fatalf("[%v]: failed to parse pattern %v: %v", test.desc, s, err)
+			}
+			patterns = append(patterns, p)
+		}
+		if got := rm.CheckCommunityPattern(patterns); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+		// The filter check agrees, if there are patterns to check.
+		if len(test.patterns) == 0 {
+			continue
+		}
+		r := &RisLive{Filter: &RisFilter{CommunityPatterns: test.patterns}}
+		if got := r.CheckCommunityPattern(rm); got != test.want {
+			t.Errorf("[%v]: got/want mismatch from the filter: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+
+	// Without patterns the filter check passes every message.
+	if r := (&RisLive{Filter: &RisFilter{}}); !r.CheckCommunityPattern(rm) {
+		t.Errorf("got false from a filter without community patterns, wanted true")
+	}
+}
+
+func TestCheckBlackhole(t *testing.T) {
+	tests := []struct {
+		desc          string
+		filter        *RisFilter
+		community     [][]uint32
+		prefixes      []string
+		wantPrefix    string
+		wantCommunity []uint32
+		wantOK        bool
+	}{{
+		desc:          "Success well-known 65535:666 on a monitored prefix",
+		filter:        &RisFilter{Prefix: []string{"192.0.2.0/24"}},
+		community:     [][]uint32{{3356, 100}, {65535, 666}},
+		prefixes:      []string{"198.51.100.0/24", "192.0.2.1/32"},
+		wantPrefix:    "192.0.2.1/32",
+		wantCommunity: []uint32{65535, 666},
+		wantOK:        true,
+	}, {
+		desc:      "Failure 65535:666 on a prefix not monitored",
+		filter:    &RisFilter{Prefix: []string{"192.0.2.0/24"}},
+		community: [][]uint32{{65535, 666}},
+		prefixes:  []string{"198.51.100.1/32"},
+	}, {
+		desc:          "Success 65535:666 on any prefix without filter prefixes",
+		filter:        &RisFilter{},
+		community:     [][]uint32{{65535, 666}},
+		prefixes:      []string{"198.51.100.1/32"},
+		wantPrefix:    "198.51.100.1/32",
+		wantCommunity: []uint32{65535, 666},
+		wantOK:        true,
+	}, {
+		desc:          "Success 65535:666 without a filter",
+		community:     [][]uint32{{65535, 666}},
+		prefixes:      []string{"198.51.100.1/32"},
+		wantPrefix:    "198.51.100.1/32",
+		wantCommunity: []uint32{65535, 666},
+		wantOK:        true,
+	}, {
+		desc:          "Success operator blackhole community",
+		filter:        &RisFilter{Prefix: []string{"192.0.2.0/24"}, BlackholeCommunities: [][]uint32{{3356, 9999}}},
+		community:     [][]uint32{{3356, 9999}},
+		prefixes:      []string{"192.0.2.1/32"},
+		wantPrefix:    "192.0.2.1/32",
+		wantCommunity: []uint32{3356, 9999},
+		wantOK:        true,
+	}, {
+		desc:      "Failure operator community not listed",
+		filter:    &RisFilter{Prefix: []string{"192.0.2.0/24"}},
+		community: [][]uint32{{3356, 9999}},
+		prefixes:  []string{"192.0.2.1/32"},
+	}, {
+		desc:     "Failure no communities",
+		filter:   &RisFilter{Prefix: []string{"192.0.2.0/24"}},
+		prefixes: []string{"192.0.2.1/32"},
+	}}
+
+	for _, test := range tests {
+		rm := NewTestMessage([]uint32{3356, 64500}, "igp", test.prefixes...).Data
+		rm.Community = test.community
+		r := &RisLive{Filter: test.filter}
+		prefix, community, ok := r.CheckBlackhole(rm)
+		if prefix != test.wantPrefix || ok != test.wantOK {
+			t.Errorf("[%v]: got/want mismatch: got %v/%v wanted %v/%v", test.desc, prefix, ok, test.wantPrefix, test.wantOK)
+		}
+		if diff := cmp.Diff(community, test.wantCommunity); diff != "" {
+			t.Errorf("[%v]: community got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
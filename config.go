@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// filterConfig is the JSON schema of a filter file read by LoadFilter:
+//
+//	{
+//	  "as_path": [701, 7018, 3356],
+//	  "invalid_transit_as": [701, 3356],
+//	  "transit_skip_peer": false,
+//	  "transit_skip_origin": true,
+//	  "origins": ["64500"],
+//	  "origin_asns": [64500, 64501],
+//	  "origin_attr": ["incomplete"],
+//	  "prefixes": ["192.0.2.0/24", "2001:db8::/32"],
+//	  "collapse_prefixes": true,
+//	  "require": ["announcements"],
+//	  "family": 6,
+//	  "update_kind": "announcements",
+//	  "mode": "any",
+//	  "large_communities": [[64500, 1, 2]],
+//	  "community_patterns": ["65000:*", "*:666"],
+//	  "as_path_regex": "^3356 .* 64500$",
+//	  "min_prefixes_per_message": 100,
+//	  "expected_upstreams": {"64500": [701, 3356]},
+//	  "expected_origins": {"64500": ["192.0.2.0/24"]},
+//	  "blackhole_communities": [[64500, 666]]
+//	}
+//
+// as_path may also be a string read by ParseASPath, "701 7018 3356", and the
+// ASNs of as_path, invalid_transit_as and origin_asns strings read by
+// ParseASN, "1.10" in asdot. Every key is optional, unknown keys are an error.
+type filterConfig struct {
+	ASPath            asPathConfig        `json:"as_path"`
+	InvalidTransitAS  []asnConfig         `json:"invalid_transit_as"`
+	TransitSkipPeer   bool                `json:"transit_skip_peer"`
+	TransitSkipOrigin bool                `json:"transit_skip_origin"`
+	Origins           []string            `json:"origins"`
+	OriginASNs        []asnConfig         `json:"origin_asns"`
+	OriginAttr        []string            `json:"origin_attr"`
+	Prefixes          []string            `json:"prefixes"`
+	CollapsePrefixes  bool                `json:"collapse_prefixes"`
+	Require           []string            `json:"require"`
+	Family            int                 `json:"family"`
+	UpdateKind        string              `json:"update_kind"`
+	Mode              string              `json:"mode"`
+	LargeCommunities  [][]uint32          `json:"large_communities"`
+	CommunityPatterns []string            `json:"community_patterns"`
+	ASPathRegex       string              `json:"as_path_regex"`
+	MinPrefixes       int                 `json:"min_prefixes_per_message"`
+	ExpectedUpstreams map[uint32][]uint32 `json:"expected_upstreams"`
+	ExpectedOrigins   map[uint32][]string `json:"expected_origins"`
+	Blackholes        [][]uint32          `json:"blackhole_communities"`
+}
+
+// LoadFilter reads a RisFilter from the JSON file at path. The filter must
+// pass Validate, a filter which would silently match less than written is an
+// error rather than a surprise.
+func LoadFilter(path string) (*RisFilter, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter file(%v): %v", path, err)
+	}
+	return parseFilter(b)
+}
+
+// parseFilter decodes and checks a JSON filter.
+func parseFilter(b []byte) (*RisFilter, error) {
+	var fc filterConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("failed to decode filter: %v", err)
+	}
+
+	f := &RisFilter{
+		ASPath:                []uint32(fc.ASPath),
+		TransitSkipPeer:       fc.TransitSkipPeer,
+		TransitSkipOrigin:     fc.TransitSkipOrigin,
+		Origins:               fc.Origins,
+		OriginASNs:            asnsConfig(fc.OriginASNs),
+		OriginAttr:            fc.OriginAttr,
+		Prefix:                fc.Prefixes,
+		CollapsePrefixes:      fc.CollapsePrefixes,
+		Require:               fc.Require,
+		Family:                fc.Family,
+		ExpectedOrigins:       fc.ExpectedOrigins,
+		MinPrefixesPerMessage: fc.MinPrefixes,
+		CommunityPatterns:     fc.CommunityPatterns,
+		ASPathRegex:           fc.ASPathRegex,
+		BlackholeCommunities:  fc.Blackholes,
+	}
+	if len(fc.InvalidTransitAS) > 0 {
+		f.InvalidTransitAS = map[uint32]bool{}
+		for _, asn := range asnsConfig(fc.InvalidTransitAS) {
+			f.InvalidTransitAS[asn] = true
+		}
+	}
+	if len(fc.ExpectedUpstreams) > 0 {
+		f.ExpectedUpstreams = map[uint32]map[uint32]bool{}
+		for origin, upstreams := range fc.ExpectedUpstreams {
+			f.ExpectedUpstreams[origin] = map[uint32]bool{}
+			for _, asn := range upstreams {
+				f.ExpectedUpstreams[origin][asn] = true
+			}
+		}
+	}
+	for _, lc := range fc.LargeCommunities {
+		// A shorter or longer array would silently decode into a triple.
+		if len(lc) != 3 {
+			return nil, fmt.Errorf("filter large_communities entry %v is not [global, local1, local2]", lc)
+		}
+		f.LargeCommunities = append(f.LargeCommunities, [3]uint32{lc[0], lc[1], lc[2]})
+	}
+	if fc.UpdateKind != "" {
+		kind, ok := parseUpdateKind(fc.UpdateKind)
+		if !ok {
+			return nil, fmt.Errorf("filter update_kind(%v) is not one of any, announcements or withdrawals", fc.UpdateKind)
+		}
+		f.UpdateKind = kind
+	}
+	if fc.Mode != "" {
+		mode, ok := parseMatchMode(fc.Mode)
+		if !ok {
+			return nil, fmt.Errorf("filter mode(%v) is not one of all or any", fc.Mode)
+		}
+		f.Mode = mode
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseUpdateKind returns the UpdateKind named name.
+func parseUpdateKind(name string) (UpdateKind, bool) {
+	for kind, n := range updateKinds {
+		if n == name {
+			return kind, true
+		}
+	}
+	return UpdateAny, false
+}
+
+// parseMatchMode returns the MatchMode named name.
+func parseMatchMode(name string) (MatchMode, bool) {
+	for mode, n := range matchModes {
+		if n == name {
+			return mode, true
+		}
+	}
+	return MatchAll, false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadFilter(t *testing.T) {
+	tests := []struct {
+		desc    string
+		path    string
+		want    *RisFilter
+		wantErr bool
+	}{{
+		desc: "Valid filter",
+		path: "testdata/filter.json",
+		want: &RisFilter{
+			ASPath:            []uint32{3356, 174},
+			InvalidTransitAS:  map[uint32]bool{701: true, 3356: true},
+			TransitSkipOrigin: true,
+			Origins:           []string{"64500"},
+			OriginASNs:        []uint32{64500, 64501},
+			Prefix:            []string{"192.0.2.0/24", "2001:db8::/32"},
+			Require:           []string{"announcements"},
+			UpdateKind:        AnnouncementsOnly,
+		},
+	}, {
+		desc:    "Invalid prefix",
+		path:    "testdata/filter-bad.json",
+		wantErr: true,
+	}, {
+		desc:    "Missing file",
+		path:    "testdata/no-such-filter.json",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := LoadFilter(test.path)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("[%v]: got/want mismatch:\n%v", test.desc, cmp.Diff(got, test.want))
+			}
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		desc    string
+		config  string
+		wantErr bool
+	}{{
+		desc:   "Empty filter",
+		config: `{}`,
+	}, {
+		desc:    "Unknown key",
+		config:  `{"prefix": ["192.0.2.0/24"]}`,
+		wantErr: true,
+	}, {
+		desc:    "Negative ASN",
+		config:  `{"as_path": [3356, -1]}`,
+		wantErr: true,
+	}, {
+		desc:   "AS path string",
+		config: `{"as_path": "701 3356 1.10"}`,
+	}, {
+		desc:    "AS path string, bad ASN",
+		config:  `{"as_path": "701 AS3356"}`,
+		wantErr: true,
+	}, {
+		desc:   "Asdot ASNs",
+		config: `{"as_path": [701, "1.10"], "origin_asns": ["2.2", 64500], "invalid_transit_as": ["0.701"]}`,
+	}, {
+		desc:    "Asdot ASN, half too large",
+		config:  `{"origin_asns": ["1.65536"]}`,
+		wantErr: true,
+	}, {
+		desc:   "4-byte ASNs above 2147483647",
+		config: `{"as_path": [4200000000], "origin_asns": [4294967295], "expected_upstreams": {"4200000000": [4200000001]}}`,
+	}, {
+		desc:    "ASN above 32 bits",
+		config:  `{"origin_asns": [4294967296]}`,
+		wantErr: true,
+	}, {
+		desc:    "ASN not a number",
+		config:  `{"invalid_transit_as": ["AS3356"]}`,
+		wantErr: true,
+	}, {
+		desc:   "Expected upstreams",
+		config: `{"expected_upstreams": {"64500": [701, 3356]}}`,
+	}, {
+		desc:    "Expected upstreams, bad origin",
+		config:  `{"expected_upstreams": {"AS64500": [701]}}`,
+		wantErr: true,
+	}, {
+		desc:   "Expected origins",
+		config: `{"expected_origins": {"64500": ["192.0.2.0/24", "2001:db8::/32"]}}`,
+	}, {
+		desc:    "Expected origins, bad prefix",
+		config:  `{"expected_origins": {"64500": ["192.0.2"]}}`,
+		wantErr: true,
+	}, {
+		desc:   "Large communities",
+		config: `{"large_communities": [[64500, 1, 2], [4200000000, 0, 4294967295]]}`,
+	}, {
+		desc:    "Large communities, not a triple",
+		config:  `{"large_communities": [[64500, 1, 2, 3]]}`,
+		wantErr: true,
+	}, {
+		desc:   "Community patterns",
+		config: `{"community_patterns": ["65000:*", "*:666", "64500:*:2"]}`,
+	}, {
+		desc:    "Community patterns, part too large",
+		config:  `{"community_patterns": ["65536:*"]}`,
+		wantErr: true,
+	}, {
+		desc:   "Blackhole communities",
+		config: `{"blackhole_communities": [[64500, 666], [3356, 9999]]}`,
+	}, {
+		desc:    "Blackhole communities, not a standard community",
+		config:  `{"blackhole_communities": [[64500, 666, 1]]}`,
+		wantErr: true,
+	}, {
+		desc:   "AS path regex",
+		config: `{"as_path_regex": "^3356 .* 64500$"}`,
+	}, {
+		desc:    "AS path regex which does not compile",
+		config:  `{"as_path_regex": "^3356 (174"}`,
+		wantErr: true,
+	}, {
+		desc:   "Origin attribute",
+		config: `{"origin_attr": ["egp", "incomplete"]}`,
+	}, {
+		desc:    "Origin attribute, unknown value",
+		config:  `{"origin_attr": ["static"]}`,
+		wantErr: true,
+	}, {
+		desc:   "Collapse prefixes",
+		config: `{"prefixes": ["10.0.0.0/8", "10.1.0.0/16"], "collapse_prefixes": true}`,
+	}, {
+		desc:   "Minimum prefixes",
+		config: `{"min_prefixes_per_message": 100}`,
+	}, {
+		desc:    "Minimum prefixes, negative",
+		config:  `{"min_prefixes_per_message": -1}`,
+		wantErr: true,
+	}, {
+		desc:   "Update kind",
+		config: `{"update_kind": "withdrawals"}`,
+	}, {
+		desc:    "Unknown update kind",
+		config:  `{"update_kind": "both"}`,
+		wantErr: true,
+	}, {
+		desc:   "Match mode",
+		config: `{"origins": ["64500"], "prefixes": ["192.0.2.0/24"], "mode": "any"}`,
+	}, {
+		desc:    "Unknown match mode",
+		config:  `{"mode": "either"}`,
+		wantErr: true,
+	}, {
+		desc:    "Not JSON",
+		config:  `prefixes: [192.0.2.0/24]`,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		_, err := parseFilter([]byte(test.config))
+		if (err != nil) != test.wantErr {
+			t.Errorf("[%v]: got error %v, wanted error: %v", test.desc, err, test.wantErr)
+		}
+	}
+}
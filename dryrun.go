@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterStats is the outcome of running a filter over a stream, without
+// publishing any message, to see what the filter would match.
+type FilterStats struct {
+	Total   int            // Messages read.
+	Matched int            // Messages the filter matches, by its Mode.
+	Hits    map[string]int // Messages passing each check, by check name.
+}
+
+// DryRun reads every message from Chan, as Get does, counting the messages
+// passing each filter check and those the filter matches. Checks for a part
+// of the filter which is not set pass every message, so a check with fewer
+// hits than Total is one narrowing the match. Nothing is published to the
+// sinks. Listen must be running, DryRun returns once Chan is closed.
+func (r *RisLive) DryRun() FilterStats {
+	stats := FilterStats{Hits: map[string]int{}}
+	for rm := range r.Chan {
+		rmd := rm.Data
+		stats.Total++
+		m := r.CheckAll(rmd)
+		for _, fc := range filterChecks {
+			if *fc.result(&m) {
+				stats.Hits[fc.name]++
+			}
+		}
+		if m.Matched {
+			stats.Matched++
+		}
+	}
+	return stats
+}
+
+// String renders the statistics one count per line, checks in the order
+// they are made.
+func (s FilterStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "total: %d\nmatched: %d\n", s.Total, s.Matched)
+	for _, fc := range filterChecks {
+		fmt.Fprintf(&b, "%v: %d\n", fc.name, s.Hits[fc.name])
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDryRun(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/10-msg"),
+		Chan: make(chan RisMessage, 10),
+		Filter: &RisFilter{
+			InvalidTransitAS: map[uint32]bool{174: true},
+			Origins:          []string{"12654"},
+			Prefix:           []string{"196.50.70.0/24", "2001:7fb:fe00::/40"},
+		},
+	}
+	rec := &recordSink{}
+	r.AddSink(rec)
+	go r.Listen()
+	got := r.DryRun()
+
+	want := FilterStats{
+		Total:   10,
+		Matched: 2,
+		Hits: map[string]int{
+			"updatekind":        10,
+			"aspath":            10,
+			"invalidtransitas":  3,
+			"origins":           4,
+			"originasns":        10,
+			"originattr":        10,
+			"expectedupstreams": 10,
+			"expectedorigins":   10,
+			"prefix":            4,
+			"require":           10,
+			"family":            10,
+			"largecommunities":  10,
+			"minprefixes":       10,
+			"communitypatterns": 10,
+			"aspathregex":       10,
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+	if len(rec.msgs) != 0 {
+		t.Errorf("dry run published %v messages, wanted none", len(rec.msgs))
+	}
+
+	wantString := "total: 10\nmatched: 2\nupdatekind: 10\naspath: 10\ninvalidtransitas: 3\norigins: 4\n" +
+		"originasns: 10\noriginattr: 10\nexpectedupstreams: 10\nexpectedorigins: 10\nprefix: 4\nrequire: 10\nfamily: 10\nlargecommunities: 10\n" +
+		"minprefixes: 10\ncommunitypatterns: 10\naspathregex: 10\n"
+	if got := got.String(); got != wantString {
+		t.Errorf("String() got/want mismatch:\n%v\n", cmp.Diff(got, wantString))
+	}
+}
+
+// Only the checks of the parts set narrow the match, every other passes all.
+func TestDryRunUnsetChecks(t *testing.T) {
+	r := &RisLive{
+		File:   proto.String("testdata/10-msg"),
+		Chan:   make(chan RisMessage, 10),
+		Filter: &RisFilter{Origins: []string{"12654"}},
+	}
+	go r.Listen()
+	got := r.DryRun()
+
+	if got.Total != 10 || got.Matched != 4 {
+		t.Errorf("got/want mismatch: got total %v matched %v wanted total 10 matched 4", got.Total, got.Matched)
+	}
+	for _, fc := range filterChecks {
+		want := 10
+		if fc.name == "origins" {
+			want = 4
+		}
+		if got.Hits[fc.name] != want {
+			t.Errorf("[%v]: got/want mismatch: got %v hits wanted %v", fc.name, got.Hits[fc.name], want)
+		}
+	}
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// preparedFilter is a RisFilter parsed once into the structures used to check
+// each message, rather than re-parsing the filter for every message seen.
+type preparedFilter struct {
+	filter   *RisFilter         // The filter this was compiled from.
+	v4, v6   *Tree              // Filter prefixes, by address family.
+	prefix   bool               // At least one filter prefix parsed.
+	defaults map[*Tree]bool     // The trees whose default route root is a filter prefix.
+	origins  map[uint32]bool    // Filter origin ASNs.
+	asns     map[uint32]bool    // Filter OriginASNs.
+	require  []string           // Filter Require keys, those which are known.
+	patterns []CommunityPattern // Filter CommunityPatterns, those which parse.
+	pathRE   *regexp.Regexp     // Filter ASPathRegex, nil if unset or it does not compile.
+	log      *slog.Logger       // Logs the filter entries and message prefixes which fail to parse.
+
+	authorised map[uint32]*preparedFilter // ExpectedOrigins prefixes, by origin.
+	expected   *preparedFilter            // Every ExpectedOrigins prefix.
+	owners     map[string]map[uint32]bool // ExpectedOrigins prefix to the origins authorised for it.
+}
+
+// requireKeys are the Require keys understood, and how each is checked.
+var requireKeys = map[string]func(*RisMessageData) bool{
+	"announcements": func(rm *RisMessageData) bool { return len(rm.Announcements) > 0 },
+	"withdrawals":   func(rm *RisMessageData) bool { return len(rm.Withdrawals) > 0 },
+	"community":     func(rm *RisMessageData) bool { return len(rm.Community) > 0 },
+}
+
+// Validate checks every entry in the filter can be used: prefixes parse as
+// CIDRs, origins and path ASNs are ASNs other than the reserved 0, OriginAttr
+// values are ORIGIN attribute values, Require keys are known, Family is 4, 6 or unset and
+// UpdateKind and Mode are defined values, MinPrefixesPerMessage is not negative,
+// CommunityPatterns parse, ASPathRegex compiles and BlackholeCommunities are
+// standard communities.
+// An entry which fails would otherwise only be logged, leaving a filter which
+// quietly never matches. All bad entries are listed in the one error.
+func (f *RisFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	var bad []string
+	for _, prefix := range f.Prefix {
+		if _, _, err := parsePrefix(prefix); err != nil {
+			bad = append(bad, fmt.Sprintf("prefix(%v)", prefix))
+		}
+	}
+	for _, origin := range f.Origins {
+		if _, err := ParseASN(origin); err != nil {
+			bad = append(bad, fmt.Sprintf("origin(%v)", origin))
+		}
+	}
+	for _, asn := range f.ASPath {
+		if asn == 0 {
+			bad = append(bad, fmt.Sprintf("aspath(%d)", asn))
+		}
+	}
+	for _, asn := range f.OriginASNs {
+		if asn == 0 {
+			bad = append(bad, fmt.Sprintf("originasn(%d)", asn))
+		}
+	}
+	for _, attr := range f.OriginAttr {
+		if !validOriginAttr(attr) {
+			bad = append(bad, fmt.Sprintf("originattr(%v)", attr))
+		}
+	}
+	var transits []string
+	for asn := range f.InvalidTransitAS {
+		if asn == 0 {
+			transits = append(transits, fmt.Sprintf("transit(%d)", asn))
+		}
+	}
+	sort.Strings(transits)
+	bad = append(bad, transits...)
+	var upstreams []string
+	for origin, allowed := range f.ExpectedUpstreams {
+		if origin == 0 {
+			upstreams = append(upstreams, fmt.Sprintf("upstreams(%d)", origin))
+		}
+		for asn := range allowed {
+			if asn == 0 {
+				upstreams = append(upstreams, fmt.Sprintf("upstreams(%d: %d)", origin, asn))
+			}
+		}
+	}
+	sort.Strings(upstreams)
+	bad = append(bad, upstreams...)
+	var expected []string
+	for origin, prefixes := range f.ExpectedOrigins {
+		if origin == 0 {
+			expected = append(expected, fmt.Sprintf("expectedorigins(%d)", origin))
+		}
+		for _, prefix := range prefixes {
+			if _, _, err := net.ParseCIDR(prefix); err != nil {
+				expected = append(expected, fmt.Sprintf("expectedorigins(%d: %v)", origin, prefix))
+			}
+		}
+	}
+	sort.Strings(expected)
+	bad = append(bad, expected...)
+	for _, key := range f.Require {
+		if _, ok := requireKeys[key]; !ok {
+			bad = append(bad, fmt.Sprintf("require(%v)", key))
+		}
+	}
+	if f.Family != 0 && f.Family != 4 && f.Family != 6 {
+		bad = append(bad, fmt.Sprintf("family(%d)", f.Family))
+	}
+	if _, ok := updateKinds[f.UpdateKind]; !ok {
+		bad = append(bad, fmt.Sprintf("updatekind(%d)", int(f.UpdateKind)))
+	}
+	if _, ok := matchModes[f.Mode]; !ok {
+		bad = append(bad, fmt.Sprintf("mode(%d)", int(f.Mode)))
+	}
+	if f.MinPrefixesPerMessage < 0 {
+		bad = append(bad, fmt.Sprintf("minprefixes(%d)", f.MinPrefixesPerMessage))
+	}
+	for _, pattern := range f.CommunityPatterns {
+		if _, err := ParseCommunityPattern(pattern); err != nil {
+			bad = append(bad, fmt.Sprintf("communitypattern(%v)", pattern))
+		}
+	}
+	if _, err := regexp.Compile(f.ASPathRegex); err != nil {
+		bad = append(bad, fmt.Sprintf("aspathregex(%v)", f.ASPathRegex))
+	}
+	for _, c := range f.BlackholeCommunities {
+		if len(c) != 2 || c[0] > 65535 || c[1] > 65535 {
+			bad = append(bad, fmt.Sprintf("blackhole(%v)", c))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("invalid filter entries: %v", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// filterChecks are the checks a message must pass to match a filter, by name,
+// in the order they are made, whether the part of the filter each checks is
+// set, and the MatchResult field each sets. The kind of update is cheapest,
+// and first.
+var filterChecks = []struct {
+	name   string
+	check  func(*preparedFilter, *RisMessageData) bool
+	set    func(*RisFilter) bool
+	result func(*MatchResult) *bool
+}{
+	{"updatekind", (*preparedFilter).checkUpdateKind, func(f *RisFilter) bool { return f.UpdateKind != UpdateAny },
+		func(m *MatchResult) *bool { return &m.UpdateKind }},
+	{"aspath", (*preparedFilter).checkASPath, func(f *RisFilter) bool { return len(f.ASPath) > 0 },
+		func(m *MatchResult) *bool { return &m.ASPath }},
+	{"invalidtransitas", (*preparedFilter).checkInvalidTransitAS, func(f *RisFilter) bool { return len(f.InvalidTransitAS) > 0 },
+		func(m *MatchResult) *bool { return &m.InvalidTransitAS }},
+	{"origins", (*preparedFilter).checkOrigins, func(f *RisFilter) bool { return len(f.Origins) > 0 },
+		func(m *MatchResult) *bool { return &m.Origins }},
+	{"originasns", (*preparedFilter).checkOriginASN, func(f *RisFilter) bool { return len(f.OriginASNs) > 0 },
+		func(m *MatchResult) *bool { return &m.OriginASNs }},
+	{"originattr", (*preparedFilter).checkOriginAttr, func(f *RisFilter) bool { return len(f.OriginAttr) > 0 },
+		func(m *MatchResult) *bool { return &m.OriginAttr }},
+	{"expectedupstreams", (*preparedFilter).checkExpectedUpstreams, func(f *RisFilter) bool { return len(f.ExpectedUpstreams) > 0 },
+		func(m *MatchResult) *bool { return &m.ExpectedUpstreams }},
+	{"expectedorigins", (*preparedFilter).checkExpectedOrigins, func(f *RisFilter) bool { return len(f.ExpectedOrigins) > 0 },
+		func(m *MatchResult) *bool { return &m.ExpectedOrigins }},
+	{"prefix", (*preparedFilter).checkPrefix, func(f *RisFilter) bool { return len(f.Prefix) > 0 },
+		func(m *MatchResult) *bool { return &m.Prefix }},
+	{"require", (*preparedFilter).checkRequire, func(f *RisFilter) bool { return len(f.Require) > 0 },
+		func(m *MatchResult) *bool { return &m.Require }},
+	{"family", (*preparedFilter).checkFamily, func(f *RisFilter) bool { return f.Family != 0 },
+		func(m *MatchResult) *bool { return &m.Family }},
+	{"largecommunities", (*preparedFilter).checkLargeCommunities, func(f *RisFilter) bool { return len(f.LargeCommunities) > 0 },
+		func(m *MatchResult) *bool { return &m.LargeCommunities }},
+	{"minprefixes", (*preparedFilter).checkMinPrefixes, func(f *RisFilter) bool { return f.MinPrefixesPerMessage > 0 },
+		func(m *MatchResult) *bool { return &m.MinPrefixes }},
+	{"communitypatterns", (*preparedFilter).checkCommunityPatterns, func(f *RisFilter) bool { return len(f.CommunityPatterns) > 0 },
+		func(m *MatchResult) *bool { return &m.CommunityPatterns }},
+	{"aspathregex", (*preparedFilter).checkASPathRegex, func(f *RisFilter) bool { return f.ASPathRegex != "" },
+		func(m *MatchResult) *bool { return &m.ASPathRegex }},
+}
+
+// MatchResult is the outcome of each filter check on one message, and
+// whether the message matched, by the filter's Mode. A check for a part of
+// the filter which is not set passes, and with MatchAny is not counted: the
+// message must pass one check of a set part, or the filter sets none.
+type MatchResult struct {
+	UpdateKind        bool
+	ASPath            bool
+	InvalidTransitAS  bool
+	Origins           bool
+	OriginASNs        bool
+	OriginAttr        bool
+	ExpectedUpstreams bool
+	ExpectedOrigins   bool
+	Prefix            bool
+	Require           bool
+	Family            bool
+	LargeCommunities  bool
+	MinPrefixes       bool
+	CommunityPatterns bool
+	ASPathRegex       bool
+
+	Matched bool // Every check passed, with MatchAny one check of a set part.
+}
+
+// Failed returns the names of the checks the message failed, in the order
+// they are made, as FilterStats names them.
+func (m MatchResult) Failed() []string {
+	var failed []string
+	for _, fc := range filterChecks {
+		if !*fc.result(&m) {
+			failed = append(failed, fc.name)
+		}
+	}
+	return failed
+}
+
+// matches reports whether the message matches the filter, stopping at the
+// first check which fails, or with MatchAny at the first set part passing.
+func (pf *preparedFilter) matches(rm *RisMessageData) bool {
+	if pf.filter == nil || pf.filter.Mode != MatchAny {
+		for _, fc := range filterChecks {
+			if !fc.check(pf, rm) {
+				return false
+			}
+		}
+		return true
+	}
+	set := false
+	for _, fc := range filterChecks {
+		if !fc.set(pf.filter) {
+			continue
+		}
+		if fc.check(pf, rm) {
+			return true
+		}
+		set = true
+	}
+	return !set
+}
+
+// checkAll makes every filter check, where matches stops at the first it can.
+func (pf *preparedFilter) checkAll(rm *RisMessageData) MatchResult {
+	var m MatchResult
+	all, any, set := true, false, false
+	for _, fc := range filterChecks {
+		ok := fc.check(pf, rm)
+		*fc.result(&m) = ok
+		all = all && ok
+		if pf.filter != nil && fc.set(pf.filter) {
+			set = true
+			any = any || ok
+		}
+	}
+	m.Matched = all
+	if pf.filter != nil && pf.filter.Mode == MatchAny {
+		m.Matched = any || !set
+	}
+	return m
+}
+
+// Match makes every filter check on one message, as CheckAll does, without a
+// RisLive or a stream: for testing code which consumes matches, or explaining
+// why a message did not match. The message's Path is digested first, as
+// Listen would; one without a Path is checked on its DigestedPath as is.
+// An invalid filter, or a path which does not digest, is an error.
+func Match(f *RisFilter, rm *RisMessage) (MatchResult, error) {
+	if rm == nil || rm.Data == nil {
+		return MatchResult{}, fmt.Errorf("message has no data to match")
+	}
+	if err := f.Validate(); err != nil {
+		return MatchResult{}, err
+	}
+	if len(rm.Data.Path) > 0 {
+		if err := digestPath(rm.Data); err != nil {
+			return MatchResult{}, fmt.Errorf("message %v: %v", rm.Data.ID, err)
+		}
+	}
+	return f.compile(discardLogger).checkAll(rm.Data), nil
+}
+
+// compile parses the filter prefixes into per-family trees and the origin
+// ASNs into a set. A prefix which does not parse is logged and skipped.
+// A nil filter compiles to one with nothing set.
+func (f *RisFilter) compile(l *slog.Logger) *preparedFilter {
+	pf := &preparedFilter{
+		filter:   f,
+		log:      l,
+		defaults: map[*Tree]bool{},
+		origins:  map[uint32]bool{},
+		asns:     map[uint32]bool{},
+	}
+	// Building the roots from constant prefixes can not fail.
+	pf.v4, _ = New("0.0.0.0/0")
+	pf.v6, _ = New("::/0")
+	if f == nil {
+		return pf
+	}
+
+	duplicates := 0
+	for _, prefix := range f.Prefix {
+		_, subnet, err := parsePrefix(prefix)
+		if err != nil {
+			pf.log.Info("filter prefix not parsed as CIDR, ignored", "prefix", prefix, "error", err)
+			continue
+		}
+		t := pf.tree(subnet.IP)
+		if ones, _ := subnet.Mask.Size(); ones == 0 {
+			pf.defaults[t] = true
+		} else if !t.Insert(subnet) {
+			// The tree holds each prefix once, a repeat is dropped.
+			duplicates++
+		}
+		pf.prefix = true
+	}
+	collapsed := 0
+	if f.CollapsePrefixes {
+		_, covered := pf.canonical()
+		for _, n := range covered {
+			pf.tree(n.IP).Delete(n)
+		}
+		collapsed = len(covered)
+	}
+	if duplicates > 0 || collapsed > 0 {
+		pf.log.Info("filter prefixes removed", "duplicates", duplicates, "covered", collapsed)
+	}
+	for _, origin := range f.Origins {
+		asn, err := ParseASN(origin)
+		if err != nil {
+			pf.log.Info("filter origin is not an ASN, ignored", "origin", origin, "error", err)
+			continue
+		}
+		pf.origins[asn] = true
+	}
+	for _, asn := range f.OriginASNs {
+		pf.asns[asn] = true
+	}
+	for _, key := range f.Require {
+		if _, ok := requireKeys[key]; !ok {
+			pf.log.Info("unknown filter require key, ignored", "key", key)
+			continue
+		}
+		pf.require = append(pf.require, key)
+	}
+	for _, pattern := range f.CommunityPatterns {
+		p, err := ParseCommunityPattern(pattern)
+		if err != nil {
+			pf.log.Info("filter community pattern not parsed, ignored", "pattern", pattern, "error", err)
+			continue
+		}
+		pf.patterns = append(pf.patterns, p)
+	}
+	if f.ASPathRegex != "" {
+		re, err := compileASPathRegex(f.ASPathRegex)
+		if err != nil {
+			// Matching nothing, rather than everything, as the filter was written to select.
+			pf.log.Info("filter as path regex not compiled, no path matches", "regex", f.ASPathRegex, "error", err)
+		}
+		pf.pathRE = re
+	}
+	if len(f.ExpectedOrigins) > 0 {
+		pf.authorised = map[uint32]*preparedFilter{}
+		pf.owners = map[string]map[uint32]bool{}
+		all := &RisFilter{}
+		for origin, prefixes := range f.ExpectedOrigins {
+			pf.authorised[origin] = (&RisFilter{Prefix: prefixes}).compile(l)
+			for _, prefix := range prefixes {
+				_, subnet, err := net.ParseCIDR(prefix)
+				if err != nil {
+					continue
+				}
+				if pf.owners[subnet.String()] == nil {
+					pf.owners[subnet.String()] = map[uint32]bool{}
+				}
+				pf.owners[subnet.String()][origin] = true
+				all.Prefix = append(all.Prefix, prefix)
+			}
+		}
+		pf.expected = all.compile(l)
+	}
+	return pf
+}
+
+// CanonicalPrefixes returns the minimal set of prefixes covering the same
+// addresses as the filter's Prefix list: duplicates, and more-specifics of
+// another entry, are removed. Prefixes are returned v4 then v6, each in Walk
+// order. Entries which do not parse are left out.
+func (f *RisFilter) CanonicalPrefixes() []*net.IPNet {
+	kept, _ := f.compile(discardLogger).canonical()
+	return kept
+}
+
+// canonical splits the filter prefixes into the minimal set covering them,
+// kept, and the more-specifics of a kept prefix, covered.
+func (pf *preparedFilter) canonical() (kept, covered []*net.IPNet) {
+	for _, t := range []*Tree{pf.v4, pf.v6} {
+		var last *net.IPNet
+		if pf.defaults[t] {
+			// The default route covers every other prefix of the family.
+			last = t.Root.Prefix.Network
+			kept = append(kept, last)
+		}
+		t.Walk(func(n *net.IPNet) bool {
+			if n == t.Root.Prefix.Network {
+				return true
+			}
+			// Walk visits a prefix before its more-specifics, and those
+			// more-specifics before any prefix outside it.
+			if last != nil && last.Contains(n.IP) {
+				covered = append(covered, n)
+				return true
+			}
+			last = n
+			kept = append(kept, n)
+			return true
+		})
+	}
+	return kept, covered
+}
+
+// tree returns the prefix tree for the family of ip.
+func (pf *preparedFilter) tree(ip net.IP) *Tree {
+	if AddressFamily(ip) == 4 {
+		return pf.v4
+	}
+	return pf.v6
+}
+
+// contains reports whether ip falls within one of the filter prefixes.
+func (pf *preparedFilter) contains(ip net.IP) bool {
+	_, ok := pf.match(ip)
+	return ok
+}
+
+// match returns the most specific filter prefix holding ip. Each tree is
+// rooted at a default route, which only counts if the filter holds it.
+func (pf *preparedFilter) match(ip net.IP) (*net.IPNet, bool) {
+	t := pf.tree(ip)
+	match, err := t.Lpm(ip)
+	if err != nil || (match == t.Root.Prefix.Network && !pf.defaults[t]) {
+		return nil, false
+	}
+	return match, true
+}
+
+// covering returns the most specific filter prefix covering the whole of n.
+func (pf *preparedFilter) covering(n *net.IPNet) (*net.IPNet, bool) {
+	t := pf.tree(n.IP)
+	match, err := t.PrefixLpm(n)
+	if err != nil || (match == t.Root.Prefix.Network && !pf.defaults[t]) {
+		return nil, false
+	}
+	return match, true
+}
+
+func (pf *preparedFilter) checkASPath(rm *RisMessageData) bool {
+	if pf.filter != nil && len(pf.filter.ASPath) > 0 {
+		return rm.MatchASPath(pf.filter.ASPath)
+	}
+	return true
+}
+
+func (pf *preparedFilter) checkInvalidTransitAS(rm *RisMessageData) bool {
+	if pf.filter != nil && len(pf.filter.InvalidTransitAS) > 0 {
+		return rm.InvalidTransitASSkip(pf.filter.InvalidTransitAS, pf.filter.TransitSkipPeer, pf.filter.TransitSkipOrigin)
+	}
+	return true
+}
+
+// checkOrigins is a single set lookup, RisMessageData.CheckOrigins scans the
+// filter's slice of origins and is left for callers holding only a slice.
+func (pf *preparedFilter) checkOrigins(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.Origins) == 0 {
+		return true
+	}
+	return rm.OriginASN != 0 && pf.origins[rm.OriginASN]
+}
+
+func (pf *preparedFilter) checkOriginASN(rm *RisMessageData) bool {
+	if len(pf.asns) == 0 {
+		return true
+	}
+	return rm.CheckOriginASN(pf.asns)
+}
+
+func (pf *preparedFilter) checkOriginAttr(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.OriginAttr) == 0 {
+		return true
+	}
+	for _, attr := range pf.filter.OriginAttr {
+		if rm.Origin == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// validOriginAttr reports whether attr is a value of the ORIGIN attribute.
+func validOriginAttr(attr string) bool {
+	for _, o := range bgpOrigins {
+		if attr == o {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpectedUpstreams passes, with a policy set, only the messages whose
+// origin is seen through an upstream the policy does not expect.
+func (pf *preparedFilter) checkExpectedUpstreams(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.ExpectedUpstreams) == 0 {
+		return true
+	}
+	_, unexpected := rm.UnexpectedUpstream(pf.filter.ExpectedUpstreams)
+	return unexpected
+}
+
+// checkExpectedOrigins passes, with a policy set, only the messages
+// announcing a prefix against the policy.
+func (pf *preparedFilter) checkExpectedOrigins(rm *RisMessageData) bool {
+	if pf.expected == nil {
+		return true
+	}
+	_, v := pf.expectedOrigins(rm)
+	return v != NoOriginViolation
+}
+
+// expectedOrigins returns the first announced prefix outside the origin's
+// authorised prefixes, or within the most specific authorised prefix of
+// another origin.
+func (pf *preparedFilter) expectedOrigins(rm *RisMessageData) (string, OriginViolation) {
+	if pf.expected == nil || rm.OriginASN == 0 || len(rm.OriginSet) > 0 {
+		return "", NoOriginViolation
+	}
+	own, hasPolicy := pf.authorised[rm.OriginASN]
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			_, subnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				continue
+			}
+			if hasPolicy {
+				if _, ok := own.covering(subnet); !ok {
+					return prefix, UnexpectedPrefix
+				}
+			}
+			if match, ok := pf.expected.covering(subnet); ok && !pf.owners[match.String()][rm.OriginASN] {
+				return prefix, UnexpectedOrigin
+			}
+		}
+	}
+	return "", NoOriginViolation
+}
+
+func (pf *preparedFilter) checkPrefix(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.Prefix) == 0 {
+		return true
+	}
+	_, _, ok := pf.matchPrefix(rm)
+	return ok
+}
+
+// matchPrefix returns the first announced prefix which falls within a filter
+// prefix, and the filter prefix it matched. Without a filter prefix nothing
+// matches, though checkPrefix passes every message.
+func (pf *preparedFilter) matchPrefix(rm *RisMessageData) (announced, filter *net.IPNet, ok bool) {
+	if !pf.prefix {
+		return nil, nil, false
+	}
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			announcementIP, subnet, err := parsePrefix(prefix)
+			if err != nil {
+				pf.log.Info("announcement prefix not parsed as CIDR", "prefix", prefix, "id", rm.ID, "error", err)
+				continue
+			}
+			if match, ok := pf.match(announcementIP); ok {
+				return subnet, match, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+func (pf *preparedFilter) checkUpdateKind(rm *RisMessageData) bool {
+	if pf.filter == nil {
+		return true
+	}
+	kind := rm.Kind()
+	switch pf.filter.UpdateKind {
+	case AnnouncementsOnly:
+		return kind == KindAnnouncement || kind == KindBoth
+	case WithdrawalsOnly:
+		return kind == KindWithdrawal || kind == KindBoth
+	}
+	return true
+}
+
+func (pf *preparedFilter) checkFamily(rm *RisMessageData) bool {
+	if pf.filter == nil || pf.filter.Family == 0 {
+		return true
+	}
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			ip, _, err := net.ParseCIDR(prefix)
+			if err == nil && AddressFamily(ip) == pf.filter.Family {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMinPrefixes counts the distinct prefixes announced and withdrawn, a
+// v6 prefix may be listed once per next-hop.
+func (pf *preparedFilter) checkMinPrefixes(rm *RisMessageData) bool {
+	if pf.filter == nil || pf.filter.MinPrefixesPerMessage <= 0 {
+		return true
+	}
+	return rm.PrefixCount() >= pf.filter.MinPrefixesPerMessage
+}
+
+func (pf *preparedFilter) checkLargeCommunities(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.LargeCommunities) == 0 {
+		return true
+	}
+	return rm.CheckLargeCommunities(pf.filter.LargeCommunities)
+}
+
+func (pf *preparedFilter) checkCommunityPatterns(rm *RisMessageData) bool {
+	if pf.filter == nil || len(pf.filter.CommunityPatterns) == 0 {
+		return true
+	}
+	return rm.CheckCommunityPattern(pf.patterns)
+}
+
+// compileASPathRegex compiles an ASPathRegex to match whole ASNs, as RIS
+// Live does: a pattern starting or ending in a digit only matches there at
+// the start or end of an ASN, so "^3356 174" matches "3356 174 64500" but
+// not "3356 1745", and "3356 174" does not match "13356 174".
+func compileASPathRegex(s string) (*regexp.Regexp, error) {
+	core := strings.TrimRight(strings.TrimLeft(s, "^(?:"), "$)")
+	re := "(?:" + s + ")"
+	if core != "" && isDigit(core[0]) {
+		re = "(?:^|[^0-9])" + re
+	}
+	if core != "" && isDigit(core[len(core)-1]) {
+		re += "(?:[^0-9]|$)"
+	}
+	return regexp.Compile(re)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (pf *preparedFilter) checkASPathRegex(rm *RisMessageData) bool {
+	if pf.filter == nil || pf.filter.ASPathRegex == "" {
+		return true
+	}
+	return pf.pathRE != nil && rm.MatchASPathRegex(pf.pathRE)
+}
+
+func (pf *preparedFilter) checkRequire(rm *RisMessageData) bool {
+	for _, key := range pf.require {
+		if !requireKeys[key](rm) {
+			return false
+		}
+	}
+	return true
+}
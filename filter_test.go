@@ -0,0 +1,644 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreparedCheckOrigins(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		origin uint32
+		want   bool
+	}{{
+		desc:   "Success origin in the filter",
+		filter: &RisFilter{Origins: []string{"1", "701", "7018"}},
+		origin: 701,
+		want:   true,
+	}, {
+		desc:   "Failure origin not in the filter",
+		filter: &RisFilter{Origins: []string{"1", "7018"}},
+		origin: 701,
+		want:   false,
+	}, {
+		desc:   "Success no origins in the filter",
+		filter: &RisFilter{},
+		origin: 701,
+		want:   true,
+	}}
+
+	for _, test := range tests {
+		got := test.filter.compile(discardLogger).checkOrigins(&RisMessageData{Origin: "igp", OriginASN: test.origin})
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestPreparedCheckPrefix(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		prefix string
+		want   bool
+	}{{
+		desc:   "Success more specific of a filter prefix",
+		filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}},
+		prefix: "192.168.1.0/24",
+		want:   true,
+	}, {
+		desc:   "Success v6 more specific of a filter prefix",
+		filter: &RisFilter{Prefix: []string{"192.168.0.0/16", "2001:db8::/32"}},
+		prefix: "2001:db8:1::/48",
+		want:   true,
+	}, {
+		desc:   "Success default route filter matches everything",
+		filter: &RisFilter{Prefix: []string{"0.0.0.0/0"}},
+		prefix: "192.168.1.0/24",
+		want:   true,
+	}, {
+		desc:   "Failure v4 default route filter does not match v6",
+		filter: &RisFilter{Prefix: []string{"0.0.0.0/0"}},
+		prefix: "2001:db8:1::/48",
+		want:   false,
+	}, {
+		desc:   "Failure outside the filter prefixes",
+		filter: &RisFilter{Prefix: []string{"192.168.0.0/16", "2001:db8::/32"}},
+		prefix: "10.1.0.0/16",
+		want:   false,
+	}, {
+		desc:   "Failure unparsable filter prefix is skipped",
+		filter: &RisFilter{Prefix: []string{"192.b.0.0/16"}},
+		prefix: "192.168.1.0/24",
+		want:   false,
+	}, {
+		desc:   "Success nil filter",
+		prefix: "192.168.1.0/24",
+		want:   true,
+	}}
+
+	for _, test := range tests {
+		rm := &RisMessageData{
+			Announcements: []*RisAnnouncement{{Prefixes: []string{test.prefix}}},
+		}
+		got := test.filter.compile(discardLogger).checkPrefix(rm)
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+// benchmarkFilter builds a filter of n /24 prefixes and origins.
+func benchmarkFilter(n int) *RisFilter {
+	f := &RisFilter{}
+	for i := 0; i < n; i++ {
+		f.Prefix = append(f.Prefix, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+		f.Origins = append(f.Origins, fmt.Sprintf("%d", 64512+i))
+	}
+	return f
+}
+
+func BenchmarkCheckPrefix(b *testing.B) {
+	rm := &RisMessageData{
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"10.3.232.0/24"}}},
+	}
+	f := benchmarkFilter(1000)
+
+	// Each message parses the whole filter, as CheckPrefix did before compiling.
+	b.Run("uncompiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f.compile(discardLogger).checkPrefix(rm)
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		pf := f.compile(discardLogger)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pf.checkPrefix(rm)
+		}
+	})
+}
+
+func BenchmarkCheckOrigins(b *testing.B) {
+	f := benchmarkFilter(10000)
+	// The last origin in the list, the worst case for a scan of the slice.
+	rm := &RisMessageData{OriginASN: uint32(64512 + len(f.Origins) - 1)}
+
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rm.CheckOrigins(f.Origins)
+		}
+	})
+	b.Run("set", func(b *testing.B) {
+		pf := f.compile(discardLogger)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pf.checkOrigins(rm)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		filter  *RisFilter
+		wantErr string
+	}{{
+		desc: "Valid filter",
+		filter: &RisFilter{
+			ASPath:           []uint32{3356, 174},
+			InvalidTransitAS: map[uint32]bool{701: true},
+			Origins:          []string{"15169", "4200000000"},
+			Prefix:           []string{"192.0.2.0/24", "2001:db8::/32"},
+			Require:          []string{"announcements"},
+		},
+	}, {
+		desc: "Nil filter",
+	}, {
+		desc:    "Malformed prefix",
+		filter:  &RisFilter{Prefix: []string{"192.168.0.0/16", "192.b.0.0/16"}},
+		wantErr: "invalid filter entries: prefix(192.b.0.0/16)",
+	}, {
+		desc: "Every bad entry is listed",
+		filter: &RisFilter{
+			ASPath:                []uint32{3356, 0},
+			InvalidTransitAS:      map[uint32]bool{0: true, 701: true},
+			Origins:               []string{"igp", "AS701", "0", "701"},
+			OriginASNs:            []uint32{701, 0},
+			OriginAttr:            []string{"igp", "IGP"},
+			Prefix:                []string{"192.0.2.0"},
+			Require:               []string{"nexthop"},
+			Family:                5,
+			UpdateKind:            UpdateKind(7),
+			ExpectedOrigins:       map[uint32][]string{0: {"192.0.2.0/24"}, 64500: {"192.0.2"}},
+			MinPrefixesPerMessage: -1,
+			CommunityPatterns:     []string{"65000:*", "65536:*", "*"},
+			ASPathRegex:           "(3356",
+			BlackholeCommunities:  [][]uint32{{65535, 666}, {65536, 666}, {666}},
+		},
+		wantErr: "invalid filter entries: prefix(192.0.2.0), origin(igp), origin(AS701), origin(0), " +
+			"aspath(0), originasn(0), originattr(IGP), transit(0), expectedorigins(0), expectedorigins(64500: 192.0.2), " +
+			"require(nexthop), family(5), updatekind(7), minprefixes(-1), communitypattern(65536:*), communitypattern(*), aspathregex((3356), " +
+			"blackhole([65536 666]), blackhole([666])",
+	}}
+
+	for _, test := range tests {
+		err := test.filter.Validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.wantErr {
+			t.Errorf("[%v]: got/want mismatch: got %q wanted %q", test.desc, got, test.wantErr)
+		}
+	}
+}
+
+func TestCanonicalPrefixes(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		want   []string
+	}{{
+		desc:   "Overlapping prefixes",
+		filter: &RisFilter{Prefix: []string{"10.1.0.0/16", "10.0.0.0/8", "10.1.1.0/24", "192.0.2.0/24"}},
+		want:   []string{"10.0.0.0/8", "192.0.2.0/24"},
+	}, {
+		desc:   "Disjoint prefixes",
+		filter: &RisFilter{Prefix: []string{"192.0.2.0/24", "198.51.100.0/24", "10.0.0.0/8", "2001:db8::/32"}},
+		want:   []string{"10.0.0.0/8", "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"},
+	}, {
+		desc:   "Adjacent prefixes are not merged",
+		filter: &RisFilter{Prefix: []string{"192.0.2.0/25", "192.0.2.128/25"}},
+		want:   []string{"192.0.2.0/25", "192.0.2.128/25"},
+	}, {
+		desc:   "Duplicates and host bits",
+		filter: &RisFilter{Prefix: []string{"192.0.2.0/24", "192.0.2.1/24", "192.0.2.0/24"}},
+		want:   []string{"192.0.2.0/24"},
+	}, {
+		desc:   "v6 more-specifics after a sibling",
+		filter: &RisFilter{Prefix: []string{"2001:db8:1::/48", "2001:db8::/48", "2001:db8::/32", "2001:db9::/32"}},
+		want:   []string{"2001:db8::/32", "2001:db9::/32"},
+	}, {
+		desc:   "Default route covers its family",
+		filter: &RisFilter{Prefix: []string{"10.0.0.0/8", "0.0.0.0/0", "2001:db8::/32"}},
+		want:   []string{"0.0.0.0/0", "2001:db8::/32"},
+	}, {
+		desc:   "Bad entries left out",
+		filter: &RisFilter{Prefix: []string{"192.b.0.0/16", "192.0.2.0/24"}},
+		want:   []string{"192.0.2.0/24"},
+	}, {
+		desc: "Nil filter",
+	}}
+
+	for _, test := range tests {
+		var got []string
+		for _, n := range test.filter.CanonicalPrefixes() {
+			got = append(got, n.String())
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		}
+	}
+}
+
+func TestCompileRemovesPrefixes(t *testing.T) {
+	tests := []struct {
+		desc    string
+		filter  *RisFilter
+		wantV4  string
+		wantV6  string
+		wantLog string
+		// An announcement and the filter prefix MatchPrefix reports for it.
+		announced  string
+		wantFilter string
+	}{{
+		desc:       "Duplicates removed",
+		filter:     &RisFilter{Prefix: []string{"192.0.2.0/24", "192.0.2.0/24", "192.0.2.1/24", "2001:db8::/32", "2001:db8::/32"}},
+		wantV4:     "0.0.0.0/0 192.0.2.0/24",
+		wantV6:     "::/0 2001:db8::/32",
+		wantLog:    "duplicates=3 covered=0",
+		announced:  "192.0.2.0/24",
+		wantFilter: "192.0.2.0/24",
+	}, {
+		desc:       "Overlapping prefixes kept without collapsing",
+		filter:     &RisFilter{Prefix: []string{"10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32", "2001:db8:1::/48"}},
+		wantV4:     "0.0.0.0/0 10.0.0.0/8 10.1.0.0/16",
+		wantV6:     "::/0 2001:db8::/32 2001:db8:1::/48",
+		announced:  "10.1.1.0/24",
+		wantFilter: "10.1.0.0/16",
+	}, {
+		desc: "Overlapping prefixes collapsed",
+		filter: &RisFilter{
+			Prefix:           []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.0.0/16", "2001:db8::/32", "2001:db8:1::/48"},
+			CollapsePrefixes: true,
+		},
+		wantV4:     "0.0.0.0/0 10.0.0.0/8",
+		wantV6:     "::/0 2001:db8::/32",
+		wantLog:    "duplicates=1 covered=2",
+		announced:  "10.1.1.0/24",
+		wantFilter: "10.0.0.0/8",
+	}, {
+		desc:       "Collapsed under a default route",
+		filter:     &RisFilter{Prefix: []string{"10.0.0.0/8", "0.0.0.0/0"}, CollapsePrefixes: true},
+		wantV4:     "0.0.0.0/0",
+		wantV6:     "::/0",
+		wantLog:    "duplicates=0 covered=1",
+		announced:  "10.1.1.0/24",
+		wantFilter: "0.0.0.0/0",
+	}}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		pf := test.filter.compile(slog.New(slog.NewTextHandler(&buf, nil)))
+		if got := pf.v4.String(); got != test.wantV4 {
+			t.Errorf("[%v]: got/want v4 mismatch: got %v wanted %v", test.desc, got, test.wantV4)
+		}
+		if got := pf.v6.String(); got != test.wantV6 {
+			t.Errorf("[%v]: got/want v6 mismatch: got %v wanted %v", test.desc, got, test.wantV6)
+		}
+		switch log := buf.String(); {
+		case test.wantLog == "" && log != "":
+			t.Errorf("[%v]: got log %q wanted none", test.desc, log)
+		case !strings.Contains(log, test.wantLog):
+			t.Errorf("[%v]: got log %q wanted it to hold %q", test.desc, log, test.wantLog)
+		}
+		rm := NewTestMessage([]uint32{3356, 64500}, "igp", test.announced).Data
+		if _, filter, ok := pf.matchPrefix(rm); !ok || filter.String() != test.wantFilter {
+			t.Errorf("[%v]: got/want mismatch: got filter prefix %v wanted %v", test.desc, filter, test.wantFilter)
+		}
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	rm := NewTestMessage([]uint32{3356, 174, 64500}, "igp", "192.0.2.0/24").Data
+	tests := []struct {
+		desc       string
+		filter     *RisFilter
+		want       MatchResult
+		wantFailed []string
+	}{{
+		desc:   "Empty filter",
+		filter: &RisFilter{},
+		want: MatchResult{
+			UpdateKind: true, ASPath: true, InvalidTransitAS: true, Origins: true, OriginASNs: true,
+			OriginAttr: true, ExpectedUpstreams: true, ExpectedOrigins: true, Prefix: true, Require: true,
+			Family: true, LargeCommunities: true, MinPrefixes: true, CommunityPatterns: true, ASPathRegex: true,
+			Matched: true,
+		},
+	}, {
+		desc: "Every check passed",
+		filter: &RisFilter{
+			InvalidTransitAS: map[uint32]bool{174: true},
+			Origins:          []string{"64500"},
+			Prefix:           []string{"192.0.2.0/23"},
+		},
+		want: MatchResult{
+			UpdateKind: true, ASPath: true, InvalidTransitAS: true, Origins: true, OriginASNs: true,
+			OriginAttr: true, ExpectedUpstreams: true, ExpectedOrigins: true, Prefix: true, Require: true,
+			Family: true, LargeCommunities: true, MinPrefixes: true, CommunityPatterns: true, ASPathRegex: true,
+			Matched: true,
+		},
+	}, {
+		desc: "Several checks failed, all made",
+		filter: &RisFilter{
+			InvalidTransitAS:      map[uint32]bool{174: true},
+			Origins:               []string{"64500"},
+			Prefix:                []string{"198.51.100.0/24"},
+			Family:                6,
+			OriginAttr:            []string{"incomplete"},
+			MinPrefixesPerMessage: 2,
+			CommunityPatterns:     []string{"65000:*"},
+			ASPathRegex:           "^701 ",
+		},
+		want: MatchResult{
+			UpdateKind: true, ASPath: true, InvalidTransitAS: true, Origins: true, OriginASNs: true,
+			ExpectedUpstreams: true, ExpectedOrigins: true, Require: true, LargeCommunities: true,
+		},
+		wantFailed: []string{"originattr", "prefix", "family", "minprefixes", "communitypatterns", "aspathregex"},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter}
+		got := r.CheckAll(rm)
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if diff := cmp.Diff(got.Failed(), test.wantFailed); diff != "" {
+			t.Errorf("[%v]: Failed() got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if got.Matched != r.prepare().matches(rm) {
+			t.Errorf("[%v]: CheckAll disagrees with matches", test.desc)
+		}
+	}
+}
+
+// With MatchAny one set part passing matches, the parts not set don't count.
+func TestCheckAllMatchAny(t *testing.T) {
+	rm := NewTestMessage([]uint32{3356, 174, 64500}, "igp", "192.0.2.0/24").Data
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		want   bool
+	}{{
+		desc:   "Nothing set",
+		filter: &RisFilter{Mode: MatchAny},
+		want:   true,
+	}, {
+		desc:   "Origin passes, prefix fails",
+		filter: &RisFilter{Mode: MatchAny, Origins: []string{"64500"}, Prefix: []string{"198.51.100.0/24"}},
+		want:   true,
+	}, {
+		desc:   "Origin fails, prefix passes",
+		filter: &RisFilter{Mode: MatchAny, Origins: []string{"64501"}, Prefix: []string{"192.0.2.0/23"}},
+		want:   true,
+	}, {
+		desc:   "Every set part fails",
+		filter: &RisFilter{Mode: MatchAny, Origins: []string{"64501"}, Prefix: []string{"198.51.100.0/24"}, Family: 6},
+		want:   false,
+	}, {
+		desc:   "MatchAll, origin passes, prefix fails",
+		filter: &RisFilter{Origins: []string{"64500"}, Prefix: []string{"198.51.100.0/24"}},
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter}
+		if got := r.CheckAll(rm).Matched; got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+		if got := r.prepare().matches(rm); got != test.want {
+			t.Errorf("[%v]: matches got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	// message is built by hand, the path not yet digested, as RIS Live sends it.
+	message := func() *RisMessage {
+		return &RisMessage{
+			Type: "ris_message",
+			Data: &RisMessageData{
+				ID:             "192.0.2.1-1558620047.08-1",
+				Type:           "UPDATE",
+				Path:           []interface{}{float64(3356), float64(174), float64(64500)},
+				Origin:         "igp",
+				Community:      [][]uint32{{65000, 1}},
+				LargeCommunity: [][3]uint32{{64500, 1, 2}},
+				Announcements: []*RisAnnouncement{{
+					NextHop:  "192.0.2.1",
+					Prefixes: []string{"192.0.2.0/24"},
+				}},
+			},
+		}
+	}
+	// filter sets every dimension, each to pass the message.
+	filter := func() *RisFilter {
+		return &RisFilter{
+			UpdateKind:            AnnouncementsOnly,
+			ASPath:                []uint32{174, 64500},
+			InvalidTransitAS:      map[uint32]bool{174: true},
+			Origins:               []string{"64500"},
+			OriginASNs:            []uint32{64500},
+			OriginAttr:            []string{"igp"},
+			ExpectedUpstreams:     map[uint32]map[uint32]bool{64500: {3356: true}},
+			ExpectedOrigins:       map[uint32][]string{64501: {"192.0.2.0/23"}},
+			Prefix:                []string{"192.0.2.0/23"},
+			Require:               []string{"announcements", "community"},
+			Family:                4,
+			LargeCommunities:      [][3]uint32{{64500, 1, 2}},
+			MinPrefixesPerMessage: 1,
+			CommunityPatterns:     []string{"65000:*"},
+			ASPathRegex:           "^3356 174 64500$",
+		}
+	}
+
+	tests := []struct {
+		desc       string
+		change     func(*RisFilter)
+		wantFailed []string
+	}{{
+		desc:   "Success every dimension matched",
+		change: func(f *RisFilter) {},
+	}, {
+		desc:       "UpdateKind",
+		change:     func(f *RisFilter) { f.UpdateKind = WithdrawalsOnly },
+		wantFailed: []string{"updatekind"},
+	}, {
+		desc:       "ASPath",
+		change:     func(f *RisFilter) { f.ASPath = []uint32{701} },
+		wantFailed: []string{"aspath"},
+	}, {
+		desc:       "InvalidTransitAS",
+		change:     func(f *RisFilter) { f.InvalidTransitAS = map[uint32]bool{701: true} },
+		wantFailed: []string{"invalidtransitas"},
+	}, {
+		desc:       "Origins",
+		change:     func(f *RisFilter) { f.Origins = []string{"64501"} },
+		wantFailed: []string{"origins"},
+	}, {
+		desc:       "OriginASNs",
+		change:     func(f *RisFilter) { f.OriginASNs = []uint32{64501} },
+		wantFailed: []string{"originasns"},
+	}, {
+		desc:       "OriginAttr",
+		change:     func(f *RisFilter) { f.OriginAttr = []string{"incomplete"} },
+		wantFailed: []string{"originattr"},
+	}, {
+		desc:       "ExpectedUpstreams, upstream expected",
+		change:     func(f *RisFilter) { f.ExpectedUpstreams = map[uint32]map[uint32]bool{64500: {174: true}} },
+		wantFailed: []string{"expectedupstreams"},
+	}, {
+		desc:       "ExpectedOrigins, prefix authorised",
+		change:     func(f *RisFilter) { f.ExpectedOrigins = map[uint32][]string{64500: {"192.0.2.0/23"}} },
+		wantFailed: []string{"expectedorigins"},
+	}, {
+		desc:       "Prefix",
+		change:     func(f *RisFilter) { f.Prefix = []string{"198.51.100.0/24"} },
+		wantFailed: []string{"prefix"},
+	}, {
+		desc:       "Require",
+		change:     func(f *RisFilter) { f.Require = []string{"withdrawals"} },
+		wantFailed: []string{"require"},
+	}, {
+		desc:       "Family",
+		change:     func(f *RisFilter) { f.Family = 6 },
+		wantFailed: []string{"family"},
+	}, {
+		desc:       "LargeCommunities",
+		change:     func(f *RisFilter) { f.LargeCommunities = [][3]uint32{{64500, 1, 3}} },
+		wantFailed: []string{"largecommunities"},
+	}, {
+		desc:       "MinPrefixesPerMessage",
+		change:     func(f *RisFilter) { f.MinPrefixesPerMessage = 2 },
+		wantFailed: []string{"minprefixes"},
+	}, {
+		desc:       "CommunityPatterns",
+		change:     func(f *RisFilter) { f.CommunityPatterns = []string{"*:666"} },
+		wantFailed: []string{"communitypatterns"},
+	}, {
+		desc:       "ASPathRegex",
+		change:     func(f *RisFilter) { f.ASPathRegex = "^701 " },
+		wantFailed: []string{"aspathregex"},
+	}}
+
+	for _, test := range tests {
+		f := filter()
+		test.change(f)
+		got, err := Match(f, message())
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if diff := cmp.Diff(got.Failed(), test.wantFailed); diff != "" {
+			t.Errorf("[%v]: Failed() got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if want := len(test.wantFailed) == 0; got.Matched != want {
+			t.Errorf("[%v]: got/want mismatch: got matched %v wanted %v", test.desc, got.Matched, want)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	badPath := NewTestMessage([]uint32{3356}, "igp", "192.0.2.0/24")
+	badPath.Data.Path = []interface{}{float64(-1)}
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		rm     *RisMessage
+	}{{
+		desc:   "Invalid filter",
+		filter: &RisFilter{Prefix: []string{"192.0.2.0/33"}},
+		rm:     &RisMessage{Data: &RisMessageData{}},
+	}, {
+		desc:   "No message",
+		filter: &RisFilter{},
+	}, {
+		desc:   "No message data",
+		filter: &RisFilter{},
+		rm:     &RisMessage{Type: "ris_message"},
+	}, {
+		desc:   "Path which does not digest",
+		filter: &RisFilter{},
+		rm:     &badPath,
+	}}
+
+	for _, test := range tests {
+		if _, err := Match(test.filter, test.rm); err == nil {
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
+
+// A message without a Path is matched on the DigestedPath it carries.
+func TestMatchDigestedPath(t *testing.T) {
+	rm := NewTestMessage([]uint32{3356, 174, 64500}, "igp", "192.0.2.0/24")
+	rm.Data.Path = nil
+	got, err := Match(&RisFilter{Origins: []string{"64500"}, InvalidTransitAS: map[uint32]bool{174: true}, Prefix: []string{"192.0.2.0/24"}}, &rm)
+	if err != nil {
+		t.Fatalf("got error when not expecting one: %v", err)
+	}
+	if !got.Matched {
+		t.Errorf("got failed checks %v, wanted a match", got.Failed())
+	}
+}
+
+// The path regex matches whole ASNs, over the websocket or HTTP and a file alike.
+func TestCheckASPathRegexBoundaries(t *testing.T) {
+	tests := []struct {
+		desc  string
+		regex string
+		path  []uint32
+		want  bool
+	}{{
+		desc:  "Anchored, whole ASNs",
+		regex: "^3356 174",
+		path:  []uint32{3356, 174, 64500},
+		want:  true,
+	}, {
+		desc:  "Anchored, longer last ASN",
+		regex: "^3356 174",
+		path:  []uint32{3356, 1745},
+	}, {
+		desc:  "Unanchored, longer first ASN",
+		regex: "3356 174",
+		path:  []uint32{13356, 174},
+	}, {
+		desc:  "Unanchored, whole ASNs mid path",
+		regex: "3356 174",
+		path:  []uint32{64501, 3356, 174, 64500},
+		want:  true,
+	}, {
+		desc:  "Alternation",
+		regex: "(701|174)$",
+		path:  []uint32{3356, 1174},
+	}, {
+		desc:  "Anchored both ends",
+		regex: "^3356 .* 64500$",
+		path:  []uint32{3356, 174, 64500},
+		want:  true,
+	}, {
+		desc:  "Leading space, not an ASN boundary",
+		regex: " 174",
+		path:  []uint32{3356, 174},
+		want:  true,
+	}}
+
+	for _, test := range tests {
+		rm := NewTestMessage(test.path, "igp", "192.0.2.0/24")
+		r := &RisLive{Filter: &RisFilter{ASPathRegex: test.regex}}
+		if got := r.CheckASPathRegex(rm.Data); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// rawFrame is the first stage of decoding a frame from RIS Live, the type
+// deciding what the data is decoded into.
+type rawFrame struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// ControlFrame is a frame from RIS Live other than a ris_message: a
+// *RisErrorData, *RisSubscribeOK, RisRRCList or Pong.
+type ControlFrame interface {
+	// FrameType is the frame's type as sent by RIS Live.
+	FrameType() string
+}
+
+// RisErrorData is the data of a ris_error frame, RIS Live reporting a
+// problem with the client's request.
+type RisErrorData struct {
+	Message string `json:"message"`
+}
+
+// RisSubscribeOK is the data of a ris_subscribe_ok frame, confirming a
+// subscription sent over the websocket.
+type RisSubscribeOK struct {
+	Subscription RisSubscribe `json:"subscription"`
+}
+
+// RisRRCList is the data of a ris_rrc_list frame, the route collectors.
+type RisRRCList []string
+
+// Pong is a pong frame, the reply to a ping.
+type Pong struct{}
+
+func (*RisErrorData) FrameType() string   { return "ris_error" }
+func (*RisSubscribeOK) FrameType() string { return "ris_subscribe_ok" }
+func (RisRRCList) FrameType() string      { return "ris_rrc_list" }
+func (Pong) FrameType() string            { return "pong" }
+
+// WithControlHandler sets h to be called by Listen with each control frame
+// read, in the order read. h is called from Listen's goroutine and holds up
+// reading the stream while it runs.
+func WithControlHandler(h func(ControlFrame)) Option {
+	return func(r *RisLive) {
+		r.control = h
+	}
+}
+
+// decodeControl decodes the data of a frame other than a ris_message.
+func decodeControl(f rawFrame) (ControlFrame, error) {
+	var cf ControlFrame
+	switch f.Type {
+	case "ris_error":
+		cf = &RisErrorData{}
+	case "ris_subscribe_ok":
+		cf = &RisSubscribeOK{}
+	case "ris_rrc_list":
+		var list RisRRCList
+		if err := json.Unmarshal(f.Data, &list); err != nil {
+			return nil, fmt.Errorf("failed to decode %v frame: %v", f.Type, err)
+		}
+		return list, nil
+	case "pong":
+		return Pong{}, nil
+	default:
+		return nil, fmt.Errorf("unknown frame type(%v)", f.Type)
+	}
+	if err := json.Unmarshal(f.Data, cf); err != nil {
+		return nil, fmt.Errorf("failed to decode %v frame: %v", f.Type, err)
+	}
+	return cf, nil
+}
+
+// route decodes the frame's data by its type. A ris_message is returned for
+// delivery, any other frame is passed to the control handler and false
+// returned. A frame which fails to decode is logged and dropped.
+func (r *RisLive) route(f rawFrame) (RisMessage, bool) {
+	if f.Type == "ris_message" {
+		rmd := &RisMessageData{}
+		if len(f.Data) == 0 || string(f.Data) == "null" {
+			r.log().Error("ris_message without data", "records", atomic.LoadInt64(&r.Records))
+			return RisMessage{}, false
+		}
+		if err := json.Unmarshal(f.Data, rmd); err != nil {
+			r.log().Error("bad json content", "records", atomic.LoadInt64(&r.Records), "error", err)
+			return RisMessage{}, false
+		}
+		return RisMessage{Type: f.Type, Data: rmd}, true
+	}
+
+	cf, err := decodeControl(f)
+	if err != nil {
+		r.log().Error("failed to decode frame", "type", f.Type, "records", atomic.LoadInt64(&r.Records), "error", err)
+		return RisMessage{}, false
+	}
+	if e, ok := cf.(*RisErrorData); ok {
+		r.log().Error("ris_error from RIS Live", "message", e.Message)
+	}
+	if r.control != nil {
+		r.control(cf)
+	}
+	return RisMessage{}, false
+}
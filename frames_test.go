@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListenControlFrames(t *testing.T) {
+	var got []ControlFrame
+	buffer := 10
+	r := NewRisLive(proto.String(""), proto.String("testdata/control-frames"), proto.String(""), nil, &buffer,
+		WithControlHandler(func(cf ControlFrame) { got = append(got, cf) }))
+	r.Listen()
+
+	want := []ControlFrame{
+		&RisSubscribeOK{Subscription: RisSubscribe{Host: "rrc21", Prefix: []string{"192.0.2.0/24"}, MoreSpecific: true}},
+		RisRRCList{"rrc00", "rrc01", "rrc03", "rrc04", "rrc05", "rrc06", "rrc07"},
+		&RisErrorData{Message: "Unknown host: rrc99"},
+		Pong{},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+
+	// The unknown frame and the ris_message without data are dropped, only
+	// the one whole ris_message is delivered.
+	var ids []string
+	for rm := range r.Chan {
+		ids = append(ids, rm.Data.ID)
+	}
+	if wantIDs := []string{"196.60.9.165-1558620047.08-11924763"}; !cmp.Equal(ids, wantIDs) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(ids, wantIDs))
+	}
+}
+
+func TestDecodeControl(t *testing.T) {
+	tests := []struct {
+		desc    string
+		frame   rawFrame
+		want    ControlFrame
+		wantErr bool
+	}{{
+		desc:  "ris_error",
+		frame: rawFrame{Type: "ris_error", Data: []byte(`{"message":"bad"}`)},
+		want:  &RisErrorData{Message: "bad"},
+	}, {
+		desc:  "ris_rrc_list",
+		frame: rawFrame{Type: "ris_rrc_list", Data: []byte(`["rrc00"]`)},
+		want:  RisRRCList{"rrc00"},
+	}, {
+		desc:  "pong",
+		frame: rawFrame{Type: "pong"},
+		want:  Pong{},
+	}, {
+		desc:    "ris_rrc_list of the wrong type",
+		frame:   rawFrame{Type: "ris_rrc_list", Data: []byte(`{"rrc00":true}`)},
+		wantErr: true,
+	}, {
+		desc:    "Unknown type",
+		frame:   rawFrame{Type: "ris_unknown", Data: []byte(`{}`)},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := decodeControl(test.frame)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+			}
+			if got.FrameType() != test.frame.Type {
+				t.Errorf("[%v]: got frame type %v wanted %v", test.desc, got.FrameType(), test.frame.Type)
+			}
+		}
+	}
+}
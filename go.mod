@@ -1,9 +1,9 @@
 module github.com/morrowc/rislive
 
-go 1.14
+go 1.21
 
 require (
-	github.com/golang/glog v1.2.4
 	github.com/golang/protobuf v1.3.2
 	github.com/google/go-cmp v0.6.0
+	github.com/gorilla/websocket v1.5.3
 )
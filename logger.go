@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Logger is a printf style logger, for callers whose logging isn't slog, set
+// with WithLogger. Structured attributes are appended to the message as
+// key=value pairs.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// discardLogger is the default, logging nothing.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+
+// WithSlog sets the slog Logger RisLive logs to.
+func WithSlog(l *slog.Logger) Option {
+	return func(r *RisLive) {
+		r.logger = l
+	}
+}
+
+// WithLogger sets a printf style Logger for RisLive to log to, at info level
+// and above.
+func WithLogger(l Logger) Option {
+	return WithLoggerLevel(l, slog.LevelInfo)
+}
+
+// WithLoggerLevel sets a printf style Logger for RisLive to log to, at min
+// level and above: slog.LevelDebug adds a line for every message read.
+func WithLoggerLevel(l Logger, min slog.Level) Option {
+	return WithSlog(slog.New(&loggerHandler{l: l, min: min}))
+}
+
+// log returns the Logger to use, a RisLive built without NewRisLive, or
+// without a logger option, logs nothing.
+func (r *RisLive) log() *slog.Logger {
+	if r.logger == nil {
+		return discardLogger
+	}
+	return r.logger
+}
+
+// loggerHandler is a slog.Handler writing to a Logger, errors to Errorf and
+// everything else to Infof.
+type loggerHandler struct {
+	l     Logger
+	min   slog.Level // The lowest level logged.
+	attrs []slog.Attr
+	group string
+}
+
+func (h *loggerHandler) Enabled(_ context.Context, level slog.Level) bool { return level >= h.min }
+
+func (h *loggerHandler) Handle(_ context.Context, rec slog.Record) error {
+	var b strings.Builder
+	b.WriteString(rec.Message)
+	for _, a := range h.attrs {
+		fmt.Fprintf(&b, " %v=%v", a.Key, a.Value)
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %v%v=%v", h.group, a.Key, a.Value)
+		return true
+	})
+	if rec.Level >= slog.LevelError {
+		h.l.Errorf("%s", b.String())
+	} else {
+		h.l.Infof("%s", b.String())
+	}
+	return nil
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.group + a.Key
+		nh.attrs = append(nh.attrs, a)
+	}
+	return &nh
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	nh := *h
+	nh.group = h.group + name + "."
+	return &nh
+}
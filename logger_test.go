@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// recordLogger keeps every line logged to it.
+type recordLogger struct {
+	mu     sync.Mutex
+	infos  []string
+	errors []string
+}
+
+func (l *recordLogger) Infof(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infos = append(l.infos, fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// recordHandler is a slog.Handler keeping every record logged to it.
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(_ context.Context, rec slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, rec)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestWithLogger(t *testing.T) {
+	tests := []struct {
+		desc      string
+		file      string
+		wantError string
+	}{{
+		desc:      "Missing file",
+		file:      "testdata/no-such-file",
+		wantError: "failed to read risFile file=testdata/no-such-file error=",
+	}, {
+		desc:      "Truncated file",
+		file:      "testdata/truncated",
+		wantError: "input ended in a truncated message records=2",
+	}}
+
+	buffer := 10
+	for _, test := range tests {
+		l := &recordLogger{}
+		r := NewRisLive(proto.String(""), proto.String(test.file), proto.String(""), nil, &buffer, WithLogger(l))
+		r.Listen()
+		if len(l.errors) != 1 || !strings.HasPrefix(l.errors[0], test.wantError) {
+			t.Errorf("[%v]: got/want mismatch: got errors %q wanted one starting %q", test.desc, l.errors, test.wantError)
+		}
+	}
+}
+
+// The per-message debug line of Get only reaches a Logger asking for it.
+func TestWithLoggerLevel(t *testing.T) {
+	tests := []struct {
+		desc      string
+		opt       func(Logger) Option
+		wantDebug bool
+	}{{
+		desc: "WithLogger, info and above",
+		opt:  WithLogger,
+	}, {
+		desc:      "WithLoggerLevel debug",
+		opt:       func(l Logger) Option { return WithLoggerLevel(l, slog.LevelDebug) },
+		wantDebug: true,
+	}}
+
+	buffer := 10
+	for _, test := range tests {
+		l := &recordLogger{}
+		r := NewRisLive(proto.String(""), proto.String("testdata/1-msg"), proto.String(""), &RisFilter{}, &buffer, test.opt(l))
+		go r.Listen()
+		r.Get(r.Filter)
+		debug := false
+		for _, line := range l.infos {
+			if strings.HasPrefix(line, "got a prefix") {
+				debug = true
+			}
+		}
+		if debug != test.wantDebug {
+			t.Errorf("[%v]: got/want mismatch: got debug lines %v wanted %v: %q", test.desc, debug, test.wantDebug, l.infos)
+		}
+	}
+}
+
+func TestWithSlog(t *testing.T) {
+	h := &recordHandler{}
+	buffer := 10
+	r := NewRisLive(proto.String(""), proto.String("testdata/malformed"), proto.String(""), nil, &buffer,
+		WithSlog(slog.New(h)))
+	r.Listen()
+
+	// The decode errors, the syntax error then the mistyped timestamp.
+	var got []map[string]string
+	for _, rec := range h.records {
+		if rec.Message != "bad json content" {
+			continue
+		}
+		if rec.Level != slog.LevelError {
+			t.Errorf("got level %v wanted %v", rec.Level, slog.LevelError)
+		}
+		attrs := map[string]string{}
+		rec.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value.String()
+			return true
+		})
+		got = append(got, attrs)
+	}
+	// The error text is the json package's, only its start is checked.
+	want := []map[string]string{{
+		"records": "2",
+		"error":   "invalid character ','",
+	}, {
+		"records": "2",
+		"error":   "json: cannot unmarshal string",
+	}}
+	if len(got) != len(want) {
+		t.Fatalf("got/want mismatch: got %v decode errors wanted %v: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i]["records"] != want[i]["records"] || !strings.HasPrefix(got[i]["error"], want[i]["error"]) {
+			t.Errorf("[error %d]: got/want mismatch: got %v wanted %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDefaultLoggerDiscards(t *testing.T) {
+	r := &RisLive{File: proto.String("testdata/no-such-file")}
+	// Nothing to log to, the error is dropped rather than panicking.
+	r.Listen()
+	if r.log() != discardLogger {
+		t.Errorf("got logger %v wanted discardLogger", r.log())
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// proxySchemes are the proxy URL schemes both the HTTP client and the
+// websocket dialer connect through.
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true}
+
+// WithProxy makes Listen, and Collectors, connect to RIS Live through the
+// proxy at raw, an http, https or socks5 URL such as socks5://127.0.0.1:1080,
+// instead of any proxy set in the environment. A URL which is not one of
+// these is an error, rather than connecting without the proxy.
+func WithProxy(raw string) (Option, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse proxy url(%v): %v", raw, err)
+	}
+	if !proxySchemes[u.Scheme] || u.Host == "" {
+		return nil, fmt.Errorf("proxy url(%v) is not an http, https or socks5 url with a host", raw)
+	}
+	return func(r *RisLive) {
+		r.proxy = u
+	}, nil
+}
+
+// WithTLSConfig sets the TLS configuration Listen, and Collectors, connect
+// to RIS Live with: a custom CA pool, a client certificate for an mTLS
+// fronted proxy, or a VerifyPeerCertificate pinning the RIPE certificate.
+// Without it the system roots are used. The config must not be modified
+// once set.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(r *RisLive) {
+		r.tlsConfig = c
+	}
+}
+
+// httpClient returns the client to request the firehose with, through the
+// proxy and with the TLS config if set.
+func (r *RisLive) httpClient() *http.Client {
+	if r.proxy == nil && r.tlsConfig == nil {
+		return &http.Client{}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if r.proxy != nil {
+		t.Proxy = http.ProxyURL(r.proxy)
+	}
+	if r.tlsConfig != nil {
+		t.TLSClientConfig = r.tlsConfig
+	}
+	return &http.Client{Transport: t}
+}
+
+// dialer returns the websocket dialer, through the proxy and with the TLS
+// config if set.
+func (r *RisLive) dialer() *websocket.Dialer {
+	if r.proxy == nil && r.tlsConfig == nil {
+		return websocket.DefaultDialer
+	}
+	d := *websocket.DefaultDialer
+	if r.proxy != nil {
+		d.Proxy = http.ProxyURL(r.proxy)
+	}
+	d.TLSClientConfig = r.tlsConfig
+	return &d
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestWithProxy(t *testing.T) {
+	tests := []struct {
+		desc    string
+		proxy   string
+		wantErr bool
+	}{{
+		desc:  "Success http proxy",
+		proxy: "http://proxy.example.net:3128",
+	}, {
+		desc:  "Success https proxy",
+		proxy: "https://proxy.example.net",
+	}, {
+		desc:  "Success socks5 proxy",
+		proxy: "socks5://127.0.0.1:1080",
+	}, {
+		desc:    "Failure unsupported scheme",
+		proxy:   "ftp://proxy.example.net",
+		wantErr: true,
+	}, {
+		desc:    "Failure no host",
+		proxy:   "proxy.example.net:3128",
+		wantErr: true,
+	}, {
+		desc:    "Failure not parsed",
+		proxy:   "http://[::1",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		opt, err := WithProxy(test.proxy)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			r := &RisLive{}
+			opt(r)
+			if got := r.proxy.String(); got != test.proxy {
+				t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.proxy)
+			}
+		}
+	}
+}
+
+func TestListenThroughProxy(t *testing.T) {
+	fd, err := ioutil.ReadFile("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	// The proxy stub serves the stream itself, for any url requested through it.
+	requested := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- r.URL.String()
+		fmt.Fprint(w, string(fd))
+	}))
+	defer ts.Close()
+
+	opt, err := WithProxy(ts.URL)
+	if err != nil {
+		t.Fatalf("got error when not expecting one: %v", err)
+	}
+	buffer := 10
+	r := NewRisLive(proto.String("http://ris-live.example.net/v1/stream/?format=json"), proto.String(""), proto.String("rislive-test"), nil, &buffer, opt)
+	go r.Listen()
+	for range r.Chan {
+	}
+
+	if r.Records != 10 {
+		t.Errorf("got/want mismatch: got %v records wanted 10", r.Records)
+	}
+	if got, want := <-requested, "http://ris-live.example.net/v1/stream/?format=json"; got != want {
+		t.Errorf("got/want mismatch: got %v requested wanted %v", got, want)
+	}
+}
+
+func TestListenWithTLSConfig(t *testing.T) {
+	fd, err := ioutil.ReadFile("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, string(fd))
+	}))
+	defer ts.Close()
+	serverCA := x509.NewCertPool()
+	serverCA.AddCert(ts.Certificate())
+
+	tests := []struct {
+		desc        string
+		config      *tls.Config
+		wantRecords int64
+	}{{
+		desc:        "Success server CA in the pool",
+		config:      &tls.Config{RootCAs: serverCA},
+		wantRecords: 10,
+	}, {
+		desc:        "Failure system roots",
+		wantRecords: 0,
+	}, {
+		desc:        "Failure server CA not in the pool",
+		config:      &tls.Config{RootCAs: x509.NewCertPool()},
+		wantRecords: 0,
+	}}
+
+	for _, test := range tests {
+		var opts []Option
+		if test.config != nil {
+			opts = append(opts, WithTLSConfig(test.config))
+		}
+		buffer := 10
+		r := NewRisLive(&ts.URL, proto.String(""), proto.String("rislive-test"), nil, &buffer, opts...)
+		go r.Listen()
+		for range r.Chan {
+		}
+		if r.Records != test.wantRecords {
+			t.Errorf("[%v]: got/want mismatch: got %v records wanted %v", test.desc, r.Records, test.wantRecords)
+		}
+	}
+}
@@ -9,47 +9,323 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
-
-	log "github.com/golang/glog"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// Version is the version of this client, sent to RIS Live in the default User-Agent.
+const Version = "1.0.0"
+
+// clientName names this client to RIS Live.
+const clientName = "golang-rislive-morrowc"
+
 var (
-	risFile   = flag.String("risFile", "", "A file of json content, to help in testing.")
-	risLive   = flag.String("rislive", "https://ris-live.ripe.net/v1/stream/?format=json", "RIS Live firehose url")
-	risClient = flag.String("risclient", "golang-rislive-morrowc", "Clientname to send to rislive")
-	buffer    = flag.Int("buffer", 1000, "Max depth of Ris messages to queue.")
+	risFile    = flag.String("risFile", "", "A file of json content, to help in testing.")
+	risLive    = flag.String("rislive", "https://ris-live.ripe.net/v1/stream/?format=json", "RIS Live firehose url")
+	risClient  = flag.String("risclient", "", "Clientname to send to rislive, by default DefaultUserAgent.")
+	buffer     = flag.Int("buffer", 1000, "Max depth of Ris messages to queue.")
+	webSocket  = flag.Bool("websocket", false, "Read from the RIS Live websocket rather than the HTTP firehose.")
+	filterFile = flag.String("filter", "", "A JSON filter file, reloaded on SIGHUP, replacing the demo filter.")
+	dryRun     = flag.Bool("dryrun", false, "Report how many messages the filter matches, and on what, then exit.")
+	format     = flag.String("format", "text", "The output format of matched messages: text, json or csv.")
+	workers    = flag.Int("workers", 1, "Goroutines evaluating the filter, matches are printed unordered with more than one.")
+	tail       = flag.Bool("tail", false, "Keep reading risFile as it is written, as tail -f, until interrupted.")
+	proxy      = flag.String("proxy", "", "An http, https or socks5 proxy url to connect to RIS Live through.")
+	asPath     = flag.String("aspath", "", "An AS-path fragment matched messages must contain, \"701 3356 174\", replacing the filter's.")
+	start      = flag.Int("start", 0, "Messages to read past before delivering, to start from message N+1 of risFile.")
+	startTime  = flag.Float64("starttime", 0, "A Unix time, messages timestamped before it are read past, not delivered.")
+	group      = flag.Duration("group", 0, "Print one JSON line per prefix and path, listing the peers which saw it within this window, rather than each match.")
 )
 
 // RisLive is a struct to hold basic data used in connecting to the RIS Live service
 // and managing data output/collection for the calling client.
+//
+// The Filter may be replaced while Listen and Get are running by calling SetFilter,
+// assigning to Filter directly is only safe before Get has started.
 // TODO(morrowc): Why are the struct elements here Exported? unexport please.
 type RisLive struct {
 	URL     *string
 	File    *string
 	UA      *string
 	Filter  *RisFilter
-	Records int64
+	Records int64 // Messages read, updated atomically while Listen runs, read with Status.
 	Chan    chan RisMessage
+
+	// OriginStateSize bounds the number of prefixes OriginChange remembers.
+	OriginStateSize int
+	// ReplaySpeed paces messages read from File by the gaps between their
+	// timestamps, divided by ReplaySpeed: 1 replays in real time, 2 twice as
+	// fast. 0 replays as fast as the file can be decoded.
+	ReplaySpeed float64
+	// StartOffset and StartTimestamp start delivering part way into the
+	// stream, to look at an incident in a large capture: the first
+	// StartOffset messages, and those before StartTimestamp, a Unix time as
+	// the message Timestamp, are read past without reaching Chan or a sink.
+	// With both set delivery starts once both are passed, after which every
+	// message is delivered. Each is applied once per Listen, a stream
+	// reconnected to carries on from the messages already read past.
+	StartOffset    int
+	StartTimestamp float64
+	// DedupWindow suppresses, in Get, messages whose every prefix was already
+	// seen with the same origin and path within the window, by message
+	// timestamp. 0 disables deduplication.
+	DedupWindow time.Duration
+	// DeaggThreshold is the number of distinct more-specifics of a filter
+	// prefix one origin may announce within DeaggWindow, by message
+	// timestamp, before Deaggregation reports it. 0 disables the detector.
+	DeaggThreshold int
+	DeaggWindow    time.Duration
+	// DropOnFull drops a message when Chan is full, counting it in Dropped,
+	// rather than blocking Listen until the consumer catches up.
+	DropOnFull bool
+	// IncludeRaw keeps the Raw BGP message of each message, which ParseRaw
+	// and RawSink need. Without it the websocket subscription asks RIS Live
+	// not to send Raw, and Listen drops Raw from messages which carry it.
+	IncludeRaw bool
+	// MaxConsecutiveDecodeErrors bounds the bad frames read in a row before
+	// Listen stops reading the stream, connecting a remote stream again. 0
+	// never stops, each bad frame is skipped.
+	MaxConsecutiveDecodeErrors int
+	// MaxMessageSize bounds, in bytes, the message Listen decodes, so a
+	// stream of one endless object can't exhaust memory. A larger message is
+	// skipped as a bad frame. 0 is DefaultMaxMessageSize, negative unbounded.
+	MaxMessageSize int
+	// ReconnectBackoff paces Listen connecting again, nil is a Backoff from
+	// 1 second up to 1 minute. It is reset by each message read.
+	ReconnectBackoff *Backoff
+	// Workers is the number of goroutines Matches evaluates the filter on,
+	// 0 or 1 for one.
+	Workers int
+	// Tail keeps reading File at its end, as tail -f, for messages appended
+	// to a capture still being written, until Close is called.
+	Tail bool
+
+	dropped   int64 // Messages dropped with Chan full, accessed atomically.
+	highWater int64 // The deepest Chan has been after a send, accessed atomically.
+	bytesRead int64 // Bytes read from the stream, accessed atomically.
+	end       int32 // The EndStatus of the last stream read, accessed atomically.
+
+	lastMessageTime int64        // UnixNano of the last message read, accessed atomically.
+	reconnects      int64        // Times Listen has connected again, accessed atomically.
+	lastHTTPError   atomic.Value // The *StatusError of the last non-2xx firehose response.
+
+	mu       sync.RWMutex      // Guards Filter, prepared, sinks and subs once running.
+	prepared *preparedFilter   // Filter, compiled by NewRisLive and SetFilter.
+	sinks    []Sink            // Sent each message matching the filter.
+	subs     []chan RisMessage // Sent each message Listen reads, by Subscribe.
+
+	webSocket bool               // Read from the RIS Live websocket, not the HTTP firehose.
+	logger    *slog.Logger       // Set by WithSlog or WithLogger, see log.
+	control   func(ControlFrame) // Set by WithControlHandler, sent frames other than ris_message.
+	capture   io.Writer          // Set by CaptureTo, written the stream as read.
+	proxy     *url.URL           // Set by WithProxy, the proxy to connect through.
+	tlsConfig *tls.Config        // Set by WithTLSConfig, nil uses the system roots.
+	clock     Clock              // Set by WithClock, nil uses the system clock.
+	counter   *OriginCounter     // Set by WithOriginCounter, observes each message read.
+
+	closeMu sync.Mutex    // Guards body, done and closed.
+	body    io.Closer     // The stream Listen is reading, closed by Close.
+	done    chan struct{} // Closed by Close, to stop Listen waiting on a full channel.
+	closed  bool          // Close has been called.
+
+	stateMu     sync.Mutex // Guards the state kept across messages.
+	originState *lruCache  // Prefix to last seen origin ASN.
+	dedupState  *lruCache  // Prefix, origin and path to when last seen.
+	deaggState  *lruCache  // Filter prefix and origin to *deaggState.
 }
 
 // RisFilter is an object to hold content used to filter the collected BGP
 // routes before display to the caller.
 type RisFilter struct {
-	ASPath           []int32        // Asath: [701, 7018, 3356] a fragment of the aspath seen.
-	InvalidTransitAS map[int32]bool // {"701":true, "3356":true}.
-	Origins          []string       // A list of interesting origin ASH.
-	Prefix           []string       // Prefix: ["1.2.3.0/24", "2001:db8::/32"] a list of prefixes.
+	ASPath            []uint32        // Asath: [701, 7018, 3356] a fragment of the aspath seen.
+	InvalidTransitAS  map[uint32]bool // {"701":true, "3356":true}.
+	TransitSkipPeer   bool            // Don't check the peer, first, ASN against InvalidTransitAS.
+	TransitSkipOrigin bool            // Don't check the origin, last, ASN against InvalidTransitAS.
+	Origins           []string        // Origins: ["701"] a list of interesting origin ASNs.
+	OriginASNs        []uint32        // OriginASNs: [701, 7018] origin ASNs, matching any member of an origin AS_SET.
+	OriginAttr        []string        // OriginAttr: ["incomplete"] ORIGIN attribute values: igp, egp or incomplete.
+	Prefix            []string        // Prefix: ["1.2.3.0/24", "2001:db8::/32"] a list of prefixes.
+	CollapsePrefixes  bool            // Drop Prefix entries covered by another, MatchPrefix reports the covering one.
+	Require           []string        // Require: ["announcements"] attributes a message must carry.
+	Family            int             // Family: 4 or 6, the address family announced, 0 for both.
+	UpdateKind        UpdateKind      // UpdateKind: the kind of change a message must carry.
+	Mode              MatchMode       // Mode: MatchAny to match a message passing any one set part of the filter.
+	LargeCommunities  [][3]uint32     // LargeCommunities: [[64500, 1, 2]] a message must carry any one of.
+	CommunityPatterns []string        // CommunityPatterns: ["65000:*", "*:666"] a message must carry a community matching any one of.
+	// ASPathRegex: "^3356 .* 64500$" a regular expression the path, as
+	// PathString writes it, must match, a digit at either end of the pattern
+	// matching only a whole ASN. Over the websocket a pattern of only
+	// ASNs and anchors, "^3356 174", is also sent to RIS Live to match.
+	ASPathRegex string
+	// MinPrefixesPerMessage: 100 the fewest prefixes, announced and withdrawn,
+	// a message must carry, to find bulk updates. 0 for any number.
+	MinPrefixesPerMessage int
+	// ExpectedUpstreams: {64500: {701: true, 3356: true}} the only upstreams,
+	// the ASN next to the origin, each origin is expected to be seen through.
+	ExpectedUpstreams map[uint32]map[uint32]bool
+	// ExpectedOrigins: {64500: ["192.0.2.0/24"]} the prefixes, and their
+	// more-specifics, each origin is authorised to announce.
+	ExpectedOrigins map[uint32][]string
+	// BlackholeCommunities: [[64500, 666]] the operator blackhole communities
+	// CheckBlackhole looks for, as well as the well-known BLACKHOLE, 65535:666.
+	BlackholeCommunities [][]uint32
+}
+
+// OriginViolation is the way an announcement breaks the ExpectedOrigins policy.
+type OriginViolation int
+
+const (
+	// NoOriginViolation is an announcement the policy allows, or does not cover.
+	NoOriginViolation OriginViolation = iota
+	// UnexpectedPrefix is an origin with a policy announcing a prefix outside
+	// it, the origin may be compromised or misconfigured.
+	UnexpectedPrefix
+	// UnexpectedOrigin is a prefix in the policy announced by an origin not
+	// authorised for it, a possible hijack.
+	UnexpectedOrigin
+)
+
+// originViolations names each OriginViolation.
+var originViolations = map[OriginViolation]string{
+	NoOriginViolation: "none",
+	UnexpectedPrefix:  "unexpected prefix",
+	UnexpectedOrigin:  "unexpected origin",
+}
+
+func (v OriginViolation) String() string {
+	if name, ok := originViolations[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("OriginViolation(%d)", int(v))
+}
+
+// MatchMode is how the checks of a filter combine into a match.
+type MatchMode int
+
+const (
+	MatchAll MatchMode = iota // A message must pass the check of every set part.
+	MatchAny                  // A message must pass the check of any one set part.
+)
+
+// matchModes names each MatchMode, as written in a filter file.
+var matchModes = map[MatchMode]string{
+	MatchAll: "all",
+	MatchAny: "any",
+}
+
+func (m MatchMode) String() string {
+	if name, ok := matchModes[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("MatchMode(%d)", int(m))
+}
+
+// UpdateKind selects messages by the kind of change they carry.
+type UpdateKind int
+
+const (
+	UpdateAny         UpdateKind = iota // Announcements, withdrawals or both.
+	AnnouncementsOnly                   // Messages announcing at least one prefix.
+	WithdrawalsOnly                     // Messages withdrawing at least one prefix.
+)
+
+// updateKinds names each UpdateKind, as written in a filter file.
+var updateKinds = map[UpdateKind]string{
+	UpdateAny:         "any",
+	AnnouncementsOnly: "announcements",
+	WithdrawalsOnly:   "withdrawals",
+}
+
+func (k UpdateKind) String() string {
+	if name, ok := updateKinds[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("UpdateKind(%d)", int(k))
+}
+
+// MessageKind is the kind of change a single message carries, as returned by
+// Kind. It is not an UpdateKind, a filter selects by AnnouncementsOnly or
+// WithdrawalsOnly.
+type MessageKind int
+
+const (
+	KindAnnouncement MessageKind = iota // Announcing prefixes, withdrawing none.
+	KindWithdrawal                      // Withdrawing prefixes, announcing none.
+	KindBoth                            // Announcing and withdrawing prefixes.
+	KindOther                           // Not an UPDATE, or an UPDATE carrying no prefixes.
+)
+
+// messageKinds names each MessageKind.
+var messageKinds = map[MessageKind]string{
+	KindAnnouncement: "announcement",
+	KindWithdrawal:   "withdrawal",
+	KindBoth:         "both",
+	KindOther:        "other",
+}
+
+func (k MessageKind) String() string {
+	if name, ok := messageKinds[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageKind(%d)", int(k))
+}
+
+// EndStatus is how Listen's reading of the stream ended.
+type EndStatus int32
+
+const (
+	NotEnded           EndStatus = iota // Listen is running, or has not been started.
+	EndClean                            // The stream ended after a whole message.
+	EndTrailingGarbage                  // The stream ended on frames which did not decode.
+	EndTruncated                        // The stream ended part way through a message.
+	EndBadFrames                        // MaxConsecutiveDecodeErrors bad frames were read in a row.
+	EndFailed                           // The stream could not be opened, or read.
+	EndClosed                           // Close was called.
+	EndHTTPStatus                       // The firehose answered with a status other than 2xx.
+)
+
+// endStatuses names each EndStatus.
+var endStatuses = map[EndStatus]string{
+	NotEnded:           "not ended",
+	EndClean:           "clean",
+	EndTrailingGarbage: "trailing garbage",
+	EndTruncated:       "truncated",
+	EndBadFrames:       "bad frames",
+	EndFailed:          "failed",
+	EndClosed:          "closed",
+	EndHTTPStatus:      "http status",
+}
+
+func (e EndStatus) String() string {
+	if name, ok := endStatuses[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("EndStatus(%d)", int(e))
 }
 
 // RisMessage is a single ris_message json message from the ris firehose.
@@ -60,42 +336,255 @@ type RisMessage struct {
 
 // RisMessageData is the BGP oriented content of the single RisMessage message type.
 type RisMessageData struct {
-	Timestamp     float64       `json:"timestamp"`
-	Peer          string        `json:"peer"`
-	PeerASN       string        `json:"peer_asn,omitempty"`
-	ID            string        `json:"id"`
-	Host          string        `json:"host"`
-	Type          string        `json:"type"`
-	Path          []interface{} `json:"path"`
-	DigestedPath  []int32
-	Community     [][]int32          `json:"community"`
-	Origin        string             `json:"origin"`
-	Announcements []*RisAnnouncement `json:"announcements"`
-	Raw           string             `json:"raw"`
+	Timestamp      float64       `json:"timestamp"`
+	Peer           string        `json:"peer"`
+	PeerASN        string        `json:"peer_asn,omitempty"`
+	ID             string        `json:"id"`
+	Host           string        `json:"host"`
+	Type           string        `json:"type"`
+	Path           []interface{} `json:"path"`
+	DigestedPath   []uint32
+	OriginASN      uint32             // The last ASN of DigestedPath, 0 without a path.
+	OriginSet      []uint32           // The AS_SET ending the path, when the origin is a set.
+	Community      [][]uint32         `json:"community"`
+	LargeCommunity [][3]uint32        `json:"large_community"` // RFC 8092 global:local1:local2 communities.
+	Origin         string             `json:"origin"`
+	Announcements  []*RisAnnouncement `json:"announcements"`
+	Withdrawals    []string           `json:"withdrawals"`
+	Raw            string             `json:"raw"`
+}
+
+// RawBytes returns the BGP message carried, hex encoded, in Raw.
+func (r *RisMessageData) RawBytes() ([]byte, error) {
+	b, err := hex.DecodeString(r.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw message(%v): %v", r.ID, err)
+	}
+	return b, nil
+}
+
+// Time returns the message Timestamp, seconds since the epoch, as a time.Time.
+func (r *RisMessageData) Time() time.Time {
+	sec, frac := math.Modf(r.Timestamp)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// Kind returns which of announcements and withdrawals the message carries.
+// A message whose Type is set to other than UPDATE is KindOther.
+func (r *RisMessageData) Kind() MessageKind {
+	if r.Type != "" && r.Type != "UPDATE" {
+		return KindOther
+	}
+	switch announces, withdraws := len(r.Announcements) > 0, len(r.Withdrawals) > 0; {
+	case announces && withdraws:
+		return KindBoth
+	case announces:
+		return KindAnnouncement
+	case withdraws:
+		return KindWithdrawal
+	}
+	return KindOther
+}
+
+// PrefixCount returns the number of distinct prefixes the message announces
+// and withdraws. A prefix both withdrawn and announced counts twice.
+func (r *RisMessageData) PrefixCount() int {
+	announced := map[string]bool{}
+	for _, anns := range r.Announcements {
+		for _, p := range anns.Prefixes {
+			announced[p] = true
+		}
+	}
+	withdrawn := map[string]bool{}
+	for _, p := range r.Withdrawals {
+		withdrawn[p] = true
+	}
+	return len(announced) + len(withdrawn)
+}
+
+// String renders the message on one line, for logs: the time, to the
+// millisecond, peer/peer ASN, type, first announced prefix (or withdrawn
+// prefix), origin ASN and path.
+func (r RisMessage) String() string {
+	if r.Data == nil {
+		return r.Type
+	}
+	return r.Data.String()
+}
+
+// String renders the message data on one line, see RisMessage.String.
+func (r *RisMessageData) String() string {
+	if r == nil {
+		return "<nil>"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v/AS%v %v", r.Time().UTC().Round(time.Millisecond).Format(time.RFC3339Nano), r.Peer, r.PeerASN, r.Type)
+	switch {
+	case len(r.Announcements) > 0 && len(r.Announcements[0].Prefixes) > 0:
+		fmt.Fprintf(&b, " prefix=%v", r.Announcements[0].Prefixes[0])
+	case len(r.Withdrawals) > 0:
+		fmt.Fprintf(&b, " withdrawn=%v", r.Withdrawals[0])
+	}
+	if r.OriginASN != 0 {
+		fmt.Fprintf(&b, " origin=AS%d", r.OriginASN)
+	}
+	if len(r.Path) > 0 {
+		b.WriteString(" path=")
+		for i, p := range r.Path {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			// An AS_SET is shown in braces, as in BGP tooling.
+			if set, ok := p.([]interface{}); ok {
+				b.WriteByte('{')
+				for j, e := range set {
+					if j > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprint(&b, e)
+				}
+				b.WriteByte('}')
+				continue
+			}
+			fmt.Fprint(&b, p)
+		}
+	}
+	return b.String()
+}
+
+// PathString renders DigestedPath as an AS path, the ASNs space separated,
+// as in 24482 6453 174 513 513 12654. An origin AS_SET is shown in braces,
+// {64500,64501}; a set within the path is not kept apart by digestPath, its
+// members are shown as sequence.
+func (r *RisMessageData) PathString() string {
+	return r.FormatPath(false)
+}
+
+// FormatPath renders DigestedPath as PathString does, with the ASNs in asdot
+// if asdot is set.
+func (r *RisMessageData) FormatPath(asdot bool) string {
+	set := len(r.DigestedPath) - len(r.OriginSet)
+	var b strings.Builder
+	for i, asn := range r.DigestedPath {
+		switch {
+		case i == set && i > 0:
+			b.WriteString(" {")
+		case i == set:
+			b.WriteByte('{')
+		case i > set:
+			b.WriteByte(',')
+		case i > 0:
+			b.WriteByte(' ')
+		}
+		b.WriteString(FormatASN(asn, asdot))
+	}
+	if len(r.OriginSet) > 0 {
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// Key returns a stable identity for the message, usable as a map key: the ID
+// RIS Live gives each message or, without one, the announced and withdrawn
+// prefixes, in sorted order, with the origin ASN and digested path.
+func (r *RisMessageData) Key() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	var announced []string
+	for _, anns := range r.Announcements {
+		announced = append(announced, anns.Prefixes...)
+	}
+	sort.Strings(announced)
+	withdrawn := append([]string{}, r.Withdrawals...)
+	sort.Strings(withdrawn)
+	return fmt.Sprintf("announce %v withdraw %v origin %v path %v",
+		strings.Join(announced, ","), strings.Join(withdrawn, ","), r.OriginASN, r.DigestedPath)
+}
+
+// Equal reports whether b is the same message, every field equal. An empty
+// list equals an unset one, as a message decoded with "withdrawals": []
+// carries the same as one without. Two nil messages are equal.
+func (r *RisMessageData) Equal(b *RisMessageData) bool {
+	if r == nil || b == nil {
+		return r == b
+	}
+	return r.Timestamp == b.Timestamp && r.Peer == b.Peer && r.PeerASN == b.PeerASN &&
+		r.ID == b.ID && r.Host == b.Host && r.Type == b.Type &&
+		slices.EqualFunc(r.Path, b.Path, func(x, y interface{}) bool { return reflect.DeepEqual(x, y) }) &&
+		slices.Equal(r.DigestedPath, b.DigestedPath) && r.OriginASN == b.OriginASN &&
+		slices.Equal(r.OriginSet, b.OriginSet) &&
+		slices.EqualFunc(r.Community, b.Community, slices.Equal[[]uint32]) &&
+		slices.Equal(r.LargeCommunity, b.LargeCommunity) && r.Origin == b.Origin &&
+		slices.EqualFunc(r.Announcements, b.Announcements, equalAnnouncements) &&
+		slices.Equal(r.Withdrawals, b.Withdrawals) && r.Raw == b.Raw
+}
+
+// equalAnnouncements reports whether a and b announce the same prefixes
+// through the same next hop.
+func equalAnnouncements(a, b *RisAnnouncement) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.NextHop == b.NextHop && slices.Equal(a.Prefixes, b.Prefixes)
+}
+
+// MatchASPathRegex matches the path, as PathString writes it, against re.
+func (r *RisMessageData) MatchASPathRegex(re *regexp.Regexp) bool {
+	return re.MatchString(r.PathString())
 }
 
 // MatchASPath matches a fragment of an aspath with an as-path in an announcement.
-func (r *RisMessageData) MatchASPath(c []int32) bool {
+func (r *RisMessageData) MatchASPath(c []uint32) bool {
 	cLen := len(c)
 	// If the announcement's aspath is shorter than the candidate, no match is possible.
 	if len(r.DigestedPath) < cLen {
 		return false
 	}
-	// Slide the candidate along the announcement path checking for a match.
-	for i := 0; i+cLen < len(r.DigestedPath); i++ {
-		frag := r.DigestedPath[i:(i + cLen)]
-		if reflect.DeepEqual(frag, c) {
+	// Slide the candidate along the announcement path checking for a match,
+	// up to and including the candidate sitting at the very end of the path.
+	for i := 0; i+cLen <= len(r.DigestedPath); i++ {
+		if equalPath(r.DigestedPath[i:(i+cLen)], c) {
 			return true
 		}
 	}
 	return false
 }
 
+// equalPath compares two equal length path fragments element by element.
+func equalPath(a, b []uint32) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // InvalidTransitAS matches a set of ASN in the RisMessageData.Path, returning true if
 // there is a match in the Path. This should be used to alert on invalid paths seen, paths
 // which do not match intent/expectations of the announcing ASN.
-func (r *RisMessageData) InvalidTransitAS(c map[int32]bool) bool {
-	for _, p := range r.DigestedPath {
+func (r *RisMessageData) InvalidTransitAS(c map[uint32]bool) bool {
+	return r.InvalidTransitASSkip(c, false, false)
+}
+
+// InvalidTransitASSkip is InvalidTransitAS checking only the transit hops: with
+// skipPeer the collector peer's ASN at the start of the path is ignored, with
+// skipOrigin the origin ASN at the end. Prepends of a skipped ASN are skipped
+// with it, so a peer or origin is never counted as transiting itself.
+func (r *RisMessageData) InvalidTransitASSkip(c map[uint32]bool, skipPeer, skipOrigin bool) bool {
+	path := r.DigestedPath
+	if len(path) == 0 {
+		return false
+	}
+	peer, origin := path[0], path[len(path)-1]
+	for skipPeer && len(path) > 0 && path[0] == peer {
+		path = path[1:]
+	}
+	for skipOrigin && len(path) > 0 && path[len(path)-1] == origin {
+		path = path[:len(path)-1]
+	}
+	for _, p := range path {
 		if c[p] {
 			return true
 		}
@@ -103,28 +592,184 @@ func (r *RisMessageData) InvalidTransitAS(c map[int32]bool) bool {
 	return false
 }
 
-// CheckOrigins checks the message's bgp Origin Attribute matches a list of possible origins.
+// CheckOrigins checks the message's OriginASN matches a list of possible origin
+// ASNs, plain or asdot. The bgp Origin Attribute, Origin, is not an ASN and is
+// not checked.
 func (r *RisMessageData) CheckOrigins(origins []string) bool {
+	if r.OriginASN == 0 {
+		return false
+	}
 	for _, origin := range origins {
-		if r.Origin == origin {
+		if asn, err := ParseASN(origin); err == nil && asn == r.OriginASN {
 			return true
 		}
 	}
 	return false
 }
 
+// CheckOriginASN checks the message's origin is one of the set of origin ASNs.
+// When the path ends in an AS_SET, any member of the set is a match.
+func (r *RisMessageData) CheckOriginASN(origins map[uint32]bool) bool {
+	if len(r.OriginSet) > 0 {
+		for _, asn := range r.OriginSet {
+			if origins[asn] {
+				return true
+			}
+		}
+		return false
+	}
+	return r.OriginASN != 0 && origins[r.OriginASN]
+}
+
+// CheckLargeCommunities checks the message carries any one of the large
+// communities. Standard communities are not compared.
+func (r *RisMessageData) CheckLargeCommunities(lcs [][3]uint32) bool {
+	for _, have := range r.LargeCommunity {
+		for _, want := range lcs {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnexpectedUpstream checks the upstream of the message's origin, the ASN
+// before the origin and any prepends of it in the path, against the policy of
+// upstreams expected for that origin. The upstream is returned if the policy
+// does not allow it. An origin without a policy, an AS_SET origin, or an
+// origin seen with no upstream, directly from a collector peer, is never a
+// violation.
+func (r *RisMessageData) UnexpectedUpstream(policy map[uint32]map[uint32]bool) (uint32, bool) {
+	allowed, ok := policy[r.OriginASN]
+	if !ok || r.OriginASN == 0 || len(r.OriginSet) > 0 {
+		return 0, false
+	}
+	path := r.DigestedPath
+	for len(path) > 0 && path[len(path)-1] == r.OriginASN {
+		path = path[:len(path)-1]
+	}
+	if len(path) == 0 {
+		return 0, false
+	}
+	upstream := path[len(path)-1]
+	if allowed[upstream] {
+		return 0, false
+	}
+	return upstream, true
+}
+
+// Malformed returns the reason an UPDATE announcing prefixes lacks an
+// attribute every announcement carries: the origin, the AS path, or a next
+// hop. A withdrawal alone carries no attributes and is never malformed.
+func (r *RisMessageData) Malformed() (string, bool) {
+	if r.Type != "UPDATE" || len(r.Announcements) == 0 {
+		return "", false
+	}
+	if r.Origin == "" {
+		return "no origin attribute", true
+	}
+	if len(r.DigestedPath) == 0 {
+		return "no AS path", true
+	}
+	for _, anns := range r.Announcements {
+		if anns.NextHop == "" {
+			return fmt.Sprintf("no next hop for %v", anns.Prefixes), true
+		}
+	}
+	return "", false
+}
+
 // RisAnnouncement is a struct which holds the prefixes contained in the single Bgp Message.
 type RisAnnouncement struct {
 	NextHop  string   `json:"next_hop"`
 	Prefixes []string `json:"prefixes"`
 }
 
+// Route is one prefix of an announcement: the prefix, announced by OriginASN
+// via NextHop along Path.
+type Route struct {
+	Prefix    string
+	NextHop   string
+	LinkLocal string // The IPv6 link-local next-hop announced beside NextHop, if any.
+	OriginASN uint32
+	Path      []uint32 // The message's DigestedPath, shared by its routes, not to be modified.
+}
+
+// Routes flattens the announcements to a Route per prefix, in the order the
+// message lists them. A prefix announced via two next-hops is two routes,
+// except an IPv6 link-local next-hop, which RIS Live lists as an announcement
+// of its own: it is the LinkLocal of the route via the global next-hop. One
+// without a global next-hop for the prefix is a route of its own, after the
+// rest.
+func (r *RisMessageData) Routes() []Route {
+	var routes []Route
+	global := map[string][]int{} // Prefix to its routes, by index.
+	for _, anns := range r.Announcements {
+		if isLinkLocal(anns.NextHop) {
+			continue
+		}
+		for _, p := range anns.Prefixes {
+			global[p] = append(global[p], len(routes))
+			routes = append(routes, Route{Prefix: p, NextHop: anns.NextHop, OriginASN: r.OriginASN, Path: r.DigestedPath})
+		}
+	}
+	for _, anns := range r.Announcements {
+		if !isLinkLocal(anns.NextHop) {
+			continue
+		}
+		for _, p := range anns.Prefixes {
+			paired := false
+			for _, i := range global[p] {
+				if routes[i].LinkLocal == "" {
+					routes[i].LinkLocal = anns.NextHop
+					paired = true
+					break
+				}
+			}
+			if !paired {
+				routes = append(routes, Route{Prefix: p, NextHop: anns.NextHop, OriginASN: r.OriginASN, Path: r.DigestedPath})
+			}
+		}
+	}
+	return routes
+}
+
+// isLinkLocal reports whether the next-hop is an IPv6 link-local, fe80::/10,
+// address.
+func isLinkLocal(nextHop string) bool {
+	ip := net.ParseIP(nextHop)
+	return ip != nil && ip.To4() == nil && ip.IsLinkLocalUnicast()
+}
+
 // MatchPrefix matches a list of prefixes against an announcement's included prefixes.
-// Is an exact match, does not implement any super/subnet matching conditions.
+// Is an exact match, does not implement any super/subnet matching conditions,
+// see MatchPrefixCovering. Prefixes are compared in canonical form, so
+// 192.168.000.0/16 matches 192.168.0.0/16 and 2001:DB8::/32 2001:db8::/32.
 func (r *RisAnnouncement) MatchPrefix(cs []string) bool {
 	for _, c := range cs {
+		c = canonicalPrefix(c)
+		for _, p := range r.Prefixes {
+			if c == canonicalPrefix(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchPrefixCovering matches a list of prefixes against an announcement's
+// included prefixes as RisLive.CheckPrefix matches the filter: a prefix
+// matches an announced prefix whose address it holds, so itself or a
+// more-specific. Prefixes which do not parse never match.
+func (r *RisAnnouncement) MatchPrefixCovering(cs []string) bool {
+	for _, c := range cs {
+		_, cn, err := parsePrefix(c)
+		if err != nil {
+			continue
+		}
 		for _, p := range r.Prefixes {
-			if c == p {
+			if ip, _, err := parsePrefix(p); err == nil && cn.Contains(ip) {
 				return true
 			}
 		}
@@ -132,8 +777,40 @@ func (r *RisAnnouncement) MatchPrefix(cs []string) bool {
 	return false
 }
 
-// NewRisFilter creates a new RisFilter struct.
-func NewRisFilter(aspath []int32, transits map[int32]bool, origins, prefix []string) *RisFilter {
+// parsePrefix is net.ParseCIDR, also accepting an IPv4 address written with
+// zero padded octets, as in 192.168.000.0/16, which net.ParseCIDR refuses.
+func parsePrefix(s string) (net.IP, *net.IPNet, error) {
+	addr, length, ok := strings.Cut(s, "/")
+	if ok && strings.Contains(addr, ".") && !strings.Contains(addr, ":") {
+		octets := strings.Split(addr, ".")
+		for i, o := range octets {
+			if trimmed := strings.TrimLeft(o, "0"); len(o) > 1 {
+				if trimmed == "" {
+					trimmed = "0"
+				}
+				octets[i] = trimmed
+			}
+		}
+		s = strings.Join(octets, ".") + "/" + length
+	}
+	return net.ParseCIDR(s)
+}
+
+// canonicalPrefix returns the prefix as Go writes it, the address unpadded
+// and lower case, its host bits left as written. A prefix which does not
+// parse is returned unchanged.
+func canonicalPrefix(s string) string {
+	ip, n, err := parsePrefix(s)
+	if err != nil {
+		return s
+	}
+	ones, _ := n.Mask.Size()
+	return fmt.Sprintf("%v/%d", ip, ones)
+}
+
+// NewRisFilter creates a new RisFilter struct. The contents are not checked,
+// call Validate on the result to catch malformed prefixes and origins.
+func NewRisFilter(aspath []uint32, transits map[uint32]bool, origins, prefix []string) *RisFilter {
 	return &RisFilter{
 		ASPath:           aspath,
 		InvalidTransitAS: transits,
@@ -142,9 +819,21 @@ func NewRisFilter(aspath []int32, transits map[int32]bool, origins, prefix []str
 	}
 }
 
+// Option configures a RisLive created by NewRisLive.
+type Option func(*RisLive)
+
+// CaptureTo makes Listen write the stream, verbatim as read, to w while
+// decoding it, so it can be replayed later through File. A websocket stream
+// is written a frame per line. An error writing to w ends Listen.
+func CaptureTo(w io.Writer) Option {
+	return func(r *RisLive) {
+		r.capture = w
+	}
+}
+
 // NewRisLive creates a new RisLive struct.
-func NewRisLive(url, file, ua *string, rf *RisFilter, buffer *int) *RisLive {
-	return &RisLive{
+func NewRisLive(url, file, ua *string, rf *RisFilter, buffer *int, opts ...Option) *RisLive {
+	r := &RisLive{
 		URL:     url,
 		File:    file,
 		UA:      ua,
@@ -152,12 +841,26 @@ func NewRisLive(url, file, ua *string, rf *RisFilter, buffer *int) *RisLive {
 		Records: 0,
 		Chan:    make(chan (RisMessage), *buffer),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.prepared = rf.compile(r.log())
+	return r
 }
 
 func digestPath(m *RisMessageData) error {
-	m.DigestedPath = []int32{}
+	// Size the digest for the whole path up front, AS_SET members included,
+	// so it is allocated once per message.
+	size := len(m.Path)
+	for _, p := range m.Path {
+		if set, ok := p.([]interface{}); ok {
+			size += len(set) - 1
+		}
+	}
+	m.DigestedPath = make([]uint32, 0, size)
+	m.OriginSet = nil
 	for _, p := range m.Path {
-		var o int32
+		var o uint32
 		switch v := p.(type) {
 		// exit loop since both of these can be type cast directly
 		// I would log this but no one added a logging package!!!!
@@ -165,155 +868,798 @@ func digestPath(m *RisMessageData) error {
 		// without this separation the compiler considers v an interface
 		// :(
 		case int:
-			o = int32(v)
+			asn, ok := pathASN(float64(v))
+			if !ok {
+				return fmt.Errorf("failed to decode path element: %v is not an ASN", v)
+			}
+			o = asn
 		case float64:
-			o = int32(v)
-		case []interface{}:
-			// Convert p to a slice of interface.
-			listSlice, ok := p.([]interface{})
+			asn, ok := pathASN(v)
 			if !ok {
-				return fmt.Errorf("failed to cast path element: %v as %v", p, reflect.TypeOf(p))
+				return fmt.Errorf("failed to decode path element: %v is not an ASN", v)
 			}
-			for _, e := range listSlice {
+			o = asn
+		case []interface{}:
+			start := len(m.DigestedPath)
+			for _, e := range v {
 				// I would move this down to the outside of the function but that's difficult
 				// and probably not efficient, assuming an input of mostly ints or float64's
-				m.DigestedPath = append(m.DigestedPath, int32(e.(float64)))
+				asn, ok := pathASN(e.(float64))
+				if !ok {
+					return fmt.Errorf("failed to decode path element: %v is not an ASN", e)
+				}
+				m.DigestedPath = append(m.DigestedPath, asn)
 			}
+			// Only a set which ends the path is kept, as the origin set.
+			m.OriginSet = m.DigestedPath[start:len(m.DigestedPath):len(m.DigestedPath)]
 			// not the cleanest but there's no sane way to clean this up otherwise
 			continue
 		default:
 			return fmt.Errorf("failed to decode path element: %v as %v", p, reflect.TypeOf(p))
 		}
 		m.DigestedPath = append(m.DigestedPath, o)
-
+		m.OriginSet = nil
+	}
+	m.OriginASN = 0
+	if len(m.DigestedPath) > 0 {
+		m.OriginASN = m.DigestedPath[len(m.DigestedPath)-1]
 	}
 	return nil
 }
 
+// pathASN converts a decoded path element to an ASN, rejecting a number no
+// 32-bit ASN could be rather than wrapping it.
+func pathASN(v float64) (uint32, bool) {
+	if v < 0 || v > math.MaxUint32 || v != math.Trunc(v) {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// DefaultUserAgent is the User-Agent sent when the RisLive UA is not set, the
+// client name, its Version and the Go version, so RIS Live can tell which
+// client versions are connecting.
+func DefaultUserAgent() string {
+	return fmt.Sprintf("%v/%v (%v)", clientName, Version, runtime.Version())
+}
+
+// userAgent returns the UA, or DefaultUserAgent if the UA is not set.
+func (r *RisLive) userAgent() string {
+	if r.UA != nil && *r.UA != "" {
+		return *r.UA
+	}
+	return DefaultUserAgent()
+}
+
 // Listen connects to the RisLive service, parses the stream into structs
 // and makes the data stream available for analysis through the RisLive.Chan channel.
+//
+// Listen never exits the process: on an error the error is logged and Listen
+// returns. Chan and every subscriber are closed whenever Listen returns, at
+// the end of the stream or on an error, so consumers ranging over them finish.
+// How the stream ended is then reported by End.
+//
+// With MaxConsecutiveDecodeErrors set, a remote stream sending more bad
+// frames than that in a row is closed and connected again, paced by
+// ReconnectBackoff; a file is given up on instead. A firehose answering 429,
+// rate limiting, or 5xx is also connected to again, paced the same way. Any
+// other status, 404 or 403 say, is a bad URL or client and is given up on.
 func (r *RisLive) Listen() {
-	var body io.ReadCloser
-	// If there's a file provided read/use that, else open the remote
-	// socket and consume the firehose.
-	switch len(*r.File) == 0 {
-	case true:
-		log.Infof("Reading from the firehose...")
-		client := &http.Client{}
+	defer r.closeOutputs()
+	done := r.stopped()
+	start := &startState{started: r.StartOffset <= 0 && r.StartTimestamp <= 0}
+	for {
+		r.setEnd(NotEnded)
+		body, end := r.open()
+		switch end {
+		case NotEnded:
+			if !r.reading(body) {
+				body.Close()
+				r.setEnd(EndClosed)
+				return
+			}
+			end = r.decode(body, done, start)
+			body.Close()
+		case EndFailed:
+			r.setEnd(EndFailed)
+			return
+		}
+		r.setEnd(end)
+		// Only a remote stream is read again, a file would end the same way.
+		if len(*r.File) > 0 || !r.retry(end) {
+			return
+		}
+		wait := r.reconnectBackoff().Next()
+		r.log().Info("reconnecting", "wait", wait, "records", atomic.LoadInt64(&r.Records))
+		select {
+		case <-done:
+			r.setEnd(EndClosed)
+			return
+		case <-r.clk().After(wait):
+		}
+		atomic.AddInt64(&r.reconnects, 1)
+	}
+}
+
+// retry reports whether a remote stream which ended so is connected to again.
+func (r *RisLive) retry(end EndStatus) bool {
+	switch end {
+	case EndBadFrames:
+		return true
+	case EndHTTPStatus:
+		return r.lastStatusError().Temporary()
+	}
+	return false
+}
+
+// End returns how Listen's reading of the stream ended, so replay tooling can
+// tell a file decoded to its end from one ending in garbage or cut short.
+// While Listen runs, and before it is started, it is NotEnded.
+func (r *RisLive) End() EndStatus {
+	return EndStatus(atomic.LoadInt32(&r.end))
+}
+
+func (r *RisLive) setEnd(e EndStatus) {
+	atomic.StoreInt32(&r.end, int32(e))
+}
+
+// ListenContext is Listen, stopped as by Close when ctx is done.
+func (r *RisLive) ListenContext(ctx context.Context) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Close()
+		case <-stop:
+		}
+	}()
+	r.Listen()
+}
+
+// open opens the stream to read: the file if there is one, else the remote
+// websocket or firehose. A failure is logged.
+func (r *RisLive) open() (io.ReadCloser, EndStatus) {
+	switch {
+	case len(*r.File) == 0 && r.webSocket:
+		r.log().Info("reading from the websocket")
+		ws, err := r.dialWebSocket()
+		if err != nil {
+			r.log().Error("failed to open the websocket", "error", err)
+			return nil, EndFailed
+		}
+		return ws, NotEnded
+	case len(*r.File) == 0:
+		r.log().Info("reading from the firehose", "url", *r.URL)
+		client := r.httpClient()
 		req, err := http.NewRequest("GET", *r.URL, nil)
 		if err != nil {
-			log.Fatalf("failed to create new request to ris-live: %v\n", err)
+			r.log().Error("failed to create new request to ris-live", "url", *r.URL, "error", err)
+			return nil, EndFailed
 		}
-		req.Header.Set("User-Agent", *r.UA)
+		req.Header.Set("User-Agent", r.userAgent())
 		resp, err := client.Do(req)
 		if err != nil {
-			log.Errorf("failed to open the http client for action: %v", err)
-			return
+			r.log().Error("failed to open the http client for action", "url", *r.URL, "error", err)
+			return nil, EndFailed
 		}
-		defer resp.Body.Close()
-		body = resp.Body
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err := newStatusError(resp)
+			r.lastHTTPError.Store(err)
+			r.log().Error("firehose answered with an error", "url", *r.URL, "error", err)
+			return nil, EndHTTPStatus
+		}
+		return resp.Body, NotEnded
 	default:
-		log.Infof("Heres a file read")
+		r.log().Info("reading from a file", "file", *r.File, "tail", r.Tail)
+		if r.Tail {
+			f, err := os.Open(*r.File)
+			if err != nil {
+				r.log().Error("failed to open risFile", "file", *r.File, "error", err)
+				return nil, EndFailed
+			}
+			return &tailReader{f: f, done: r.stopped(), clock: r.clk()}, NotEnded
+		}
 		fd, err := ioutil.ReadFile(*r.File)
 		if err != nil {
-			log.Fatalf("failed to read risFile(%v): %v\n", *r.File, err)
+			r.log().Error("failed to read risFile", "file", *r.File, "error", err)
+			return nil, EndFailed
 		}
-		body = ioutil.NopCloser(bytes.NewReader(fd))
-		log.Infof("Finished Reading File")
+		return ioutil.NopCloser(bytes.NewReader(fd)), NotEnded
 	}
+}
 
-	dec := json.NewDecoder(body)
+// statusSnippet is how much of an error response body a StatusError keeps.
+const statusSnippet = 512
 
-	// Remove log file once done.
-	f, err := os.Create("/tmp/log")
-	if err != nil {
-		log.Fatalf("failed to open log file: %v", err)
+// StatusError is a firehose response with a status other than 2xx, as when
+// RIS Live is rate limiting, 429, or down for maintenance, 503.
+type StatusError struct {
+	Code   int    // The status code, 503.
+	Status string // The status line, "503 Service Unavailable".
+	Body   string // The start of the response body, which usually says why.
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ris live returned %v: %q", e.Status, e.Body)
+}
+
+// Temporary reports whether the request may succeed if made again: rate
+// limited, 429, or a server error, 5xx.
+func (e *StatusError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// lastStatusError returns the last non-2xx firehose response, nil if there
+// has been none.
+func (r *RisLive) lastStatusError() *StatusError {
+	err, _ := r.lastHTTPError.Load().(*StatusError)
+	return err
+}
+
+// newStatusError reads the start of the body of resp, and closes it.
+func newStatusError(resp *http.Response) *StatusError {
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, statusSnippet))
+	return &StatusError{
+		Code:   resp.StatusCode,
+		Status: resp.Status,
+		Body:   strings.TrimSpace(string(b)),
+	}
+}
+
+// startState is how far Listen has read past StartOffset and StartTimestamp,
+// kept across the streams it reconnects to.
+type startState struct {
+	skipped int  // Messages read past so far.
+	started bool // Both were passed, every message is delivered.
+}
+
+// decode reads the stream, delivering each message, until it ends, Close is
+// called, or it fails, returning how it ended.
+func (r *RisLive) decode(body io.Reader, done <-chan struct{}, start *startState) EndStatus {
+	var input io.Reader = &countingReader{r: body, n: &r.bytesRead}
+	if r.capture != nil {
+		input = io.TeeReader(input, r.capture)
 	}
-	defer f.Close()
+	dec, limit := r.newDecoder(input)
+	replay := len(*r.File) > 0 && r.ReplaySpeed > 0
+	var lastTS float64
+	badFrames := 0
 	for {
-		var rm RisMessage
-		err := dec.Decode(&rm)
+		var frame rawFrame
+		limit.next(dec)
+		err := dec.Decode(&frame)
+		select {
+		case <-done:
+			// Closed, the error is from the stream closing under the decoder.
+			return EndClosed
+		default:
+		}
 		switch {
+		case err == io.ErrUnexpectedEOF:
+			// The stream ended part way through a message, a capture cut short.
+			r.log().Error("input ended in a truncated message", "records", atomic.LoadInt64(&r.Records))
+			return EndTruncated
 		case err != nil && err != io.EOF:
-			_, err := f.WriteString(fmt.Sprintf("bad json content: %+v\n", rm.Data))
-			if err != nil {
-				log.Fatalf("failed to write to log: %v", err)
+			r.log().Error("bad json content", "records", atomic.LoadInt64(&r.Records), "error", err)
+			switch err.(type) {
+			case *json.UnmarshalTypeError:
+				// The frame was read past, it was not an object.
+			case *json.SyntaxError, *messageTooLargeError:
+				// The decoder returns the same error from here on, skip the
+				// rest of the bad message's line and decode afresh after it.
+				input = resync(dec, input)
+				dec, limit = r.newDecoder(input)
+			default:
+				r.log().Error("failed to read the stream", "records", atomic.LoadInt64(&r.Records), "error", err)
+				return EndFailed
+			}
+			badFrames++
+			if r.MaxConsecutiveDecodeErrors > 0 && badFrames > r.MaxConsecutiveDecodeErrors {
+				// Not RIS Live JSON, perhaps a proxy's error page, don't spin on it.
+				r.log().Error("too many bad frames in a row", "frames", badFrames, "records", atomic.LoadInt64(&r.Records))
+				return EndBadFrames
 			}
 			continue
+		case err == io.EOF && badFrames > 0:
+			return EndTrailingGarbage
 		case err == io.EOF:
-			close(r.Chan)
-			return
+			return EndClean
+		}
+		badFrames = 0
+		rm, ok := r.route(frame)
+		if !ok {
+			continue
+		}
+		if !start.started {
+			if start.skipped < r.StartOffset || rm.Data.Timestamp < r.StartTimestamp {
+				start.skipped++
+				continue
+			}
+			start.started = true
+		}
+		if !r.IncludeRaw {
+			rm.Data.Raw = ""
 		}
 		err = digestPath(rm.Data)
 		if err != nil {
-			fmt.Printf("decoding the message data path(%v) failed: %v\n", rm.Data.Path, err)
-			log.Infof("decoding the message data path(%v) failed: %v", rm.Data.Path, err)
+			r.log().Error("decoding the message data path failed", "id", rm.Data.ID, "peer", rm.Data.Peer, "path", rm.Data.Path, "error", err)
+		}
+		// Replaying a file, hold each message back by its gap from the one before.
+		if replay && lastTS > 0 && rm.Data.Timestamp > lastTS {
+			select {
+			case <-r.clk().After(time.Duration((rm.Data.Timestamp - lastTS) / r.ReplaySpeed * float64(time.Second))):
+			case <-done:
+				return EndClosed
+			}
+		}
+		lastTS = rm.Data.Timestamp
+		atomic.AddInt64(&r.Records, 1)
+		atomic.StoreInt64(&r.lastMessageTime, r.clk().Now().UnixNano())
+		r.reconnectBackoff().Reset()
+		if r.counter != nil {
+			r.counter.Observe(rm.Data)
+		}
+		r.deliver(rm, done)
+	}
+}
+
+// defaultReconnectBackoff paces reconnections when ReconnectBackoff is not set.
+func defaultReconnectBackoff() *Backoff {
+	return NewBackoff(time.Second, time.Minute, 0.2)
+}
+
+// reconnectBackoff returns ReconnectBackoff, setting the default if unset.
+// Only Listen's goroutine uses it.
+func (r *RisLive) reconnectBackoff() *Backoff {
+	if r.ReconnectBackoff == nil {
+		r.ReconnectBackoff = defaultReconnectBackoff()
+	}
+	return r.ReconnectBackoff
+}
+
+// resync returns the input from the line after the one dec failed on,
+// messages being newline delimited, to decode afresh.
+func resync(dec *json.Decoder, input io.Reader) io.Reader {
+	rd := bufio.NewReader(io.MultiReader(dec.Buffered(), input))
+	// The newline ending the message before the bad one may not have been
+	// read yet, skip to the end of the first line with content on it. The
+	// line is not held, it may be an oversized message.
+	// An error here is the end of input, left for the new decoder to return.
+	content := false
+	for {
+		line, err := rd.ReadSlice('\n')
+		content = content || len(bytes.TrimSpace(line)) > 0
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil || content {
+			break
+		}
+	}
+	return rd
+}
+
+// DefaultMaxMessageSize is the MaxMessageSize used when it is 0, far larger
+// than any RIS Live message.
+const DefaultMaxMessageSize = 1 << 20
+
+// newDecoder returns a decoder of input, reading messages no larger than
+// MaxMessageSize through the limiter returned.
+func (r *RisLive) newDecoder(input io.Reader) (*json.Decoder, *messageLimiter) {
+	max := int64(r.MaxMessageSize)
+	if max == 0 {
+		max = DefaultMaxMessageSize
+	}
+	l := &messageLimiter{r: input, max: max}
+	return json.NewDecoder(l), l
+}
+
+// messageTooLargeError is the read error of a message over the limit.
+type messageTooLargeError struct {
+	max int64
+}
+
+func (e *messageTooLargeError) Error() string {
+	return fmt.Sprintf("message larger than %d bytes", e.max)
+}
+
+// messageLimiter fails a read once the message being decoded, from the start
+// of the bytes the decoder holds, would be over max bytes.
+type messageLimiter struct {
+	r     io.Reader
+	max   int64 // Negative for no limit.
+	read  int64 // Bytes read.
+	start int64 // Where the message being decoded starts.
+}
+
+// next marks the start of the next message dec decodes.
+func (l *messageLimiter) next(dec *json.Decoder) {
+	if b, ok := dec.Buffered().(*bytes.Reader); ok {
+		l.start = l.read - int64(b.Len())
+		return
+	}
+	l.start = l.read
+}
+
+func (l *messageLimiter) Read(p []byte) (int, error) {
+	if l.max >= 0 {
+		left := l.start + l.max - l.read
+		if left <= 0 {
+			return 0, &messageTooLargeError{max: l.max}
+		}
+		if int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// tailPoll is how often a tailed file is read again at its end.
+const tailPoll = 100 * time.Millisecond
+
+// tailReader reads a file which is being appended to, at its end waiting for
+// more rather than returning io.EOF, until done is closed.
+type tailReader struct {
+	f     *os.File
+	done  <-chan struct{}
+	clock Clock
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		case <-t.clock.After(tailPoll):
+		}
+	}
+}
+
+func (t *tailReader) Close() error {
+	return t.f.Close()
+}
+
+// countingReader adds the bytes read through it to n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// BytesRead returns the number of bytes Listen has read from the stream, the
+// firehose, websocket or file, as Records counts the messages.
+func (r *RisLive) BytesRead() int64 {
+	return atomic.LoadInt64(&r.bytesRead)
+}
+
+// Subscribe returns a channel sent every message Listen reads, independent of
+// Chan and any other subscriber, buffered as deeply as Chan. A subscriber too
+// slow to keep up blocks Listen, or with DropOnFull misses messages, counted
+// in Dropped. Subscribe before calling Listen to see the whole stream; the
+// channel is closed when Listen reaches the end of the stream. Chan is still
+// sent every message, set it to nil if only subscribers are consuming.
+func (r *RisLive) Subscribe() <-chan RisMessage {
+	c := make(chan RisMessage, cap(r.Chan))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = append(r.subs, c)
+	return c
+}
+
+// deliver sends the message to Chan, unless Chan is nil, and each subscriber.
+// Once done is closed a full channel is no longer waited on.
+func (r *RisLive) deliver(rm RisMessage, done <-chan struct{}) {
+	if r.Chan != nil {
+		r.send(r.Chan, rm, done)
+	}
+	r.mu.RLock()
+	subs := r.subs
+	r.mu.RUnlock()
+	for _, c := range subs {
+		r.send(c, rm, done)
+	}
+}
+
+// send puts the message on c, blocking until done is closed or, with
+// DropOnFull, dropping the message when c is full.
+func (r *RisLive) send(c chan RisMessage, rm RisMessage, done <-chan struct{}) {
+	if !r.DropOnFull {
+		select {
+		case c <- rm:
+			r.markHighWater(c)
+		case <-done:
+		}
+		return
+	}
+	select {
+	case c <- rm:
+		r.markHighWater(c)
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// closeOutputs closes Chan and every subscriber, the stream has ended.
+func (r *RisLive) closeOutputs() {
+	if r.Chan != nil {
+		close(r.Chan)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.subs {
+		close(c)
+	}
+}
+
+// reading records the stream Listen is reading, for Close, reporting false
+// if Close has already been called.
+func (r *RisLive) reading(body io.Closer) bool {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+	r.body = body
+	return !r.closed
+}
+
+// stopped returns the channel closed by Close.
+func (r *RisLive) stopped() <-chan struct{} {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+// Close stops Listen: the stream is closed, a send waiting on a full channel
+// is abandoned, and Listen returns, closing Chan and every subscriber. A
+// Listen started after Close returns at once. Messages already buffered in
+// Chan are kept, see Drain. Close may be called more than once.
+func (r *RisLive) Close() error {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	close(r.done)
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// Drain returns the messages left buffered in Chan, without blocking, for a
+// shutdown handler to flush once Listen has returned. Called while Listen is
+// running it returns what is buffered at the time.
+func (r *RisLive) Drain() []RisMessage {
+	var left []RisMessage
+	for {
+		select {
+		case rm, ok := <-r.Chan:
+			if !ok {
+				return left
+			}
+			left = append(left, rm)
+		default:
+			return left
 		}
-		r.Records++
-		r.Chan <- rm
 	}
 }
 
+// markHighWater raises the high-watermark to the current depth of c.
+// Only Listen sends, so there is no racing writer to compare and swap with.
+func (r *RisLive) markHighWater(c chan RisMessage) {
+	if n := int64(len(c)); n > atomic.LoadInt64(&r.highWater) {
+		atomic.StoreInt64(&r.highWater, n)
+	}
+}
+
+// HighWatermark returns the most messages seen queued in Chan, or any
+// subscriber, a guide to whether the buffer is deep enough for the consumer.
+func (r *RisLive) HighWatermark() int {
+	return int(atomic.LoadInt64(&r.highWater))
+}
+
+// Dropped returns the number of messages dropped by Listen, with DropOnFull
+// set, because Chan or a subscriber was full.
+func (r *RisLive) Dropped() int64 {
+	return atomic.LoadInt64(&r.dropped)
+}
+
+// Status is a snapshot of a running RisLive, for liveness checks: a
+// supervisor may treat no message for some time as unhealthy.
+type Status struct {
+	LastMessage   time.Time // When the last message was read, zero before the first.
+	Reconnects    int64     // Times Listen has connected to the stream again.
+	ChannelDepth  int       // Messages waiting in Chan.
+	Records       int64     // Messages read.
+	LastHTTPError string    // The last non-2xx firehose response, empty if there has been none.
+}
+
+// Status returns the current Status, it is safe to call while Listen runs.
+func (r *RisLive) Status() Status {
+	s := Status{
+		Reconnects: atomic.LoadInt64(&r.reconnects),
+		Records:    atomic.LoadInt64(&r.Records),
+	}
+	if ns := atomic.LoadInt64(&r.lastMessageTime); ns != 0 {
+		s.LastMessage = time.Unix(0, ns)
+	}
+	if err := r.lastStatusError(); err != nil {
+		s.LastHTTPError = err.Error()
+	}
+	if r.Chan != nil {
+		s.ChannelDepth = len(r.Chan)
+	}
+	return s
+}
+
 // Get collects messages from the RisLive.Chan channel and filters results prior
-// to display or handling downstream.
+// to display or handling downstream. A matching message is also published to
+// every registered Sink.
 // TODO(morrowc): Why is Get accepting a Filter? Why not just use the Filter in RisLive?
 func (r *RisLive) Get(f *RisFilter) string {
 	for rm := range r.Chan {
 		rmd := rm.Data
+		if r.DedupWindow > 0 && r.duplicate(rmd) {
+			continue
+		}
 		prefix := ""
 		// Pull a single prefix from the announcement, which may have more than one.
-		if len(rmd.Announcements) > 0 {
-			if len(rmd.Announcements[0].Prefixes) > 0 {
-				prefixes := []string{}
-				for _, a := range rmd.Announcements {
-					for _, p := range a.Prefixes {
-						prefixes = append(prefixes, p)
-					}
-					fmt.Printf("Prefixes: %v Origin: %v Path: %v\n",
-						strings.Join(prefixes, ", "),
-						rmd.DigestedPath[len(rmd.DigestedPath)-1],
-						rmd.Path)
-				}
-			}
+		if routes := rmd.Routes(); len(routes) > 0 {
+			prefix = routes[0].Prefix
 		}
-		log.Infof("Got a prefix: %v / announcement\n", prefix)
-		// TODO(morrowc): This doesn't appear to be working properly.
-		// the logic here needs to be more complicated, depending upon what's set
-		// in the filter to check. Suggest make 'checkTests' like function, evaluate
-		// so only the set filter parts matter.
-		if r.CheckASPath(rmd) && r.CheckInvalidTransitAS(rmd) &&
-			r.CheckOrigins(rmd) && r.CheckPrefix(rmd) {
-			return fmt.Sprintf("Message(%d): Peer/ASN -> %v/%v Prefix1: %v\n", r.Records, rmd.Peer, rmd.PeerASN, prefix)
+		r.log().Debug("got a prefix", "prefix", prefix, "origin", rmd.OriginASN, "peer", rmd.Peer)
+		// Every check is made against the same filter, even if SetFilter is called meanwhile.
+		pf := r.prepare()
+		if pf.matches(rmd) {
+			r.publish(rm)
+			return fmt.Sprintf("Message(%d): Peer/ASN -> %v/%v Prefix1: %v\n", atomic.LoadInt64(&r.Records), rmd.Peer, rmd.PeerASN, prefix)
 		}
 	}
 	return "Done"
 }
 
+// Matches reads every message from Chan, as Get does, and sends each
+// matching the filter on the returned channel, also publishing it to every
+// registered Sink. The filter is evaluated on Workers goroutines, for a
+// firehose one goroutine can not keep up with. With more than one worker the
+// matches are unordered, and the sinks are written concurrently so must be
+// safe for concurrent use. The channel is closed once Chan is closed and
+// every worker has finished.
+func (r *RisLive) Matches() <-chan RisMessage {
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan RisMessage, cap(r.Chan))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for rm := range r.Chan {
+				if r.DedupWindow > 0 && r.duplicate(rm.Data) {
+					continue
+				}
+				if r.prepare().matches(rm.Data) {
+					r.publish(rm)
+					out <- rm
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// SetFilter replaces the filter applied to messages by Get. It is safe to call
+// while Listen and Get are running: a message already being evaluated finishes
+// against the filter it started with, the next message sees the new filter.
+// The filter must not be modified once set, build a new RisFilter instead.
+func (r *RisLive) SetFilter(f *RisFilter) {
+	pf := f.compile(r.log())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Filter = f
+	r.prepared = pf
+}
+
+// prepare returns the compiled form of the current filter. A RisLive built
+// without NewRisLive, or whose Filter was assigned directly, has its filter
+// compiled on the first call and kept. Fields of a filter changed after it
+// is compiled are not seen, SetFilter a new one instead.
+func (r *RisLive) prepare() *preparedFilter {
+	r.mu.RLock()
+	pf := r.prepared
+	current := pf != nil && pf.filter == r.Filter
+	r.mu.RUnlock()
+	if current {
+		return pf
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prepared == nil || r.prepared.filter != r.Filter {
+		r.prepared = r.Filter.compile(r.log())
+	}
+	return r.prepared
+}
+
 // CheckASPath checks the filterable ASPath, if it's set.
 // If not set, always return true.
 func (r *RisLive) CheckASPath(rm *RisMessageData) bool {
-	if len(r.Filter.ASPath) > 0 {
-		return rm.MatchASPath(r.Filter.ASPath)
-	}
-	return true
+	return r.prepare().checkASPath(rm)
 }
 
 // CheckInvalidTransitAS checks to see if there is a marked invalid ASN in the as-path.
-// If there is no map, this check returns false: there is nothing to match, so no match.
+// If there is no map, always return true.
 func (r *RisLive) CheckInvalidTransitAS(rm *RisMessageData) bool {
-	if len(r.Filter.InvalidTransitAS) > 0 {
-		return rm.InvalidTransitAS(r.Filter.InvalidTransitAS)
-	}
-	return false
+	return r.prepare().checkInvalidTransitAS(rm)
 }
 
-// CheckOrigins checks the inbound message origin against a list of possible origins.
-// If there is no list of origins, return false, an origin must be specified in the filter.
+// CheckOrigins checks the inbound message origin ASN against a list of possible origins.
+// If there is no list of origins, always return true.
 func (r *RisLive) CheckOrigins(rm *RisMessageData) bool {
-	if len(r.Filter.Origins) > 0 {
-		return rm.CheckOrigins(r.Filter.Origins)
+	return r.prepare().checkOrigins(rm)
+}
+
+// CheckOriginASN checks the inbound message origin ASN, or any member of an
+// origin AS_SET, against the filter's OriginASNs. If not set, always return true.
+func (r *RisLive) CheckOriginASN(rm *RisMessageData) bool {
+	return r.prepare().checkOriginASN(rm)
+}
+
+// CheckOriginAttr checks the message's ORIGIN attribute, Origin, is one of the
+// filter's OriginAttr values. If not set, always return true.
+func (r *RisLive) CheckOriginAttr(rm *RisMessageData) bool {
+	return r.prepare().checkOriginAttr(rm)
+}
+
+// CheckUpdateKind checks the message carries the kind of change in the filter's
+// UpdateKind. If not set, always return true.
+func (r *RisLive) CheckUpdateKind(rm *RisMessageData) bool {
+	return r.prepare().checkUpdateKind(rm)
+}
+
+// CheckExpectedUpstreams returns the upstream of the message's origin if the
+// filter's ExpectedUpstreams policy does not allow it for that origin.
+func (r *RisLive) CheckExpectedUpstreams(rm *RisMessageData) (uint32, bool) {
+	pf := r.prepare()
+	if pf.filter == nil {
+		return 0, false
 	}
-	return false
+	return rm.UnexpectedUpstream(pf.filter.ExpectedUpstreams)
+}
+
+// CheckExpectedOrigins returns the first announced prefix which breaks the
+// filter's ExpectedOrigins policy, and how. An AS_SET origin is not checked.
+func (r *RisLive) CheckExpectedOrigins(rm *RisMessageData) (string, OriginViolation) {
+	return r.prepare().expectedOrigins(rm)
+}
+
+// CheckFamily checks the message announces at least one prefix in the filter's
+// address Family. If not set, always return true.
+func (r *RisLive) CheckFamily(rm *RisMessageData) bool {
+	return r.prepare().checkFamily(rm)
 }
 
 // CheckPrefix will check each announcement in a message, and return true
@@ -322,46 +1668,165 @@ func (r *RisLive) CheckOrigins(rm *RisMessageData) bool {
 // check being performed, ie:
 //   192.168.0.0/16 vs 192.168.0.0/16 - match
 //   192.168.0.0/16 vs 192.168.0.0/24 - no match
+// If there are no watched prefixes, always return true.
 // TODO(morrowc): Provide super/subnet verification of each announced prefix
 // to the requestors list of supernets.
 func (r *RisLive) CheckPrefix(rm *RisMessageData) bool {
-	if len(r.Filter.Prefix) > 0 {
-		filterPrefixes := []*net.IPNet{}
-		for _, prefix := range r.Filter.Prefix {
-			_, subnet, err := net.ParseCIDR(prefix)
-			if err != nil {
-				log.Infof("failed to convert filter prefix(%v) to IPNet: %v", prefix, err)
-				continue
-			}
-			filterPrefixes = append(filterPrefixes, subnet)
-		}
-		for _, anns := range rm.Announcements {
-			for _, prefix := range anns.Prefixes {
-				for _, check := range filterPrefixes {
-					announcementIP, _, err := net.ParseCIDR(prefix)
-					if err != nil {
-						log.Infof("announcement prefix(%v) not parsed as CIDR: %v", prefix, err)
-						continue
-					}
-					if check.Contains(announcementIP) {
-						return true
-					}
-				}
-			}
-		}
+	return r.prepare().checkPrefix(rm)
+}
+
+// MatchPrefix is CheckPrefix, returning the first announced prefix which
+// matched and the filter prefix it matched, to say what an alert is about.
+// With no watched prefixes there is nothing to say, and ok is false.
+func (r *RisLive) MatchPrefix(rm *RisMessageData) (announced, filter *net.IPNet, ok bool) {
+	return r.prepare().matchPrefix(rm)
+}
+
+// CheckAll makes every filter check on the message, for logging or
+// reporting why a message did or did not match. Get stops at the first check
+// which fails, CheckAll does not.
+func (r *RisLive) CheckAll(rm *RisMessageData) MatchResult {
+	return r.prepare().checkAll(rm)
+}
+
+// CheckMinPrefixes checks the message carries at least the filter's
+// MinPrefixesPerMessage prefixes, announced and withdrawn. If not set, always
+// return true.
+func (r *RisLive) CheckMinPrefixes(rm *RisMessageData) bool {
+	return r.prepare().checkMinPrefixes(rm)
+}
+
+// CheckLargeCommunities checks the message carries any one of the filter's
+// LargeCommunities. If not set, always return true.
+func (r *RisLive) CheckLargeCommunities(rm *RisMessageData) bool {
+	return r.prepare().checkLargeCommunities(rm)
+}
+
+// CheckCommunityPattern checks the message carries a community matching any
+// one of the filter's CommunityPatterns. If not set, always return true.
+func (r *RisLive) CheckCommunityPattern(rm *RisMessageData) bool {
+	return r.prepare().checkCommunityPatterns(rm)
+}
+
+// CheckASPathRegex checks the message's path matches the filter's
+// ASPathRegex. If not set, always return true.
+func (r *RisLive) CheckASPathRegex(rm *RisMessageData) bool {
+	return r.prepare().checkASPathRegex(rm)
+}
+
+// CheckBlackhole returns the first announced prefix within the filter's
+// Prefix, any prefix if Prefix is not set, which the message carries with a
+// blackhole community: the well-known BLACKHOLE or one of the filter's
+// BlackholeCommunities. It is a monitored prefix being blackholed upstream.
+func (r *RisLive) CheckBlackhole(rm *RisMessageData) (prefix string, community []uint32, ok bool) {
+	return r.prepare().blackhole(rm)
+}
+
+// CheckRequire checks the message carries every attribute in the filter's
+// Require list: announcements, withdrawals or community. With nothing
+// required, always return true.
+func (r *RisLive) CheckRequire(rm *RisMessageData) bool {
+	return r.prepare().checkRequire(rm)
+}
+
+// CheckMalformed returns why the message is malformed, if it is, see
+// RisMessageData.Malformed. The filter does not apply.
+func (r *RisLive) CheckMalformed(rm *RisMessageData) (string, bool) {
+	return rm.Malformed()
+}
+
+// demoFilter is the filter main uses without -filter: Google's prefixes,
+// announced from one of Google's ASNs.
+func demoFilter() *RisFilter {
+	return &RisFilter{
+		Prefix:  []string{"130.137.85.0/24", "199.168.88.0/22", "8.8.8.0/24", "8.8.4.0/24", "216.239.32.0/19"},
+		Origins: []string{"15169", "54054", "396982"},
 	}
-	return false
 }
 
 func main() {
 	flag.Parse()
-	rf := &RisFilter{
-		Prefix:  []string{"130.137.85.0/24", "199.168.88.0/22", "8.8.8.0/24", "8.8.4.0/24", "216.239.32.0/19"},
-		Origins: []string{"15169", "54054", "396982"},
+	rf := demoFilter()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *filterFile != "" {
+		f, err := LoadFilter(*filterFile)
+		if err != nil {
+			logger.Error("failed to load filter", "file", *filterFile, "error", err)
+			os.Exit(1)
+		}
+		rf = f
+	}
+	if *asPath != "" {
+		path, err := ParseASPath(*asPath)
+		if err != nil {
+			logger.Error("invalid aspath", "error", err)
+			os.Exit(1)
+		}
+		rf.ASPath = path
+	}
+	opts := []Option{WithSlog(logger)}
+	if *webSocket {
+		opts = append(opts, WithWebSocket())
+	}
+	if *proxy != "" {
+		opt, err := WithProxy(*proxy)
+		if err != nil {
+			logger.Error("invalid proxy", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, opt)
 	}
-	r := NewRisLive(risLive, risFile, risClient, rf, buffer)
+	sink, err := NewFormatSink(*format, os.Stdout)
+	if err != nil {
+		logger.Error("failed to create the output sink", "error", err)
+		os.Exit(1)
+	}
+	var groups *PeerGroupSink
+	if *group > 0 {
+		groups = NewPeerGroupSink(*group, os.Stdout)
+		sink = groups
+	}
+	r := NewRisLive(risLive, risFile, risClient, rf, buffer, opts...)
+	r.Tail = *tail
+	r.StartOffset = *start
+	r.StartTimestamp = *startTime
+	r.Workers = *workers
+	r.AddSink(sink)
+	if *filterFile != "" {
+		go reloadFilter(r, *filterFile)
+	}
+
+	// Interrupted, Listen stops and the messages already read are still matched.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go r.ListenContext(ctx)
+	if *dryRun {
+		fmt.Print(r.DryRun())
+		return
+	}
+	// Each match is printed by the sink, Matches is closed once Listen returns.
+	for range r.Matches() {
+	}
+	if groups != nil {
+		if err := groups.Flush(); err != nil {
+			logger.Error("failed to write the peer groups", "error", err)
+		}
+	}
+	logger.Info("stopped", "records", atomic.LoadInt64(&r.Records), "dropped", r.Dropped())
+}
 
-	go r.Listen()
-	result := r.Get(r.Filter)
-	fmt.Printf("Result: %v\n", result)
+// reloadFilter replaces the filter with the contents of path on each SIGHUP.
+// A filter which fails to load is logged and the current filter kept.
+func reloadFilter(r *RisLive, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		f, err := LoadFilter(path)
+		if err != nil {
+			r.log().Error("failed to reload filter, keeping the current filter", "file", path, "error", err)
+			continue
+		}
+		r.SetFilter(f)
+		r.log().Info("reloaded filter", "file", path)
+	}
 }
@@ -1,11 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
@@ -18,18 +32,31 @@ var (
 	msg04 = &RisMessageData{Path: []interface{}{1, 3, 2, 4, 5, 6, 7, 8}, Origin: "8"}
 	msg05 = &RisMessageData{Path: []interface{}{"An", "ASN", "LIST", "HERE"}, Origin: "9"}
 	msg06 = &RisMessageData{Path: []interface{}{1, 2, 3, []string{"6"}}, Origin: "9"}
+	msg07 = &RisMessageData{Path: []interface{}{3, 4}, Origin: "4"}
 )
 
 func TestDigestPath(t *testing.T) {
 	tests := []struct {
 		desc    string
 		msg     *RisMessageData
-		want    []int32
+		want    []uint32
 		wantErr bool
 	}{{
 		desc: "Success decode",
 		msg:  msg01,
-		want: []int32{1, 2, 3, 4, 5, 6, 7, 8},
+		want: []uint32{1, 2, 3, 4, 5, 6, 7, 8},
+	}, {
+		desc: "Success 4-byte ASNs above 2147483647",
+		msg:  &RisMessageData{Path: []interface{}{float64(3356), float64(4200000000), []interface{}{float64(4294967295)}}},
+		want: []uint32{3356, 4200000000, 4294967295},
+	}, {
+		desc:    "Error, negative ASN",
+		msg:     &RisMessageData{Path: []interface{}{float64(3356), float64(-1)}},
+		wantErr: true,
+	}, {
+		desc:    "Error, ASN above 32 bits",
+		msg:     &RisMessageData{Path: []interface{}{float64(3356), []interface{}{float64(4294967296)}}},
+		wantErr: true,
 	}, {
 		desc:    "Error, path is words",
 		msg:     msg05,
@@ -58,19 +85,19 @@ func TestDigestPath(t *testing.T) {
 func TestNewRisFilter(t *testing.T) {
 	tests := []struct {
 		desc            string
-		aspath          []int32
-		transits        map[int32]bool
+		aspath          []uint32
+		transits        map[uint32]bool
 		origins, prefix []string
 		want            *RisFilter
 	}{{
 		desc:     "Success NewRisFilter",
-		aspath:   []int32{1, 2, 3},
-		transits: map[int32]bool{1: true, 2: true},
+		aspath:   []uint32{1, 2, 3},
+		transits: map[uint32]bool{1: true, 2: true},
 		origins:  []string{"1", "2"},
 		prefix:   []string{"192.168.1.0/24", "10.1.0.0/16"},
 		want: &RisFilter{
-			ASPath:           []int32{1, 2, 3},
-			InvalidTransitAS: map[int32]bool{1: true, 2: true},
+			ASPath:           []uint32{1, 2, 3},
+			InvalidTransitAS: map[uint32]bool{1: true, 2: true},
 			Origins:          []string{"1", "2"},
 			Prefix:           []string{"192.168.1.0/24", "10.1.0.0/16"},
 		},
@@ -97,12 +124,12 @@ func TestNewRisLive(t *testing.T) {
 		url:    "http://blah",
 		file:   nil,
 		ua:     "foo",
-		rf:     RisFilter{ASPath: []int32{1}},
+		rf:     RisFilter{ASPath: []uint32{1}},
 		buffer: 10,
 		want: &RisLive{
 			URL:    proto.String("http://blah"),
 			UA:     proto.String("foo"),
-			Filter: &RisFilter{ASPath: []int32{1}},
+			Filter: &RisFilter{ASPath: []uint32{1}},
 			Chan:   make(chan (RisMessage), 10),
 		},
 	}}
@@ -171,6 +198,21 @@ func TestMatchPrefix(t *testing.T) {
 		ann:        p6,
 		candidates: []string{"192.168.0.0/16", "100.64.0.0/10"},
 		want:       false,
+	}, {
+		desc:       "Success v4 zero padded",
+		ann:        p4,
+		candidates: []string{"192.168.000.0/16"},
+		want:       true,
+	}, {
+		desc:       "Success v6 upper case",
+		ann:        p6,
+		candidates: []string{"2001:DB8:0048::/48"},
+		want:       true,
+	}, {
+		desc:       "Failure v4 covering",
+		ann:        p4,
+		candidates: []string{"192.0.0.0/8"},
+		want:       false,
 	}}
 
 	for _, test := range tests {
@@ -181,46 +223,239 @@ func TestMatchPrefix(t *testing.T) {
 	}
 }
 
+func TestRoutes(t *testing.T) {
+	fd, err := ioutil.ReadFile("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var sixth RisMessage
+	if err := json.Unmarshal([]byte(strings.Split(string(fd), "\n")[5]), &sixth); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	if err := digestPath(sixth.Data); err != nil {
+		t.Fatalf("failed to digest path: %v", err)
+	}
+	path := []uint32{24482, 6453, 174, 513, 513, 12654}
+
+	tests := []struct {
+		desc string
+		data *RisMessageData
+		want []Route
+	}{{
+		desc: "The 6th message of testdata/10-msg, one prefix via a global and a link-local next-hop",
+		data: sixth.Data,
+		want: []Route{
+			{Prefix: "2001:7fb:fe04::/48", NextHop: "2001:7f8:d:ff::226", LinkLocal: "fe80::2a0:a500:0:3e6", OriginASN: 12654, Path: path},
+		},
+	}, {
+		desc: "Link-local listed before the global next-hop",
+		data: &RisMessageData{
+			OriginASN: 64500,
+			Announcements: []*RisAnnouncement{
+				{NextHop: "fe80::1", Prefixes: []string{"2001:db8::/32"}},
+				{NextHop: "2001:db8:ffff::1", Prefixes: []string{"2001:db8::/32", "2001:db8:1::/48"}},
+			},
+		},
+		want: []Route{
+			{Prefix: "2001:db8::/32", NextHop: "2001:db8:ffff::1", LinkLocal: "fe80::1", OriginASN: 64500},
+			{Prefix: "2001:db8:1::/48", NextHop: "2001:db8:ffff::1", OriginASN: 64500},
+		},
+	}, {
+		desc: "Link-local without a global next-hop for the prefix",
+		data: &RisMessageData{
+			OriginASN: 64500,
+			Announcements: []*RisAnnouncement{
+				{NextHop: "fe80::1", Prefixes: []string{"2001:db8:2::/48"}},
+				{NextHop: "2001:db8:ffff::1", Prefixes: []string{"2001:db8::/32"}},
+			},
+		},
+		want: []Route{
+			{Prefix: "2001:db8::/32", NextHop: "2001:db8:ffff::1", OriginASN: 64500},
+			{Prefix: "2001:db8:2::/48", NextHop: "fe80::1", OriginASN: 64500},
+		},
+	}, {
+		desc: "Two global next-hops, two routes",
+		data: &RisMessageData{
+			OriginASN: 64500,
+			Announcements: []*RisAnnouncement{
+				{NextHop: "2001:db8:ffff::1", Prefixes: []string{"2001:db8::/32"}},
+				{NextHop: "2001:db8:ffff::2", Prefixes: []string{"2001:db8::/32"}},
+			},
+		},
+		want: []Route{
+			{Prefix: "2001:db8::/32", NextHop: "2001:db8:ffff::1", OriginASN: 64500},
+			{Prefix: "2001:db8::/32", NextHop: "2001:db8:ffff::2", OriginASN: 64500},
+		},
+	}, {
+		desc: "Prefixes in announcement order",
+		data: NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24", "198.51.100.0/24").Data,
+		want: []Route{
+			{Prefix: "192.0.2.0/24", NextHop: "192.0.2.1", OriginASN: 64500, Path: []uint32{3356, 64500}},
+			{Prefix: "198.51.100.0/24", NextHop: "192.0.2.1", OriginASN: 64500, Path: []uint32{3356, 64500}},
+		},
+	}, {
+		desc: "Withdrawals only, no routes",
+		data: &RisMessageData{Withdrawals: []string{"192.0.2.0/24"}},
+	}}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(test.data.Routes(), test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestMatchPrefixCovering(t *testing.T) {
+	// Example/test announcements.
+	p4 := &RisAnnouncement{
+		NextHop:  "1.2.3.4",
+		Prefixes: []string{"192.168.0.0/24", "10.0.0.0/24"},
+	}
+	p6 := &RisAnnouncement{
+		NextHop:  "2001:db8:123::1",
+		Prefixes: []string{"2001:db8::/32", "2001:db8:48::/48"},
+	}
+
+	tests := []struct {
+		desc       string
+		ann        *RisAnnouncement
+		candidates []string
+		want       bool
+	}{{
+		desc:       "Success v4 exact",
+		ann:        p4,
+		candidates: []string{"192.168.0.0/24", "100.64.0.0/10"},
+		want:       true,
+	}, {
+		desc:       "Success v4 covering",
+		ann:        p4,
+		candidates: []string{"192.168.0.0/16"},
+		want:       true,
+	}, {
+		desc:       "Success v4 zero padded covering",
+		ann:        p4,
+		candidates: []string{"192.168.000.0/16"},
+		want:       true,
+	}, {
+		desc:       "Success v6 covering",
+		ann:        p6,
+		candidates: []string{"2001:db8:40::/42"},
+		want:       true,
+	}, {
+		desc:       "Success v6 match in mixed family",
+		ann:        p6,
+		candidates: []string{"192.169.0.0/16", "2001:db8::/32"},
+		want:       true,
+	}, {
+		desc:       "Success v4 more-specific of the announcement, as CheckPrefix",
+		ann:        p4,
+		candidates: []string{"192.168.0.0/25"},
+		want:       true,
+	}, {
+		desc:       "Failure v4",
+		ann:        p4,
+		candidates: []string{"197.168.0.0/16", "10.64.0.0/16"},
+		want:       false,
+	}, {
+		desc:       "Failure v6",
+		ann:        p6,
+		candidates: []string{"2001:db9::/32"},
+		want:       false,
+	}, {
+		desc:       "Failure v4 with v6 match",
+		ann:        p4,
+		candidates: []string{"::/0"},
+		want:       false,
+	}, {
+		desc:       "Failure v6 with v4 match",
+		ann:        p6,
+		candidates: []string{"0.0.0.0/0"},
+		want:       false,
+	}, {
+		desc:       "Failure not a prefix",
+		ann:        p4,
+		candidates: []string{"192.168.0.0"},
+		want:       false,
+	}}
+
+	for _, test := range tests {
+		got := test.ann.MatchPrefixCovering(test.candidates)
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch, got(%v) / want(%v)", test.desc, got, test.want)
+		}
+	}
+}
+
 func TestMatchASPath(t *testing.T) {
 	tests := []struct {
 		desc       string
 		msg        *RisMessageData
-		candidates []int32
+		candidates []uint32
 		want       bool
 	}{{
 		desc:       "Success find len(1) path",
 		msg:        msg01,
-		candidates: []int32{3},
+		candidates: []uint32{3},
 		want:       true,
 	}, {
 		desc:       "Fail can not find len(1) path",
 		msg:        msg01,
-		candidates: []int32{10},
+		candidates: []uint32{10},
 		want:       false,
 	}, {
 		desc:       "Success can find len(2) path",
 		msg:        msg01,
-		candidates: []int32{3, 4},
+		candidates: []uint32{3, 4},
 		want:       true,
 	}, {
 		desc:       "Success can find len(3) path",
 		msg:        msg01,
-		candidates: []int32{3, 4, 5},
+		candidates: []uint32{3, 4, 5},
 		want:       true,
 	}, {
 		desc:       "Success candidate path too long",
 		msg:        msg02,
-		candidates: []int32{3, 4, 5},
+		candidates: []uint32{3, 4, 5},
 		want:       false,
 	}, {
 		desc:       "Success candidate path not in mesg",
 		msg:        msg03,
-		candidates: []int32{2, 3, 4},
+		candidates: []uint32{2, 3, 4},
 		want:       false,
 	}, {
 		desc:       "Success candidate path in wrong order from mesg",
 		msg:        msg04,
-		candidates: []int32{2, 3, 4},
+		candidates: []uint32{2, 3, 4},
+		want:       false,
+	}, {
+		desc:       "Success candidate is the tail of the path",
+		msg:        msg01,
+		candidates: []uint32{6, 7, 8},
+		want:       true,
+	}, {
+		desc:       "Success candidate is the whole path",
+		msg:        msg07,
+		candidates: []uint32{3, 4},
+		want:       true,
+	}, {
+		desc:       "Success candidate is the whole of a longer path",
+		msg:        msg01,
+		candidates: []uint32{1, 2, 3, 4, 5, 6, 7, 8},
+		want:       true,
+	}, {
+		desc:       "Success candidate is the origin alone",
+		msg:        msg01,
+		candidates: []uint32{8},
+		want:       true,
+	}, {
+		desc:       "Success candidate is origin via its upstream",
+		msg:        msg01,
+		candidates: []uint32{7, 8},
+		want:       true,
+	}, {
+		desc:       "Success candidate one longer than the whole path",
+		msg:        msg07,
+		candidates: []uint32{3, 4, 5},
 		want:       false,
 	}}
 
@@ -240,17 +475,17 @@ func TestInvalidTransitAS(t *testing.T) {
 	tests := []struct {
 		desc       string
 		msg        *RisMessageData
-		candidates map[int32]bool
+		candidates map[uint32]bool
 		want       bool
 	}{{
 		desc:       "Success - AS4 in transit position",
 		msg:        msg01,
-		candidates: map[int32]bool{4: true, 14: true, 0: true},
+		candidates: map[uint32]bool{4: true, 14: true, 0: true},
 		want:       true,
 	}, {
 		desc:       "Success - AS10 not in transit position",
 		msg:        msg01,
-		candidates: map[int32]bool{10: true, 14: true, 0: true},
+		candidates: map[uint32]bool{10: true, 14: true, 0: true},
 		want:       true,
 	}}
 
@@ -261,6 +496,75 @@ func TestInvalidTransitAS(t *testing.T) {
 	}
 }
 
+func TestInvalidTransitASSkip(t *testing.T) {
+	flagged := map[uint32]bool{64500: true}
+	tests := []struct {
+		desc       string
+		path       []uint32
+		skipPeer   bool
+		skipOrigin bool
+		want       bool
+	}{{
+		desc: "Flagged origin, nothing skipped",
+		path: []uint32{3356, 174, 64500},
+		want: true,
+	}, {
+		desc:       "Flagged origin, origin skipped",
+		path:       []uint32{3356, 174, 64500},
+		skipOrigin: true,
+		want:       false,
+	}, {
+		desc:       "Flagged prepended origin, origin skipped",
+		path:       []uint32{3356, 174, 64500, 64500, 64500},
+		skipOrigin: true,
+		want:       false,
+	}, {
+		desc:       "Flagged middle hop, origin skipped",
+		path:       []uint32{3356, 64500, 174},
+		skipOrigin: true,
+		want:       true,
+	}, {
+		desc:       "Flagged middle hop, peer and origin skipped",
+		path:       []uint32{3356, 64500, 174},
+		skipPeer:   true,
+		skipOrigin: true,
+		want:       true,
+	}, {
+		desc:     "Flagged peer, peer skipped",
+		path:     []uint32{64500, 3356, 174},
+		skipPeer: true,
+		want:     false,
+	}, {
+		desc:       "Flagged peer and origin, both skipped",
+		path:       []uint32{64500},
+		skipPeer:   true,
+		skipOrigin: true,
+		want:       false,
+	}, {
+		desc:       "Empty path",
+		skipPeer:   true,
+		skipOrigin: true,
+		want:       false,
+	}}
+
+	for _, test := range tests {
+		rm := NewTestMessage(test.path, "igp", "192.0.2.0/24").Data
+		got := rm.InvalidTransitASSkip(flagged, test.skipPeer, test.skipOrigin)
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+
+		r := &RisLive{Filter: &RisFilter{
+			InvalidTransitAS:  flagged,
+			TransitSkipPeer:   test.skipPeer,
+			TransitSkipOrigin: test.skipOrigin,
+		}}
+		if got := r.CheckInvalidTransitAS(rm); got != test.want {
+			t.Errorf("[%v]: CheckInvalidTransitAS got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
 func TestCheckASPath(t *testing.T) {
 	tests := []struct {
 		desc string
@@ -269,17 +573,17 @@ func TestCheckASPath(t *testing.T) {
 		want bool
 	}{{
 		desc: "Success - second element",
-		rl:   &RisLive{Filter: &RisFilter{ASPath: []int32{57695, 12}}},
+		rl:   &RisLive{Filter: &RisFilter{ASPath: []uint32{57695, 12}}},
 		data: &RisMessageData{Path: []interface{}{float64(57695), float64(12), float64(2332)}},
 		want: true,
 	}, {
 		desc: "Success - zero matches",
-		rl:   &RisLive{Filter: &RisFilter{ASPath: []int32{57695, 12}}},
+		rl:   &RisLive{Filter: &RisFilter{ASPath: []uint32{57695, 12}}},
 		data: &RisMessageData{Path: []interface{}{float64(57695), float64(128), float64(2332)}},
 		want: false,
 	}, {
 		desc: "Success - zero to match",
-		rl:   &RisLive{Filter: &RisFilter{ASPath: []int32{}}},
+		rl:   &RisLive{Filter: &RisFilter{ASPath: []uint32{}}},
 		data: &RisMessageData{Path: []interface{}{float64(5769), float64(128), float64(2332)}},
 		want: true,
 	}}
@@ -323,6 +627,26 @@ func TestCheckOrigins(t *testing.T) {
 		msg:        msg01,
 		candidates: []string{"4", "5"},
 		want:       false,
+	}, {
+		desc:       "Success origin ASN 701 with ORIGIN igp",
+		msg:        NewTestMessage([]uint32{3356, 701}, "igp", "192.0.2.0/24").Data,
+		candidates: []string{"701"},
+		want:       true,
+	}, {
+		desc:       "Failure ORIGIN igp is not an origin ASN",
+		msg:        NewTestMessage([]uint32{3356, 701}, "igp", "192.0.2.0/24").Data,
+		candidates: []string{"igp"},
+		want:       false,
+	}, {
+		desc:       "Success asdot origin ASN",
+		msg:        NewTestMessage([]uint32{3356, 65546}, "igp", "192.0.2.0/24").Data,
+		candidates: []string{"1.10"},
+		want:       true,
+	}, {
+		desc:       "Failure no path, no origin ASN",
+		msg:        NewTestMessage(nil, "igp", "192.0.2.0/24").Data,
+		candidates: []string{"0", "igp"},
+		want:       false,
 	}}
 
 	for _, test := range tests {
@@ -341,19 +665,19 @@ func TestCheckInvalidTransitAS(t *testing.T) {
 		want bool
 	}{{
 		desc: "Success - Transit-AS found",
-		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[int32]bool{32: true, 1: true}}},
+		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[uint32]bool{32: true, 1: true}}},
 		msg:  &RisMessageData{Path: []interface{}{12, 701, 1, 4}},
 		want: true,
 	}, {
 		desc: "Success - Transit-AS not found",
-		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[int32]bool{32: true, 1: true}}},
+		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[uint32]bool{32: true, 1: true}}},
 		msg:  &RisMessageData{Path: []interface{}{12, 701, 5, 4}},
 		want: false,
 	}, {
-		desc: "Success - InvalidTransitAS is zero length - false return",
-		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[int32]bool{}}},
+		desc: "Success - InvalidTransitAS is zero length - true return",
+		rl:   &RisLive{Filter: &RisFilter{InvalidTransitAS: map[uint32]bool{}}},
 		msg:  &RisMessageData{Path: []interface{}{12, 701, 5, 4}},
-		want: false,
+		want: true,
 	}}
 
 	for _, test := range tests {
@@ -378,18 +702,18 @@ func TestCheckOriginsRisLive(t *testing.T) {
 	}{{
 		desc: "Success - Origin Match",
 		rl:   &RisLive{Filter: &RisFilter{Origins: []string{"1", "701", "7018"}}},
-		msg:  &RisMessageData{Origin: "701"},
+		msg:  &RisMessageData{Origin: "igp", OriginASN: 701},
 		want: true,
 	}, {
 		desc: "Success - Origins not found - false match",
 		rl:   &RisLive{Filter: &RisFilter{Origins: []string{"1", "7018", "3356"}}},
-		msg:  &RisMessageData{Origin: "701"},
+		msg:  &RisMessageData{Origin: "igp", OriginASN: 701},
 		want: false,
 	}, {
-		desc: "Success - Origins zero length - false match",
+		desc: "Success - Origins zero length - true match",
 		rl:   &RisLive{Filter: &RisFilter{Origins: []string{}}},
-		msg:  &RisMessageData{Origin: "701"},
-		want: false,
+		msg:  &RisMessageData{Origin: "igp", OriginASN: 701},
+		want: true,
 	}}
 
 	for _, test := range tests {
@@ -400,82 +724,455 @@ func TestCheckOriginsRisLive(t *testing.T) {
 	}
 }
 
-func TestCheckPrefix(t *testing.T) {
+// TestHighASN checks a 4-byte ASN above 2147483647 matches every ASN filter,
+// as an int32 ASN it wrapped negative and never did.
+func TestHighASN(t *testing.T) {
+	const high = 4200000000
+	rm := &RisMessageData{Path: []interface{}{float64(3356), float64(high), float64(64500), float64(high)}}
+	if err := digestPath(rm); err != nil {
+		t.Fatalf("failed to digest path: %v", err)
+	}
+	r := &RisLive{Filter: &RisFilter{
+		ASPath:           []uint32{high, 64500},
+		InvalidTransitAS: map[uint32]bool{high: true},
+		Origins:          []string{"4200000000"},
+		OriginASNs:       []uint32{high},
+	}}
+	if err := r.Filter.Validate(); err != nil {
+		t.Fatalf("got error validating the filter: %v", err)
+	}
+
+	tests := []struct {
+		desc  string
+		check func(*RisMessageData) bool
+	}{{
+		desc:  "ASPath",
+		check: r.CheckASPath,
+	}, {
+		desc:  "InvalidTransitAS",
+		check: r.CheckInvalidTransitAS,
+	}, {
+		desc:  "Origins",
+		check: r.CheckOrigins,
+	}, {
+		desc:  "OriginASNs",
+		check: r.CheckOriginASN,
+	}}
+
+	for _, test := range tests {
+		if !test.check(rm) {
+			t.Errorf("[%v]: got/want mismatch: got false wanted true", test.desc)
+		}
+	}
+	if got := rm.PathString(); got != "3356 4200000000 64500 4200000000" {
+		t.Errorf("got/want mismatch: got %q wanted %q", got, "3356 4200000000 64500 4200000000")
+	}
+}
+
+func TestCheckOriginASN(t *testing.T) {
+	set := &RisMessageData{Path: []interface{}{float64(3356), float64(174), []interface{}{float64(64500), float64(64501)}}}
+	if err := digestPath(set); err != nil {
+		t.Fatalf("failed to digest the AS_SET path: %v", err)
+	}
+	// A set before the end of the path is not the origin.
+	midSet := &RisMessageData{Path: []interface{}{float64(3356), []interface{}{float64(64500)}, float64(174)}}
+	if err := digestPath(midSet); err != nil {
+		t.Fatalf("failed to digest the AS_SET path: %v", err)
+	}
+
 	tests := []struct {
 		desc string
-		rm   *RisMessageData
 		rl   *RisLive
+		msg  *RisMessageData
 		want bool
 	}{{
-		desc: "Simple prefix match",
-		rm: &RisMessageData{
-			Announcements: []*RisAnnouncement{
-				&RisAnnouncement{
-					Prefixes: []string{"192.168.0.0/16"},
-				},
-			},
-		},
-		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		desc: "Success scalar origin",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{701, 64500}}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
 		want: true,
 	}, {
-		desc: "Match a subnet announcement",
-		rm: &RisMessageData{
-			Announcements: []*RisAnnouncement{
-				&RisAnnouncement{
-					Prefixes: []string{"192.168.0.0/24"},
-				},
-			},
-		},
-		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		desc: "Failure scalar origin not in the filter",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{701}}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		want: false,
+	}, {
+		desc: "Failure transit ASN is not the origin",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{3356}}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		want: false,
+	}, {
+		desc: "Success any member of an origin AS_SET",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{64500}}},
+		msg:  set,
 		want: true,
 	}, {
-		desc: "RisLive data is improper",
-		rm: &RisMessageData{
-			Announcements: []*RisAnnouncement{
-				&RisAnnouncement{
-					Prefixes: []string{"192.168.0.0/24"},
-				},
-			},
-		},
-		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.b.0.0/16"}}},
+		desc: "Failure no member of an origin AS_SET",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{174}}},
+		msg:  set,
 		want: false,
 	}, {
-		desc: "RisMessageData is improper",
-		rm: &RisMessageData{
-			Announcements: []*RisAnnouncement{
-				&RisAnnouncement{
-					Prefixes: []string{"192.b.0.0/24"},
-				},
-			},
-		},
-		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		desc: "Failure AS_SET not at the end of the path",
+		rl:   &RisLive{Filter: &RisFilter{OriginASNs: []uint32{64500}}},
+		msg:  midSet,
 		want: false,
+	}, {
+		desc: "Success no OriginASNs in the filter",
+		rl:   &RisLive{Filter: &RisFilter{}},
+		msg:  NewTestMessage(nil, "igp", "192.0.2.0/24").Data,
+		want: true,
 	}}
 
 	for _, test := range tests {
-		got := test.rl.CheckPrefix(test.rm)
+		got := test.rl.CheckOriginASN(test.msg)
 		if got != test.want {
 			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
 		}
 	}
 }
 
-func testServer(f string) *httptest.Server {
-	fd, err := ioutil.ReadFile(f)
-	if err != nil {
-		return nil
-	}
+func TestCheckUpdateKind(t *testing.T) {
+	announcement := NewTestMessage([]uint32{64500, 64501}, "igp", "192.0.2.0/24").Data
+	withdrawal := &RisMessageData{Type: "UPDATE", Withdrawals: []string{"198.51.100.0/24"}}
+	both := NewTestMessage([]uint32{64500, 64501}, "igp", "192.0.2.0/24").Data
+	both.Withdrawals = []string{"198.51.100.0/24"}
 
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, string(fd))
-	}))
+	tests := []struct {
+		desc string
+		kind UpdateKind
+		msg  *RisMessageData
+		want bool
+	}{{
+		desc: "Success any, announcement",
+		kind: UpdateAny,
+		msg:  announcement,
+		want: true,
+	}, {
+		desc: "Success any, withdrawal",
+		kind: UpdateAny,
+		msg:  withdrawal,
+		want: true,
+	}, {
+		desc: "Success announcements only, announcement",
+		kind: AnnouncementsOnly,
+		msg:  announcement,
+		want: true,
+	}, {
+		desc: "Failure announcements only, withdrawal",
+		kind: AnnouncementsOnly,
+		msg:  withdrawal,
+		want: false,
+	}, {
+		desc: "Success withdrawals only, withdrawal",
+		kind: WithdrawalsOnly,
+		msg:  withdrawal,
+		want: true,
+	}, {
+		desc: "Failure withdrawals only, announcement",
+		kind: WithdrawalsOnly,
+		msg:  announcement,
+		want: false,
+	}, {
+		desc: "Success withdrawals only, both in one message",
+		kind: WithdrawalsOnly,
+		msg:  both,
+		want: true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{UpdateKind: test.kind}}
+		if got := r.CheckUpdateKind(test.msg); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
 }
 
-func TestListen(t *testing.T) {
+func TestCheckExpectedUpstreams(t *testing.T) {
+	policy := map[uint32]map[uint32]bool{64500: {701: true, 3356: true, 174: true}}
 	tests := []struct {
-		desc   string
-		file   *string
-		remote bool
+		desc    string
+		path    []uint32
+		want    uint32
+		wantBad bool
+	}{{
+		desc: "Allowed upstream",
+		path: []uint32{6939, 3356, 64500},
+	}, {
+		desc:    "Unexpected upstream",
+		path:    []uint32{6939, 1299, 64500},
+		want:    1299,
+		wantBad: true,
+	}, {
+		desc:    "Unexpected upstream, prepended origin",
+		path:    []uint32{6939, 1299, 64500, 64500, 64500},
+		want:    1299,
+		wantBad: true,
+	}, {
+		desc: "Allowed upstream is the collector peer",
+		path: []uint32{701, 64500},
+	}, {
+		desc: "Origin is the collector peer, no upstream",
+		path: []uint32{64500},
+	}, {
+		desc: "Origin without a policy",
+		path: []uint32{6939, 1299, 64501},
+	}, {
+		desc:    "Allowed upstream elsewhere in the path is not enough",
+		path:    []uint32{3356, 1299, 64500},
+		want:    1299,
+		wantBad: true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{ExpectedUpstreams: policy}}
+		rm := NewTestMessage(test.path, "igp", "192.0.2.0/24").Data
+		got, unexpected := r.CheckExpectedUpstreams(rm)
+		if got != test.want || unexpected != test.wantBad {
+			t.Errorf("[%v]: got/want mismatch: got (%v, %v) wanted (%v, %v)",
+				test.desc, got, unexpected, test.want, test.wantBad)
+		}
+		// As a filter, only the violations pass.
+		if pass := r.prepare().checkExpectedUpstreams(rm); pass != test.wantBad {
+			t.Errorf("[%v]: filter check got %v wanted %v", test.desc, pass, test.wantBad)
+		}
+	}
+}
+
+func TestCheckExpectedOrigins(t *testing.T) {
+	policy := map[uint32][]string{
+		64500: {"192.0.2.0/24", "2001:db8::/32"},
+		64501: {"198.51.100.0/24", "192.0.2.128/25"},
+	}
+	tests := []struct {
+		desc       string
+		path       []uint32
+		prefixes   []string
+		wantPrefix string
+		want       OriginViolation
+	}{{
+		desc:     "Authorised prefix",
+		path:     []uint32{3356, 64500},
+		prefixes: []string{"192.0.2.0/24"},
+	}, {
+		desc:     "Authorised more-specific",
+		path:     []uint32{3356, 64500},
+		prefixes: []string{"2001:db8:1::/48"},
+	}, {
+		desc:       "Origin announces outside its prefixes",
+		path:       []uint32{3356, 64500},
+		prefixes:   []string{"192.0.2.0/24", "203.0.113.0/24"},
+		wantPrefix: "203.0.113.0/24",
+		want:       UnexpectedPrefix,
+	}, {
+		desc:       "Origin announces a less-specific of its prefix",
+		path:       []uint32{3356, 64500},
+		prefixes:   []string{"192.0.0.0/16"},
+		wantPrefix: "192.0.0.0/16",
+		want:       UnexpectedPrefix,
+	}, {
+		desc:       "Other origin announces an authorised prefix",
+		path:       []uint32{3356, 64502},
+		prefixes:   []string{"192.0.2.0/24"},
+		wantPrefix: "192.0.2.0/24",
+		want:       UnexpectedOrigin,
+	}, {
+		desc:       "Other origin announces a more-specific of an authorised prefix",
+		path:       []uint32{3356, 64502},
+		prefixes:   []string{"198.51.100.128/25"},
+		wantPrefix: "198.51.100.128/25",
+		want:       UnexpectedOrigin,
+	}, {
+		desc:     "Most specific authorisation wins",
+		path:     []uint32{3356, 64501},
+		prefixes: []string{"192.0.2.192/26"},
+	}, {
+		desc:       "Origin within its own prefix, under another's more-specific",
+		path:       []uint32{3356, 64500},
+		prefixes:   []string{"192.0.2.192/26"},
+		wantPrefix: "192.0.2.192/26",
+		want:       UnexpectedOrigin,
+	}, {
+		desc:     "Origin and prefix both outside the policy",
+		path:     []uint32{3356, 64502},
+		prefixes: []string{"203.0.113.0/24"},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{ExpectedOrigins: policy}}
+		rm := NewTestMessage(test.path, "igp", test.prefixes...).Data
+		prefix, got := r.CheckExpectedOrigins(rm)
+		if prefix != test.wantPrefix || got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got (%v, %v) wanted (%v, %v)",
+				test.desc, prefix, got, test.wantPrefix, test.want)
+		}
+		// As a filter, only the violations pass.
+		if pass := r.prepare().checkExpectedOrigins(rm); pass != (test.want != NoOriginViolation) {
+			t.Errorf("[%v]: filter check got %v wanted %v", test.desc, pass, test.want != NoOriginViolation)
+		}
+	}
+}
+
+func TestCheckFamily(t *testing.T) {
+	v4 := NewTestMessage([]uint32{57695, 37650}, "igp", "196.50.70.0/24").Data
+	v6 := NewTestMessage([]uint32{57695, 37006}, "igp", "2c0f:fe30::/32").Data
+	mixed := NewTestMessage([]uint32{24482, 12654}, "igp", "84.205.64.0/24", "2001:7fb:fe04::/48").Data
+	withdrawal := &RisMessageData{Type: "UPDATE", Withdrawals: []string{"2001:7fb:fe0d::/48"}}
+
+	tests := []struct {
+		desc   string
+		family int
+		msg    *RisMessageData
+		want   bool
+	}{{
+		desc: "Success no family, v4 message",
+		msg:  v4,
+		want: true,
+	}, {
+		desc:   "Success v4 family, v4 message",
+		family: 4,
+		msg:    v4,
+		want:   true,
+	}, {
+		desc:   "Failure v6 family, v4 message",
+		family: 6,
+		msg:    v4,
+		want:   false,
+	}, {
+		desc:   "Success v6 family, v6 message",
+		family: 6,
+		msg:    v6,
+		want:   true,
+	}, {
+		desc:   "Failure v4 family, v6 message",
+		family: 4,
+		msg:    v6,
+		want:   false,
+	}, {
+		desc:   "Success v4 family, mixed message",
+		family: 4,
+		msg:    mixed,
+		want:   true,
+	}, {
+		desc:   "Success v6 family, mixed message",
+		family: 6,
+		msg:    mixed,
+		want:   true,
+	}, {
+		desc:   "Failure v6 family, withdrawal only",
+		family: 6,
+		msg:    withdrawal,
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{Family: test.family}}
+		if got := r.CheckFamily(test.msg); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCheckPrefix(t *testing.T) {
+	tests := []struct {
+		desc string
+		rm   *RisMessageData
+		rl   *RisLive
+		want bool
+	}{{
+		desc: "Simple prefix match",
+		rm:   NewTestMessage(nil, "igp", "192.168.0.0/16").Data,
+		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		want: true,
+	}, {
+		desc: "Match a subnet announcement",
+		rm:   NewTestMessage(nil, "igp", "192.168.0.0/24").Data,
+		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		want: true,
+	}, {
+		desc: "RisLive data is improper",
+		rm:   NewTestMessage(nil, "igp", "192.168.0.0/24").Data,
+		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.b.0.0/16"}}},
+		want: false,
+	}, {
+		desc: "RisMessageData is improper",
+		rm:   NewTestMessage(nil, "igp", "192.b.0.0/24").Data,
+		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.0.0/16"}}},
+		want: false,
+	}, {
+		desc: "Zero padded filter prefix",
+		rm:   NewTestMessage(nil, "igp", "192.168.0.0/24").Data,
+		rl:   &RisLive{Filter: &RisFilter{Prefix: []string{"192.168.000.000/16"}}},
+		want: true,
+	}}
+
+	for _, test := range tests {
+		got := test.rl.CheckPrefix(test.rm)
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestRisLiveMatchPrefix(t *testing.T) {
+	tests := []struct {
+		desc         string
+		rm           *RisMessageData
+		filter       []string
+		wantAnnounce string
+		wantFilter   string
+		wantOk       bool
+	}{{
+		desc:         "A /24 inside a /16 filter",
+		rm:           NewTestMessage(nil, "igp", "192.168.1.0/24").Data,
+		filter:       []string{"10.0.0.0/8", "192.168.0.0/16"},
+		wantAnnounce: "192.168.1.0/24",
+		wantFilter:   "192.168.0.0/16",
+		wantOk:       true,
+	}, {
+		desc:         "The second announced prefix matches",
+		rm:           NewTestMessage(nil, "igp", "172.16.0.0/24", "2001:db8:1::/48").Data,
+		filter:       []string{"2001:db8::/32"},
+		wantAnnounce: "2001:db8:1::/48",
+		wantFilter:   "2001:db8::/32",
+		wantOk:       true,
+	}, {
+		desc:   "No match",
+		rm:     NewTestMessage(nil, "igp", "172.16.0.0/24").Data,
+		filter: []string{"192.168.0.0/16"},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{Prefix: test.filter}}
+		announced, filter, ok := r.MatchPrefix(test.rm)
+		if ok != test.wantOk {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, ok, test.wantOk)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if announced.String() != test.wantAnnounce || filter.String() != test.wantFilter {
+			t.Errorf("[%v]: got/want mismatch: got (%v, %v) wanted (%v, %v)",
+				test.desc, announced, filter, test.wantAnnounce, test.wantFilter)
+		}
+	}
+}
+
+func testServer(f string) *httptest.Server {
+	fd, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, string(fd))
+	}))
+}
+
+func TestListen(t *testing.T) {
+	tests := []struct {
+		desc   string
+		file   *string
+		remote bool
 		recNum int
 		want   RisMessage
 	}{{
@@ -492,9 +1189,10 @@ func TestListen(t *testing.T) {
 				Host:         "rrc19",
 				Type:         "UPDATE",
 				Path:         []interface{}{float64(57695), float64(37650)},
-				Community:    [][]int32{{57695, 12000}, {57695, 12001}},
+				Community:    [][]uint32{{57695, 12000}, {57695, 12001}},
 				Origin:       "igp",
-				DigestedPath: []int32{int32(57695), int32(37650)},
+				DigestedPath: []uint32{uint32(57695), uint32(37650)},
+				OriginASN:    37650,
 				Announcements: []*RisAnnouncement{
 					&RisAnnouncement{
 						NextHop:  "196.60.9.165",
@@ -516,9 +1214,10 @@ func TestListen(t *testing.T) {
 				Host:         "rrc19",
 				Type:         "UPDATE",
 				Path:         []interface{}{float64(57695), float64(37650)},
-				Community:    [][]int32{{57695, 12000}, {57695, 12001}},
+				Community:    [][]uint32{{57695, 12000}, {57695, 12001}},
 				Origin:       "igp",
-				DigestedPath: []int32{int32(57695), int32(37650)},
+				DigestedPath: []uint32{uint32(57695), uint32(37650)},
+				OriginASN:    37650,
 				Announcements: []*RisAnnouncement{
 					&RisAnnouncement{
 						NextHop:  "196.60.9.165",
@@ -539,9 +1238,10 @@ func TestListen(t *testing.T) {
 				Host:         "rrc07",
 				Type:         "UPDATE",
 				Path:         []interface{}{float64(24482), float64(6453), float64(174), float64(513), float64(513), float64(12654)},
-				Community:    [][]int32{{6453, 86}, {6453, 1000}, {6453, 1400}, {6453, 1402}, {6453, 2000}, {6453, 4000}, {24482, 1}, {24482, 12020}, {24482, 12021}, {24482, 20200}, {24482, 20300}, {24482, 64601}},
+				Community:    [][]uint32{{6453, 86}, {6453, 1000}, {6453, 1400}, {6453, 1402}, {6453, 2000}, {6453, 4000}, {24482, 1}, {24482, 12020}, {24482, 12021}, {24482, 20200}, {24482, 20300}, {24482, 64601}},
 				Origin:       "igp",
-				DigestedPath: []int32{int32(24482), int32(6453), int32(174), int32(513), int32(513), int32(12654)},
+				DigestedPath: []uint32{uint32(24482), uint32(6453), uint32(174), uint32(513), uint32(513), uint32(12654)},
+				OriginASN:    12654,
 				Announcements: []*RisAnnouncement{
 					&RisAnnouncement{
 						NextHop:  "2001:7f8:d:ff::226",
@@ -554,6 +1254,23 @@ func TestListen(t *testing.T) {
 				},
 				Raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00AD02000000964001010040021A020600005FA200001935000000AE00000201000002010000316E800404000007D4C007080000FD090A1DA9C0C0083019350056193503E8193505781935057A193507D019350FA05FA200015FA22EF45FA22EF55FA24EE85FA24F4C5FA2FC59900E002C00020120200107F8000D00FF0000000000000226FE8000000000000002A0A500000003E60030200107FBFE04"},
 		},
+	}, {
+		desc:   "Successful read of 3rd message, a withdrawal",
+		file:   proto.String("testdata/10-msg"),
+		recNum: 2,
+		want: RisMessage{
+			Type: "ris_message",
+			Data: &RisMessageData{
+				Timestamp:    1.55862004709e+09,
+				Peer:         "2001:43f8:6d0::9:165",
+				PeerASN:      "57695",
+				ID:           "2001:43f8:6d0::9:165-1558620047.09-7571535",
+				Host:         "rrc19",
+				Type:         "UPDATE",
+				DigestedPath: []uint32{},
+				Withdrawals:  []string{"2001:7fb:fe0d::/48"},
+				Raw:          "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF0024020000000D800F0A00020130200107FBFE0D",
+			}},
 	}, {
 		desc:   "Fail reading an as-set in path",
 		file:   proto.String("testdata/fail-as-set"),
@@ -568,7 +1285,9 @@ func TestListen(t *testing.T) {
 				Host:         "rrc11",
 				Type:         "UPDATE",
 				Path:         []interface{}{float64(2497), float64(6453), float64(18705), float64(26281), []interface{}{float64(13340)}},
-				DigestedPath: []int32{int32(2497), int32(6453), int32(18705), int32(26281), int32(13340)},
+				DigestedPath: []uint32{uint32(2497), uint32(6453), uint32(18705), uint32(26281), uint32(13340)},
+				OriginASN:    13340,
+				OriginSet:    []uint32{13340},
 				Origin:       "incomplete",
 				Announcements: []*RisAnnouncement{
 					&RisAnnouncement{
@@ -589,9 +1308,10 @@ func TestListen(t *testing.T) {
 			f = proto.String("")
 		}
 		r := &RisLive{
-			File:   f,
-			Filter: &RisFilter{},
-			Chan:   make(chan RisMessage, 10),
+			File:       f,
+			Filter:     &RisFilter{},
+			Chan:       make(chan RisMessage, 10),
+			IncludeRaw: true,
 		}
 		if test.remote {
 			ts := testServer(*test.file)
@@ -621,9 +1341,18 @@ func TestGet(t *testing.T) {
 		desc: "Success simple filter: prefix",
 		filter: &RisFilter{
 			Prefix:           []string{"196.50.70.0/24"},
-			ASPath:           []int32{int32(57695)},
+			ASPath:           []uint32{uint32(57695)},
 			Origins:          []string{"37650"},
-			InvalidTransitAS: map[int32]bool{int32(57695): true},
+			InvalidTransitAS: map[uint32]bool{uint32(57695): true},
+		},
+		file: "testdata/1-msg",
+		want: "Message(1): Peer/ASN -> 196.60.9.165/57695 Prefix1: 196.50.70.0/24\n",
+	}, {
+		desc: "Success BGP origin attribute is not an origin ASN",
+		filter: &RisFilter{
+			Prefix:           []string{"196.50.70.0/24"},
+			Origins:          []string{"igp"},
+			InvalidTransitAS: map[uint32]bool{uint32(57695): true},
 		},
 		file: "testdata/1-msg",
 		want: "Done",
@@ -642,3 +1371,1877 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+// Each of these once called log.Fatalf, exiting the test binary.
+func TestListenErrorsReturn(t *testing.T) {
+	tests := []struct {
+		desc      string
+		url       string
+		file      string
+		wantError string
+	}{{
+		desc:      "Request can not be built",
+		url:       "http://[::1",
+		file:      "",
+		wantError: "failed to create new request to ris-live url=http://[::1 error=",
+	}, {
+		desc:      "File can not be read",
+		file:      "testdata/no-such-file",
+		wantError: "failed to read risFile file=testdata/no-such-file error=",
+	}}
+
+	for _, test := range tests {
+		l := &recordLogger{}
+		r := &RisLive{
+			URL:  proto.String(test.url),
+			File: proto.String(test.file),
+			UA:   proto.String("test"),
+			Chan: make(chan RisMessage, 1),
+		}
+		WithLogger(l)(r)
+		done := make(chan struct{})
+		go func() {
+			r.Listen()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("[%v]: Listen did not return", test.desc)
+		}
+		if _, ok := <-r.Chan; ok {
+			t.Errorf("[%v]: got a message, wanted Chan closed", test.desc)
+		}
+		if len(l.errors) != 1 || !strings.HasPrefix(l.errors[0], test.wantError) {
+			t.Errorf("[%v]: got/want mismatch: got errors %q wanted one starting %q", test.desc, l.errors, test.wantError)
+		}
+	}
+}
+
+func TestListenTruncated(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/truncated"),
+		Chan: make(chan RisMessage, 10),
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return at the truncated message")
+	}
+
+	var got int
+	for range r.Chan {
+		got++
+	}
+	if got != 2 {
+		t.Errorf("got/want mismatch: got %v messages wanted 2", got)
+	}
+}
+
+func TestListenMalformed(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/malformed"),
+		Chan: make(chan RisMessage, 10),
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return, spinning on the malformed message")
+	}
+
+	var got []string
+	for rm := range r.Chan {
+		got = append(got, rm.Data.ID)
+	}
+	// The syntax error and the mistyped timestamp are skipped, the messages
+	// either side of them read.
+	want := []string{
+		"196.60.9.165-1558620047.08-11924763",
+		"2001:43f8:6d0::9:165-1558620047.08-7571534",
+		"2001:43f8:6d0::9:165-1558620047.09-7571536",
+		"194.68.123.226-1558620047.06-107294710",
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch:\n%v\n", cmp.Diff(got, want))
+	}
+}
+
+// A bad line is skipped whole, so it is decoded, and its error logged, once.
+func TestListenBadLineLoggedOnce(t *testing.T) {
+	const good = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"good"}}`
+	tests := []struct {
+		desc string
+		body string
+	}{{
+		desc: "Bad line between messages",
+		body: good + "\n" + `{"type":"ris_message",,"id":"bad"}}` + "\n" + good + "\n",
+	}, {
+		desc: "Bad line after blank lines",
+		body: good + "\n\n\n" + `{"type":"ris_message",,"id":"bad"}}` + "\n" + good + "\n",
+	}, {
+		desc: "Bad first line",
+		body: `{"type":"ris_message",,"id":"bad"}}` + "\n" + good + "\n" + good + "\n",
+	}}
+
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "bad-line")
+		if err := ioutil.WriteFile(file, []byte(test.body), 0644); err != nil {
+			t.Fatalf("[%v]: failed to write fixture: %v", test.desc, err)
+		}
+		h := &recordHandler{}
+		r := &RisLive{File: proto.String(file), Chan: make(chan RisMessage, 10)}
+		WithSlog(slog.New(h))(r)
+		r.Listen()
+		errors := 0
+		for _, rec := range h.records {
+			if rec.Message == "bad json content" {
+				errors++
+			}
+		}
+		if errors != 1 {
+			t.Errorf("[%v]: got/want mismatch: got %v decode errors logged wanted 1", test.desc, errors)
+		}
+		if r.Records != 2 {
+			t.Errorf("[%v]: got/want mismatch: got %v records wanted 2", test.desc, r.Records)
+		}
+	}
+}
+
+func TestListenDropOnFull(t *testing.T) {
+	tests := []struct {
+		desc        string
+		buffer      int
+		wantDropped int64
+	}{{
+		desc:        "Buffer of one, nine dropped",
+		buffer:      1,
+		wantDropped: 9,
+	}, {
+		desc:        "Buffer holds every message, none dropped",
+		buffer:      10,
+		wantDropped: 0,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:       proto.String("testdata/10-msg"),
+			Chan:       make(chan RisMessage, test.buffer),
+			DropOnFull: true,
+		}
+		// Nothing drains Chan, without DropOnFull Listen would block.
+		r.Listen()
+		if got := r.Dropped(); got != test.wantDropped {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.wantDropped)
+		}
+		if got := int64(len(r.Chan)); got+r.Dropped() != r.Records {
+			t.Errorf("[%v]: queued(%v) and dropped(%v) messages do not add up to records read(%v)",
+				test.desc, got, r.Dropped(), r.Records)
+		}
+	}
+}
+
+func TestBytesRead(t *testing.T) {
+	tests := []struct {
+		desc string
+		file string
+	}{{
+		desc: "Ten messages",
+		file: "testdata/10-msg",
+	}, {
+		desc: "A thousand messages",
+		file: "testdata/1k-msgs",
+	}, {
+		desc: "Malformed messages, skipped bytes are still read",
+		file: "testdata/malformed",
+	}}
+
+	for _, test := range tests {
+		fi, err := os.Stat(test.file)
+		if err != nil {
+			t.Fatalf("[%v]: failed to stat the fixture: %v", test.desc, err)
+		}
+		r := &RisLive{File: proto.String(test.file)}
+		sub := r.Subscribe()
+		go func() {
+			for range sub {
+			}
+		}()
+		r.Listen()
+		if got := r.BytesRead(); got != fi.Size() {
+			t.Errorf("[%v]: got/want mismatch: got %v bytes wanted %v", test.desc, got, fi.Size())
+		}
+	}
+}
+
+func TestHighWatermark(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/10-msg"),
+		Chan: make(chan RisMessage, 20),
+	}
+	// Nothing is drained, the channel fills to the ten messages in the file.
+	r.Listen()
+	if got, want := r.HighWatermark(), 10; got != want {
+		t.Errorf("got/want mismatch: got %v wanted %v", got, want)
+	}
+
+	// Draining doesn't lower the mark.
+	for range r.Chan {
+	}
+	if got, want := r.HighWatermark(), 10; got != want {
+		t.Errorf("after draining got/want mismatch: got %v wanted %v", got, want)
+	}
+}
+
+// Run with -race, two subscribers consume the stream concurrently.
+func TestSubscribe(t *testing.T) {
+	r := &RisLive{File: proto.String("testdata/10-msg")}
+	subs := []<-chan RisMessage{r.Subscribe(), r.Subscribe()}
+
+	got := make([][]string, len(subs))
+	var wg sync.WaitGroup
+	for i, c := range subs {
+		wg.Add(1)
+		go func(i int, c <-chan RisMessage) {
+			defer wg.Done()
+			for rm := range c {
+				got[i] = append(got[i], rm.Data.ID)
+			}
+		}(i, c)
+	}
+	r.Listen()
+	wg.Wait()
+
+	if len(got[0]) != 10 {
+		t.Errorf("got/want mismatch: got %v messages wanted 10", len(got[0]))
+	}
+	if !cmp.Equal(got[0], got[1]) {
+		t.Errorf("subscribers saw different messages:\n%v\n", cmp.Diff(got[0], got[1]))
+	}
+}
+
+// Run with -race, the filter is replaced while Get consumes the stream.
+// A filter assigned directly is compiled once, not for every message.
+func TestPrepareCachesLiteralFilter(t *testing.T) {
+	r := &RisLive{Filter: &RisFilter{Prefix: []string{"192.0.2.0/24"}}}
+	first := r.prepare()
+	if got := r.prepare(); got != first {
+		t.Errorf("got the filter compiled again, wanted the compiled filter kept")
+	}
+	r.Filter = &RisFilter{Prefix: []string{"198.51.100.0/24"}}
+	second := r.prepare()
+	if second == first || second.filter != r.Filter {
+		t.Errorf("got the old compiled filter after Filter was replaced")
+	}
+}
+
+func TestSetFilter(t *testing.T) {
+	r := &RisLive{
+		File:   proto.String("testdata/1k-msgs"),
+		Filter: &RisFilter{Origins: []string{"no-such-origin"}},
+		Chan:   make(chan RisMessage, 10),
+	}
+	go r.Listen()
+
+	done := make(chan string)
+	go func() {
+		done <- r.Get(nil)
+	}()
+
+	var want *RisFilter
+	for i := 0; i < 100; i++ {
+		want = &RisFilter{Origins: []string{fmt.Sprintf("no-such-origin-%d", i)}}
+		r.SetFilter(want)
+	}
+
+	if got := <-done; got != "Done" {
+		t.Errorf("got/want mismatch from Get, got: %q want: %q", got, "Done")
+	}
+	if got := r.prepare().filter; got != want {
+		t.Errorf("got/want mismatch on filter, got: %+v want: %+v", got, want)
+	}
+}
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		desc string
+		ts   float64
+		want time.Time
+	}{{
+		desc: "Success whole seconds",
+		ts:   1558620047,
+		want: time.Unix(1558620047, 0),
+	}, {
+		desc: "Success fractional seconds",
+		ts:   1558620047.5,
+		want: time.Unix(1558620047, 500000000),
+	}}
+
+	for _, test := range tests {
+		got := (&RisMessageData{Timestamp: test.ts}).Time()
+		if !got.Equal(test.want) {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestRawBytes(t *testing.T) {
+	tests := []struct {
+		desc    string
+		raw     string
+		wantLen int
+		wantErr bool
+	}{{
+		// The 6th message of testdata/10-msg.
+		desc:    "Success decode",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00AD02000000964001010040021A020600005FA200001935000000AE00000201000002010000316E800404000007D4C007080000FD090A1DA9C0C0083019350056193503E8193505781935057A193507D019350FA05FA200015FA22EF45FA22EF55FA24EE85FA24F4C5FA2FC59900E002C00020120200107F8000D00FF0000000000000226FE8000000000000002A0A500000003E60030200107FBFE04",
+		wantLen: 0xAD,
+	}, {
+		desc:    "Failure not hex",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFZZ",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := (&RisMessageData{Raw: test.raw}).RawBytes()
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			// A BGP message: 16 byte marker, 2 byte length, 1 byte type (2, UPDATE).
+			if len(got) != test.wantLen {
+				t.Errorf("[%v]: got/want length mismatch, got: %v want: %v", test.desc, len(got), test.wantLen)
+			}
+			if hdrLen := int(got[16])<<8 | int(got[17]); hdrLen != len(got) {
+				t.Errorf("[%v]: header length %v does not match decoded length %v", test.desc, hdrLen, len(got))
+			}
+			if got[18] != 2 {
+				t.Errorf("[%v]: got message type %v want UPDATE(2)", test.desc, got[18])
+			}
+		}
+	}
+}
+
+func TestListenReplaySpeed(t *testing.T) {
+	// Two messages one second apart.
+	content := `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}
+{"type":"ris_message","data":{"timestamp":1558620048.0,"id":"msg-2"}}
+`
+	file := filepath.Join(t.TempDir(), "2-msg")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	tests := []struct {
+		desc     string
+		speed    float64
+		min, max time.Duration
+	}{{
+		desc:  "Success ten times real time",
+		speed: 10,
+		min:   90 * time.Millisecond,
+		max:   time.Second,
+	}, {
+		desc:  "Success as fast as possible",
+		speed: 0,
+		min:   0,
+		max:   90 * time.Millisecond,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:        proto.String(file),
+			Filter:      &RisFilter{},
+			Chan:        make(chan RisMessage, 10),
+			ReplaySpeed: test.speed,
+		}
+		go r.Listen()
+		<-r.Chan
+		start := time.Now()
+		<-r.Chan
+		if got := time.Since(start); got < test.min || got > test.max {
+			t.Errorf("[%v]: got gap between messages of %v, want between %v and %v", test.desc, got, test.min, test.max)
+		}
+	}
+}
+
+func TestCheckRequire(t *testing.T) {
+	announcement := NewTestMessage([]uint32{64500, 64501}, "igp", "192.0.2.0/24").Data
+	withdrawal := &RisMessageData{Type: "UPDATE", Withdrawals: []string{"192.0.2.0/24"}}
+	community := NewTestMessage([]uint32{64500, 64501}, "igp", "192.0.2.0/24").Data
+	community.Community = [][]uint32{{64500, 666}}
+
+	tests := []struct {
+		desc    string
+		require []string
+		msg     *RisMessageData
+		want    bool
+	}{{
+		desc:    "Success announcements required and present",
+		require: []string{"announcements"},
+		msg:     announcement,
+		want:    true,
+	}, {
+		desc:    "Success announcements required and absent",
+		require: []string{"announcements"},
+		msg:     withdrawal,
+		want:    false,
+	}, {
+		desc:    "Success withdrawals required and present",
+		require: []string{"withdrawals"},
+		msg:     withdrawal,
+		want:    true,
+	}, {
+		desc:    "Success community required and absent",
+		require: []string{"community"},
+		msg:     announcement,
+		want:    false,
+	}, {
+		desc:    "Success announcements and community required and present",
+		require: []string{"announcements", "community"},
+		msg:     community,
+		want:    true,
+	}, {
+		desc: "Success nothing required",
+		msg:  withdrawal,
+		want: true,
+	}, {
+		desc:    "Success unknown key ignored",
+		require: []string{"aggregator"},
+		msg:     withdrawal,
+		want:    true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{Require: test.require}}
+		if got := r.CheckRequire(test.msg); got != test.want {
+			t.Errorf("[%v]: got(%v)/want(%v) mismatch", test.desc, got, test.want)
+		}
+	}
+}
+
+func BenchmarkMatchASPath(b *testing.B) {
+	rm := NewTestMessage([]uint32{64496, 3356, 1299, 174, 13335}, "igp", "192.168.1.0/24")
+	path := []uint32{3356, 1299, 174}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rm.Data.MatchASPath(path)
+	}
+}
+
+// BenchmarkListenFile decodes and filters the thousand message fixture, each
+// iteration reading the whole file.
+func BenchmarkListenFile(b *testing.B) {
+	const file = "testdata/1k-msgs"
+	fi, err := os.Stat(file)
+	if err != nil {
+		b.Fatalf("failed to stat the fixture: %v", err)
+	}
+	f := benchmarkFilter(1000)
+	f.InvalidTransitAS = map[uint32]bool{65000: true}
+
+	b.SetBytes(fi.Size())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer := 100
+		r := NewRisLive(nil, proto.String(file), nil, f, &buffer)
+		go r.Listen()
+		for r.Get(nil) != "Done" {
+		}
+	}
+}
+
+func BenchmarkDigestPath(b *testing.B) {
+	rmd := &RisMessageData{Path: []interface{}{
+		float64(64496), float64(3356), float64(3356), float64(1299), float64(174),
+		float64(6939), float64(13335), []interface{}{float64(64511), float64(64512)},
+	}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := digestPath(rmd); err != nil {
+			b.Fatalf("failed to digest the path: %v", err)
+		}
+	}
+}
+
+func TestRisMessageString(t *testing.T) {
+	fd, err := os.Open("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to open the fixture: %v", err)
+	}
+	defer fd.Close()
+	dec := json.NewDecoder(fd)
+	var sixth RisMessage
+	for i := 0; i < 6; i++ {
+		sixth = RisMessage{}
+		if err := dec.Decode(&sixth); err != nil {
+			t.Fatalf("failed to decode message %d: %v", i+1, err)
+		}
+	}
+	if err := digestPath(sixth.Data); err != nil {
+		t.Fatalf("failed to digest the path: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		rm   RisMessage
+		want string
+	}{{
+		desc: "The 6th message of testdata/10-msg",
+		rm:   sixth,
+		want: "2019-05-23T14:00:47.06Z 2001:7f8:d:ff::226/AS24482 UPDATE prefix=2001:7fb:fe04::/48 origin=AS12654 path=24482 6453 174 513 513 12654",
+	}, {
+		desc: "Withdrawal ending in an AS_SET",
+		rm: RisMessage{Type: "ris_message", Data: &RisMessageData{
+			Timestamp:   1558620047,
+			Peer:        "192.0.2.1",
+			PeerASN:     "64496",
+			Type:        "UPDATE",
+			Path:        []interface{}{float64(64496), []interface{}{float64(64511), float64(64512)}},
+			OriginASN:   64512,
+			Withdrawals: []string{"192.0.2.0/24"},
+		}},
+		want: "2019-05-23T14:00:47Z 192.0.2.1/AS64496 UPDATE withdrawn=192.0.2.0/24 origin=AS64512 path=64496 {64511,64512}",
+	}, {
+		desc: "No data",
+		rm:   RisMessage{Type: "ris_message"},
+		want: "ris_message",
+	}}
+
+	for _, test := range tests {
+		if got := test.rm.String(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch:\ngot:    %v\nwanted: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCheckMalformed(t *testing.T) {
+	withdrawal := NewTestMessage(nil, "", "192.0.2.0/24").Data
+	withdrawal.Announcements = nil
+	withdrawal.Withdrawals = []string{"192.0.2.0/24"}
+
+	noNextHop := NewTestMessage([]uint32{64496, 64500}, "igp", "192.0.2.0/24").Data
+	noNextHop.Announcements = append(noNextHop.Announcements, &RisAnnouncement{Prefixes: []string{"198.51.100.0/24"}})
+
+	notUpdate := NewTestMessage(nil, "", "192.0.2.0/24").Data
+	notUpdate.Type = "OPEN"
+
+	tests := []struct {
+		desc          string
+		msg           *RisMessageData
+		wantReason    string
+		wantMalformed bool
+	}{{
+		desc: "Success well formed",
+		msg:  NewTestMessage([]uint32{64496, 64500}, "igp", "192.0.2.0/24").Data,
+	}, {
+		desc:          "Success no origin",
+		msg:           NewTestMessage([]uint32{64496, 64500}, "", "192.0.2.0/24").Data,
+		wantReason:    "no origin attribute",
+		wantMalformed: true,
+	}, {
+		desc:          "Success no path",
+		msg:           NewTestMessage(nil, "igp", "192.0.2.0/24").Data,
+		wantReason:    "no AS path",
+		wantMalformed: true,
+	}, {
+		desc:          "Success announcement without a next hop",
+		msg:           noNextHop,
+		wantReason:    "no next hop for [198.51.100.0/24]",
+		wantMalformed: true,
+	}, {
+		desc: "Success withdrawal without attributes",
+		msg:  withdrawal,
+	}, {
+		desc: "Success not an UPDATE",
+		msg:  notUpdate,
+	}}
+
+	r := &RisLive{}
+	for _, test := range tests {
+		reason, malformed := r.CheckMalformed(test.msg)
+		if reason != test.wantReason || malformed != test.wantMalformed {
+			t.Errorf("[%v]: got/want mismatch: got (%q, %v) wanted (%q, %v)",
+				test.desc, reason, malformed, test.wantReason, test.wantMalformed)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	// The server echoes the User-Agent back as the ID of a message.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"type":"ris_message","data":{"id":%q}}`+"\n", r.UserAgent())
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		desc string
+		ua   *string
+		want *regexp.Regexp
+	}{{
+		desc: "Default names the client and versions",
+		want: regexp.MustCompile(`^golang-rislive-morrowc/\d+\.\d+\.\d+ \(go.+\)$`),
+	}, {
+		desc: "Empty is the default",
+		ua:   proto.String(""),
+		want: regexp.MustCompile(`^golang-rislive-morrowc/` + regexp.QuoteMeta(Version) + ` \(` + regexp.QuoteMeta(runtime.Version()) + `\)$`),
+	}, {
+		desc: "Override",
+		ua:   proto.String("my-monitor/2.0"),
+		want: regexp.MustCompile(`^my-monitor/2\.0$`),
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			URL:  &ts.URL,
+			File: proto.String(""),
+			UA:   test.ua,
+			Chan: make(chan RisMessage, 1),
+		}
+		r.Listen()
+		rm, ok := <-r.Chan
+		if !ok {
+			t.Errorf("[%v]: got no message from the server", test.desc)
+			continue
+		}
+		if !test.want.MatchString(rm.Data.ID) {
+			t.Errorf("[%v]: got User-Agent %q wanted to match %v", test.desc, rm.Data.ID, test.want)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/10-msg"),
+		Chan: make(chan RisMessage, 20),
+	}
+	// The subscriber sees every message, in the order read.
+	sub := r.Subscribe()
+	r.Listen()
+	var want []string
+	for rm := range sub {
+		want = append(want, rm.Data.ID)
+	}
+
+	// One message is consumed, the rest are left buffered.
+	<-r.Chan
+	var got []string
+	for _, rm := range r.Drain() {
+		got = append(got, rm.Data.ID)
+	}
+	if !cmp.Equal(got, want[1:]) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want[1:]))
+	}
+	if left := r.Drain(); len(left) != 0 {
+		t.Errorf("got %v messages draining a second time, wanted none", len(left))
+	}
+}
+
+func TestClose(t *testing.T) {
+	// The server streams messages until the client goes away.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, `{"type":"ris_message","data":{"id":"msg-%d"}}`+"\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		desc        string
+		closeFirst  bool
+		wantDrained []string
+	}{{
+		desc:        "Close while Listen waits on a full channel",
+		wantDrained: []string{"msg-0", "msg-1", "msg-2"},
+	}, {
+		desc:       "Close before Listen",
+		closeFirst: true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			URL:  &ts.URL,
+			File: proto.String(""),
+			Chan: make(chan RisMessage, 3),
+		}
+		if test.closeFirst {
+			r.Close()
+		}
+		done := make(chan struct{})
+		go func() {
+			r.Listen()
+			close(done)
+		}()
+		if !test.closeFirst {
+			// Nothing reads Chan, Listen fills it then waits.
+			for len(r.Chan) < cap(r.Chan) {
+				time.Sleep(time.Millisecond)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("[%v]: got error closing: %v", test.desc, err)
+			}
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("[%v]: Listen did not return after Close", test.desc)
+		}
+
+		var got []string
+		for _, rm := range r.Drain() {
+			got = append(got, rm.Data.ID)
+		}
+		if !cmp.Equal(got, test.wantDrained) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.wantDrained))
+		}
+		if _, ok := <-r.Chan; ok {
+			t.Errorf("[%v]: got a message, wanted Chan closed", test.desc)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("[%v]: got error closing a second time: %v", test.desc, err)
+		}
+	}
+}
+
+func TestListenIncludeRaw(t *testing.T) {
+	// A message sent without raw, as RIS Live does when asked not to.
+	const noRaw = `{"type":"ris_message","data":{"timestamp":1558620047.08,"peer":"196.60.9.165","peer_asn":"57695",` +
+		`"id":"no-raw","host":"rrc19","type":"UPDATE","path":[57695,37650],"origin":"igp",` +
+		`"announcements":[{"next_hop":"196.60.9.165","prefixes":["196.50.70.0/24"]}]}}` + "\n"
+	file := filepath.Join(t.TempDir(), "no-raw")
+	if err := ioutil.WriteFile(file, []byte(noRaw), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	tests := []struct {
+		desc       string
+		file       string
+		includeRaw bool
+		wantRaw    bool
+	}{{
+		desc: "Message without raw decodes",
+		file: file,
+	}, {
+		desc:       "Message without raw decodes, raw included",
+		file:       file,
+		includeRaw: true,
+	}, {
+		desc: "Raw dropped by default",
+		file: "testdata/1-msg",
+	}, {
+		desc:       "Raw kept when included",
+		file:       "testdata/1-msg",
+		includeRaw: true,
+		wantRaw:    true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:       proto.String(test.file),
+			Chan:       make(chan RisMessage, 1),
+			IncludeRaw: test.includeRaw,
+		}
+		r.Listen()
+		rm, ok := <-r.Chan
+		if !ok {
+			t.Errorf("[%v]: got no message", test.desc)
+			continue
+		}
+		if len(rm.Data.Announcements) != 1 || len(rm.Data.DigestedPath) != 2 {
+			t.Errorf("[%v]: message not fully decoded: %v", test.desc, rm.Data)
+		}
+		if got := rm.Data.Raw != ""; got != test.wantRaw {
+			t.Errorf("[%v]: got/want mismatch on raw kept: got %v wanted %v", test.desc, got, test.wantRaw)
+		}
+	}
+}
+
+func TestCheckLargeCommunities(t *testing.T) {
+	r := &RisLive{File: proto.String("testdata/large-communities"), Chan: make(chan RisMessage, 10)}
+	r.Listen()
+	msgs := map[string]*RisMessageData{}
+	for rm := range r.Chan {
+		msgs[rm.Data.ID] = rm.Data
+	}
+
+	// Standard and large communities decode side by side.
+	if got, want := msgs["both"].Community, [][]uint32{{57695, 12000}}; !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch on standard communities: got %v wanted %v", got, want)
+	}
+	if got, want := msgs["both"].LargeCommunity, [][3]uint32{{4200000000, 4294967295, 1}}; !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch on large communities: got %v wanted %v", got, want)
+	}
+
+	tests := []struct {
+		desc   string
+		filter [][3]uint32
+		id     string
+		want   bool
+	}{{
+		desc:   "Large community carried",
+		filter: [][3]uint32{{64500, 100, 200}},
+		id:     "large",
+		want:   true,
+	}, {
+		desc:   "Any one of several",
+		filter: [][3]uint32{{1, 1, 1}, {57695, 1, 2}},
+		id:     "large",
+		want:   true,
+	}, {
+		desc:   "Large community not carried",
+		filter: [][3]uint32{{57695, 1, 3}},
+		id:     "large",
+		want:   false,
+	}, {
+		desc:   "Standard communities are not large communities",
+		filter: [][3]uint32{{57695, 12000, 0}},
+		id:     "standard",
+		want:   false,
+	}, {
+		desc:   "Message with both, 32 bit values",
+		filter: [][3]uint32{{4200000000, 4294967295, 1}},
+		id:     "both",
+		want:   true,
+	}, {
+		desc: "Not set",
+		id:   "standard",
+		want: true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{LargeCommunities: test.filter}}
+		if got := r.CheckLargeCommunities(msgs[test.id]); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCaptureTo(t *testing.T) {
+	ts := testServer("testdata/10-msg")
+	defer ts.Close()
+
+	var capture bytes.Buffer
+	buffer := 20
+	r := NewRisLive(&ts.URL, proto.String(""), nil, nil, &buffer, CaptureTo(&capture))
+	r.Listen()
+	var live []RisMessage
+	for rm := range r.Chan {
+		live = append(live, rm)
+	}
+	if len(live) != 10 {
+		t.Fatalf("got/want mismatch: got %v messages from the server wanted 10", len(live))
+	}
+
+	// The capture replays as the same messages.
+	file := filepath.Join(t.TempDir(), "capture")
+	if err := ioutil.WriteFile(file, capture.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write the capture: %v", err)
+	}
+	r = NewRisLive(nil, proto.String(file), nil, nil, &buffer)
+	r.Listen()
+	var replayed []RisMessage
+	for rm := range r.Chan {
+		replayed = append(replayed, rm)
+	}
+	if !cmp.Equal(replayed, live) {
+		t.Errorf("replayed capture differs diff(-got, +want):\n%v\n", cmp.Diff(replayed, live))
+	}
+	if got := int64(capture.Len()); got != r.BytesRead() {
+		t.Errorf("got/want mismatch: captured %v bytes, replay read %v", got, r.BytesRead())
+	}
+}
+
+func TestKeyEqual(t *testing.T) {
+	noID := func(path []uint32, prefixes ...string) *RisMessageData {
+		rmd := NewTestMessage(path, "igp", prefixes...).Data
+		rmd.ID = ""
+		return rmd
+	}
+	reordered := noID([]uint32{3356, 64500}, "198.51.100.0/24", "192.0.2.0/24")
+	otherPeer := NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data
+	otherPeer.Peer = "192.0.2.2"
+
+	tests := []struct {
+		desc      string
+		a, b      *RisMessageData
+		wantKey   bool
+		wantEqual bool
+	}{{
+		desc:      "Identical",
+		a:         NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		b:         NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		wantKey:   true,
+		wantEqual: true,
+	}, {
+		desc:    "Same ID, other fields differ",
+		a:       NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		b:       otherPeer,
+		wantKey: true,
+	}, {
+		desc: "Different ID",
+		a:    NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		b: func() *RisMessageData {
+			rmd := NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data
+			rmd.ID = "192.0.2.1-1558620047.08-2"
+			return rmd
+		}(),
+	}, {
+		desc: "Empty lists equal unset ones",
+		a:    NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		b: func() *RisMessageData {
+			rmd := NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data
+			rmd.Withdrawals = []string{}
+			rmd.Community = [][]uint32{}
+			rmd.LargeCommunity = [][3]uint32{}
+			rmd.OriginSet = []uint32{}
+			return rmd
+		}(),
+		wantKey:   true,
+		wantEqual: true,
+	}, {
+		desc:    "No ID, prefixes in another order",
+		a:       noID([]uint32{3356, 64500}, "192.0.2.0/24", "198.51.100.0/24"),
+		b:       reordered,
+		wantKey: true,
+	}, {
+		desc: "No ID, different path",
+		a:    noID([]uint32{3356, 64500}, "192.0.2.0/24"),
+		b:    noID([]uint32{174, 64500}, "192.0.2.0/24"),
+	}, {
+		desc: "No ID, different origin",
+		a:    noID([]uint32{3356, 64500}, "192.0.2.0/24"),
+		b:    noID([]uint32{3356, 64501}, "192.0.2.0/24"),
+	}, {
+		desc: "No ID, different prefix",
+		a:    noID([]uint32{3356, 64500}, "192.0.2.0/24"),
+		b:    noID([]uint32{3356, 64500}, "192.0.2.0/25"),
+	}}
+
+	for _, test := range tests {
+		if got := test.a.Key() == test.b.Key(); got != test.wantKey {
+			t.Errorf("[%v]: got/want mismatch on keys equal: got %v wanted %v (%q, %q)",
+				test.desc, got, test.wantKey, test.a.Key(), test.b.Key())
+		}
+		if got := test.a.Equal(test.b); got != test.wantEqual {
+			t.Errorf("[%v]: got/want mismatch on Equal: got %v wanted %v", test.desc, got, test.wantEqual)
+		}
+		if got := test.b.Equal(test.a); got != test.wantEqual {
+			t.Errorf("[%v]: got/want mismatch on reversed Equal: got %v wanted %v", test.desc, got, test.wantEqual)
+		}
+	}
+
+	var null *RisMessageData
+	if !null.Equal(nil) {
+		t.Errorf("nil messages are not Equal")
+	}
+	if null.Equal(otherPeer) {
+		t.Errorf("nil message is Equal to a message")
+	}
+}
+
+func TestCheckOriginAttr(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter []string
+		origin string
+		want   bool
+	}{{
+		desc:   "Match igp",
+		filter: []string{"igp"},
+		origin: "igp",
+		want:   true,
+	}, {
+		desc:   "Match incomplete, redistributed",
+		filter: []string{"incomplete"},
+		origin: "incomplete",
+		want:   true,
+	}, {
+		desc:   "igp is not incomplete",
+		filter: []string{"incomplete"},
+		origin: "igp",
+		want:   false,
+	}, {
+		desc:   "Any one of several",
+		filter: []string{"egp", "incomplete"},
+		origin: "egp",
+		want:   true,
+	}, {
+		desc:   "Withdrawal carries no origin",
+		filter: []string{"igp"},
+		origin: "",
+		want:   false,
+	}, {
+		desc:   "Not set",
+		origin: "incomplete",
+		want:   true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{OriginAttr: test.filter}}
+		rm := NewTestMessage([]uint32{3356, 64500}, test.origin, "192.0.2.0/24").Data
+		if got := r.CheckOriginAttr(rm); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestMaxConsecutiveDecodeErrors(t *testing.T) {
+	const html = "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>\n<h1>502 Bad Gateway</h1>\n</body>\n</html>\n"
+	const msg = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}` + "\n"
+
+	t.Run("remote reconnects", func(t *testing.T) {
+		var requests int64
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			fmt.Fprint(w, html)
+			w.(http.Flusher).Flush()
+			// Hold the connection open, as a stream would.
+			<-r.Context().Done()
+		}))
+		defer ts.Close()
+
+		r := &RisLive{
+			URL:                        &ts.URL,
+			File:                       proto.String(""),
+			Chan:                       make(chan RisMessage, 1),
+			MaxConsecutiveDecodeErrors: 3,
+			ReconnectBackoff:           NewBackoff(time.Millisecond, time.Millisecond, 0),
+		}
+		done := make(chan struct{})
+		go func() {
+			r.Listen()
+			close(done)
+		}()
+		deadline := time.After(5 * time.Second)
+		for atomic.LoadInt64(&requests) < 3 {
+			select {
+			case <-deadline:
+				t.Fatalf("got %v requests, wanted reconnects", atomic.LoadInt64(&requests))
+			case <-time.After(time.Millisecond):
+			}
+		}
+		r.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Listen did not return after Close")
+		}
+		// Each request after the first is a reconnect.
+		if got := r.Status().Reconnects; got < 2 {
+			t.Errorf("got %v reconnects in the status, wanted at least 2", got)
+		}
+	})
+
+	tests := []struct {
+		desc        string
+		max         int
+		wantRecords int64
+	}{{
+		desc:        "file given up on",
+		max:         3,
+		wantRecords: 0,
+	}, {
+		desc:        "file read past the bad lines without a limit",
+		max:         0,
+		wantRecords: 1,
+	}, {
+		desc:        "file read past the bad lines within the limit",
+		max:         6,
+		wantRecords: 1,
+	}}
+	file := filepath.Join(t.TempDir(), "html")
+	if err := ioutil.WriteFile(file, []byte(html+msg), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	for _, test := range tests {
+		r := &RisLive{
+			File:                       proto.String(file),
+			Chan:                       make(chan RisMessage, 1),
+			MaxConsecutiveDecodeErrors: test.max,
+		}
+		r.Listen()
+		if r.Records != test.wantRecords {
+			t.Errorf("[%v]: got/want mismatch: got %v records wanted %v", test.desc, r.Records, test.wantRecords)
+		}
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		desc string
+		data *RisMessageData
+		want MessageKind
+	}{{
+		desc: "Announcement",
+		data: &RisMessageData{Type: "UPDATE", Announcements: []*RisAnnouncement{{Prefixes: []string{"192.0.2.0/24"}}}},
+		want: KindAnnouncement,
+	}, {
+		desc: "Withdrawal",
+		data: &RisMessageData{Type: "UPDATE", Withdrawals: []string{"192.0.2.0/24"}},
+		want: KindWithdrawal,
+	}, {
+		desc: "Both",
+		data: &RisMessageData{
+			Type:          "UPDATE",
+			Announcements: []*RisAnnouncement{{Prefixes: []string{"192.0.2.0/24"}}},
+			Withdrawals:   []string{"198.51.100.0/24"},
+		},
+		want: KindBoth,
+	}, {
+		desc: "Empty update",
+		data: &RisMessageData{Type: "UPDATE"},
+		want: KindOther,
+	}, {
+		desc: "Keepalive",
+		data: &RisMessageData{Type: "KEEPALIVE"},
+		want: KindOther,
+	}, {
+		desc: "Type unset judged by the prefixes",
+		data: &RisMessageData{Withdrawals: []string{"192.0.2.0/24"}},
+		want: KindWithdrawal,
+	}}
+
+	for _, test := range tests {
+		if got := test.data.Kind(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestPathString(t *testing.T) {
+	fd, err := ioutil.ReadFile("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var sixth RisMessage
+	if err := json.Unmarshal([]byte(strings.Split(string(fd), "\n")[5]), &sixth); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		data *RisMessageData
+		want string
+	}{{
+		desc: "The 6th message of testdata/10-msg",
+		data: sixth.Data,
+		want: "24482 6453 174 513 513 12654",
+	}, {
+		desc: "Origin AS_SET in braces",
+		data: &RisMessageData{Path: []interface{}{float64(3356), []interface{}{float64(64500), float64(64501)}}},
+		want: "3356 {64500,64501}",
+	}, {
+		desc: "Only an AS_SET",
+		data: &RisMessageData{Path: []interface{}{[]interface{}{float64(64500)}}},
+		want: "{64500}",
+	}, {
+		desc: "AS_SET within the path as sequence",
+		data: &RisMessageData{Path: []interface{}{float64(3356), []interface{}{float64(64500), float64(64501)}, float64(64502)}},
+		want: "3356 64500 64501 64502",
+	}, {
+		desc: "No path",
+		data: &RisMessageData{},
+		want: "",
+	}}
+
+	for _, test := range tests {
+		if err := digestPath(test.data); err != nil {
+			t.Fatalf("[%v]: failed to digest path: %v", test.desc, err)
+		}
+		if got := test.data.PathString(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %q wanted %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	data := &RisMessageData{Path: []interface{}{float64(3356), float64(65546), []interface{}{float64(64500), float64(131074)}}}
+	if err := digestPath(data); err != nil {
+		t.Fatalf("failed to digest path: %v", err)
+	}
+	for asdot, want := range map[bool]string{
+		false: "3356 65546 {64500,131074}",
+		true:  "3356 1.10 {64500,2.2}",
+	} {
+		if got := data.FormatPath(asdot); got != want {
+			t.Errorf("[asdot %v]: got/want mismatch: got %q wanted %q", asdot, got, want)
+		}
+	}
+}
+
+func TestListenContext(t *testing.T) {
+	// The server streams messages until the client goes away.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, `{"type":"ris_message","data":{"id":"msg-%d"}}`+"\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+		}
+	}))
+	defer ts.Close()
+
+	r := &RisLive{
+		URL:  &ts.URL,
+		File: proto.String(""),
+		Chan: make(chan RisMessage, 3),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.ListenContext(ctx)
+		close(done)
+	}()
+	// Nothing reads Chan, Listen fills it then waits.
+	for len(r.Chan) < cap(r.Chan) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen did not return after the context was cancelled")
+	}
+	if got := len(r.Drain()); got != 3 {
+		t.Errorf("got/want mismatch: got %v messages drained wanted 3", got)
+	}
+
+	// A stream which ends first returns without the context being done.
+	r = &RisLive{File: proto.String("testdata/10-msg"), Chan: make(chan RisMessage, 10)}
+	r.ListenContext(context.Background())
+	if r.Records != 10 {
+		t.Errorf("got/want mismatch: got %v records wanted 10", r.Records)
+	}
+}
+
+// A firehose answering 503 is connected to again, after the backoff, until it
+// answers 200.
+func TestHTTPStatusRetry(t *testing.T) {
+	const msg = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}` + "\n"
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= 2 {
+			http.Error(w, "down for maintenance"+strings.Repeat(".", 1000), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, msg)
+	}))
+	defer ts.Close()
+
+	r := &RisLive{
+		URL:              &ts.URL,
+		File:             proto.String(""),
+		Chan:             make(chan RisMessage, 1),
+		ReconnectBackoff: NewBackoff(time.Millisecond, time.Millisecond, 0),
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		r.Close()
+		t.Fatalf("Listen did not return once the firehose answered")
+	}
+
+	if got := atomic.LoadInt64(&requests); got != 3 {
+		t.Errorf("got %v requests, wanted 3", got)
+	}
+	if got := r.End(); got != EndClean {
+		t.Errorf("got end %v, wanted %v", got, EndClean)
+	}
+	if rm := <-r.Chan; rm.Data == nil || rm.Data.ID != "msg-1" {
+		t.Errorf("got message %+v, wanted msg-1", rm.Data)
+	}
+	status := r.Status()
+	if status.Reconnects != 2 {
+		t.Errorf("got %v reconnects, wanted 2", status.Reconnects)
+	}
+	want := fmt.Sprintf("ris live returned 503 Service Unavailable: %q", "down for maintenance"+strings.Repeat(".", statusSnippet-20))
+	if status.LastHTTPError != want {
+		t.Errorf("got/want mismatch: got %v wanted %v", status.LastHTTPError, want)
+	}
+}
+
+// Only rate limiting and server errors are retried, any other 4xx is a bad
+// URL or client which would fail again.
+func TestHTTPStatusRetryCodes(t *testing.T) {
+	const msg = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}` + "\n"
+	tests := []struct {
+		code         int
+		wantRequests int64
+		wantEnd      EndStatus
+	}{
+		{code: http.StatusTooManyRequests, wantRequests: 2, wantEnd: EndClean},
+		{code: http.StatusInternalServerError, wantRequests: 2, wantEnd: EndClean},
+		{code: http.StatusBadGateway, wantRequests: 2, wantEnd: EndClean},
+		{code: http.StatusBadRequest, wantRequests: 1, wantEnd: EndHTTPStatus},
+		{code: http.StatusUnauthorized, wantRequests: 1, wantEnd: EndHTTPStatus},
+		{code: http.StatusForbidden, wantRequests: 1, wantEnd: EndHTTPStatus},
+		{code: http.StatusNotFound, wantRequests: 1, wantEnd: EndHTTPStatus},
+	}
+
+	for _, test := range tests {
+		var requests int64
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt64(&requests, 1) == 1 {
+				http.Error(w, http.StatusText(test.code), test.code)
+				return
+			}
+			fmt.Fprint(w, msg)
+		}))
+		r := &RisLive{
+			URL:              &ts.URL,
+			File:             proto.String(""),
+			Chan:             make(chan RisMessage, 1),
+			ReconnectBackoff: NewBackoff(time.Millisecond, time.Millisecond, 0),
+		}
+		done := make(chan struct{})
+		go func() {
+			r.Listen()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			r.Close()
+			t.Fatalf("[%v]: Listen did not return", test.code)
+		}
+		ts.Close()
+		if got := atomic.LoadInt64(&requests); got != test.wantRequests {
+			t.Errorf("[%v]: got/want mismatch: got %v requests wanted %v", test.code, got, test.wantRequests)
+		}
+		if end := r.End(); end != test.wantEnd {
+			t.Errorf("[%v]: got/want mismatch: got end %v wanted %v", test.code, end, test.wantEnd)
+		}
+		if got := r.Status().LastHTTPError; !strings.Contains(got, fmt.Sprint(test.code)) {
+			t.Errorf("[%v]: got last http error %q, wanted it to name the status", test.code, got)
+		}
+	}
+}
+
+// repeatReader reads the byte b endlessly.
+type repeatReader byte
+
+func (b repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	msg := func(id string) string {
+		return `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"` + id + `"}}` + "\n"
+	}
+	// body is a message, one with a raw of size bytes, and a message after
+	// it unless the big one is cut short.
+	body := func(size int64, cut bool) io.Reader {
+		parts := []io.Reader{
+			strings.NewReader(msg("msg-1")),
+			strings.NewReader(`{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"big","raw":"`),
+			io.LimitReader(repeatReader('a'), size),
+		}
+		if !cut {
+			parts = append(parts, strings.NewReader(`"}}`+"\n"), strings.NewReader(msg("msg-2")))
+		}
+		return io.MultiReader(parts...)
+	}
+
+	tests := []struct {
+		desc    string
+		max     int
+		size    int64
+		cut     bool
+		want    []string
+		wantEnd EndStatus
+	}{{
+		desc:    "Success under the default",
+		size:    1 << 10,
+		want:    []string{"msg-1", "big", "msg-2"},
+		wantEnd: EndClean,
+	}, {
+		desc:    "Over the default skipped",
+		size:    64 << 20,
+		want:    []string{"msg-1", "msg-2"},
+		wantEnd: EndClean,
+	}, {
+		desc:    "Over the default, never ending",
+		size:    64 << 20,
+		cut:     true,
+		want:    []string{"msg-1"},
+		wantEnd: EndTrailingGarbage,
+	}, {
+		desc:    "Over a set size skipped",
+		max:     512,
+		size:    1 << 10,
+		want:    []string{"msg-1", "msg-2"},
+		wantEnd: EndClean,
+	}, {
+		desc:    "Success unbounded",
+		max:     -1,
+		size:    2 << 20,
+		want:    []string{"msg-1", "big", "msg-2"},
+		wantEnd: EndClean,
+	}}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, body(test.size, test.cut))
+		}))
+		r := &RisLive{
+			URL:            &ts.URL,
+			File:           proto.String(""),
+			Chan:           make(chan RisMessage, 10),
+			MaxMessageSize: test.max,
+		}
+		r.Listen()
+		ts.Close()
+		var got []string
+		for rm := range r.Chan {
+			got = append(got, rm.Data.ID)
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		}
+		if end := r.End(); end != test.wantEnd {
+			t.Errorf("[%v]: got/want mismatch: got end %v wanted %v", test.desc, end, test.wantEnd)
+		}
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	tests := []struct {
+		desc      string
+		offset    int
+		timestamp float64
+		wantFirst string
+		wantCount int64
+	}{{
+		desc:      "Success from the start",
+		wantFirst: "196.60.9.165-1558620047.08-11924763",
+		wantCount: 10,
+	}, {
+		desc:      "Success offset to the 6th message",
+		offset:    5,
+		wantFirst: "2001:7f8:d:ff::226-1558620047.06-51675230",
+		wantCount: 5,
+	}, {
+		desc:      "Success timestamp, every message after the first reaching it delivered",
+		timestamp: 1558620047.085,
+		wantFirst: "2001:43f8:6d0::9:165-1558620047.09-7571535",
+		wantCount: 8,
+	}, {
+		desc:      "Success offset passed before the timestamp",
+		offset:    1,
+		timestamp: 1558620047.085,
+		wantFirst: "2001:43f8:6d0::9:165-1558620047.09-7571535",
+		wantCount: 8,
+	}, {
+		desc:   "Offset past the end, nothing delivered",
+		offset: 10,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:           proto.String("testdata/10-msg"),
+			Chan:           make(chan RisMessage, 10),
+			StartOffset:    test.offset,
+			StartTimestamp: test.timestamp,
+		}
+		r.Listen()
+		first := ""
+		if len(r.Chan) > 0 {
+			first = (<-r.Chan).Data.ID
+		}
+		if first != test.wantFirst {
+			t.Errorf("[%v]: got/want mismatch: got first %v wanted %v", test.desc, first, test.wantFirst)
+		}
+		if r.Records != test.wantCount {
+			t.Errorf("[%v]: got/want mismatch: got %v records wanted %v", test.desc, r.Records, test.wantCount)
+		}
+		if end := r.End(); end != EndClean {
+			t.Errorf("[%v]: got/want mismatch: got end %v wanted %v", test.desc, end, EndClean)
+		}
+	}
+}
+
+// The offset is counted once per Listen, a reconnected stream carries on from
+// the messages already read past rather than skipping StartOffset again.
+func TestStartOffsetReconnect(t *testing.T) {
+	msg := func(id string) string {
+		return `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"` + id + `"}}` + "\n"
+	}
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) == 1 {
+			// Two messages, then bad frames to be reconnected after.
+			fmt.Fprint(w, msg("msg-1")+msg("msg-2")+"<html>\n<html>\n")
+			return
+		}
+		fmt.Fprint(w, msg("msg-3")+msg("msg-4"))
+	}))
+	defer ts.Close()
+
+	r := &RisLive{
+		URL:                        &ts.URL,
+		File:                       proto.String(""),
+		Chan:                       make(chan RisMessage, 4),
+		StartOffset:                3,
+		MaxConsecutiveDecodeErrors: 1,
+		ReconnectBackoff:           NewBackoff(time.Millisecond, time.Millisecond, 0),
+	}
+	r.Listen()
+
+	var got []string
+	for rm := range r.Chan {
+		got = append(got, rm.Data.ID)
+	}
+	if want := []string{"msg-4"}; !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+	if got := atomic.LoadInt64(&requests); got != 2 {
+		t.Errorf("got %v requests, wanted 2", got)
+	}
+}
+
+// Get reports the record count while Listen is still reading.
+func TestGetWhileListening(t *testing.T) {
+	r := &RisLive{
+		File:   proto.String("testdata/10-msg"),
+		Chan:   make(chan RisMessage, 1),
+		Filter: &RisFilter{},
+	}
+	go r.Listen()
+	got := 0
+	for r.Get(r.Filter) != "Done" {
+		got++
+	}
+	if got != 10 {
+		t.Errorf("got/want mismatch: got %v matches wanted 10", got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	r := &RisLive{
+		File: proto.String("testdata/1-msg"),
+		Chan: make(chan RisMessage, 10),
+	}
+	if got := r.Status(); !cmp.Equal(got, Status{}) {
+		t.Errorf("got/want mismatch before Listen diff(-got, +want):\n%v\n", cmp.Diff(got, Status{}))
+	}
+
+	before := time.Now()
+	r.Listen()
+	got := r.Status()
+	if got.LastMessage.Before(before) || got.LastMessage.After(time.Now()) {
+		t.Errorf("got last message at %v, wanted during Listen, after %v", got.LastMessage, before)
+	}
+	want := Status{LastMessage: got.LastMessage, ChannelDepth: 1, Records: 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	// Consuming the message empties the channel, the rest stands.
+	<-r.Chan
+	want.ChannelDepth = 0
+	if diff := cmp.Diff(r.Status(), want); diff != "" {
+		t.Errorf("got/want mismatch after reading Chan diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestListenEnd(t *testing.T) {
+	const msg = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}` + "\n"
+	tests := []struct {
+		desc    string
+		content string
+		file    string
+		max     int
+		close   bool
+		want    EndStatus
+	}{{
+		desc:    "Clean file",
+		content: msg + msg,
+		want:    EndClean,
+	}, {
+		desc:    "Trailing garbage",
+		content: msg + "not json\n",
+		want:    EndTrailingGarbage,
+	}, {
+		desc:    "Garbage then a message",
+		content: "not json\n" + msg,
+		want:    EndClean,
+	}, {
+		desc:    "Truncated message",
+		content: msg + msg[:20],
+		want:    EndTruncated,
+	}, {
+		desc:    "Too many bad frames",
+		content: "not\njson\nat\nall\n" + msg,
+		max:     2,
+		want:    EndBadFrames,
+	}, {
+		desc: "Missing file",
+		file: "testdata/no-such-file",
+		want: EndFailed,
+	}, {
+		desc:    "Closed",
+		content: msg,
+		close:   true,
+		want:    EndClosed,
+	}}
+
+	for _, test := range tests {
+		file := test.file
+		if file == "" {
+			file = filepath.Join(t.TempDir(), "stream")
+			if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+				t.Fatalf("[%v]: failed to write fixture: %v", test.desc, err)
+			}
+		}
+		r := &RisLive{
+			File:                       proto.String(file),
+			Chan:                       make(chan RisMessage, 10),
+			MaxConsecutiveDecodeErrors: test.max,
+		}
+		if got := r.End(); got != NotEnded {
+			t.Errorf("[%v]: got/want mismatch before Listen: got %v wanted %v", test.desc, got, NotEnded)
+		}
+		if test.close {
+			r.Close()
+		}
+		r.Listen()
+		if got := r.End(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestListenTail(t *testing.T) {
+	message := func(id string) string {
+		return fmt.Sprintf(`{"type":"ris_message","data":{"timestamp":1558620047.0,"id":%q}}`+"\n", id)
+	}
+	file := filepath.Join(t.TempDir(), "capture")
+	if err := ioutil.WriteFile(file, []byte(message("msg-1")), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	r := &RisLive{File: proto.String(file), Chan: make(chan RisMessage, 1), Tail: true}
+	done := make(chan struct{})
+	go func() {
+		r.Listen()
+		close(done)
+	}()
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case rm := <-r.Chan:
+			if rm.Data.ID != want {
+				t.Errorf("got/want mismatch: got %v wanted %v", rm.Data.ID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v not delivered", want)
+		}
+	}
+	receive("msg-1")
+
+	// Appended in two writes, the message is decoded once whole.
+	fd, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer fd.Close()
+	next := message("msg-2")
+	for _, part := range []string{next[:20], next[20:]} {
+		if _, err := fd.WriteString(part); err != nil {
+			t.Fatalf("failed to append to fixture: %v", err)
+		}
+		time.Sleep(2 * tailPoll)
+	}
+	receive("msg-2")
+
+	select {
+	case <-done:
+		t.Fatalf("Listen returned at the end of a tailed file")
+	default:
+	}
+	r.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen did not return after Close")
+	}
+	if got := r.End(); got != EndClosed {
+		t.Errorf("got/want mismatch: got %v wanted %v", got, EndClosed)
+	}
+}
+
+func TestCheckMinPrefixes(t *testing.T) {
+	multi := NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24").Data
+	mixed := NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data
+	mixed.Withdrawals = []string{"198.51.100.0/24", "203.0.113.0/24"}
+	// A v6 prefix listed once per next-hop counts once.
+	repeated := NewTestMessage([]uint32{3356, 64500}, "igp", "2001:db8::/32").Data
+	repeated.Announcements = append(repeated.Announcements, &RisAnnouncement{NextHop: "fe80::1", Prefixes: []string{"2001:db8::/32"}})
+
+	tests := []struct {
+		desc string
+		min  int
+		rm   *RisMessageData
+		want bool
+	}{{
+		desc: "Success no minimum",
+		rm:   NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		want: true,
+	}, {
+		desc: "Success multi-prefix at the minimum",
+		min:  3,
+		rm:   multi,
+		want: true,
+	}, {
+		desc: "Success announcements and withdrawals counted",
+		min:  3,
+		rm:   mixed,
+		want: true,
+	}, {
+		desc: "Failure single prefix",
+		min:  2,
+		rm:   NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		want: false,
+	}, {
+		desc: "Failure multi-prefix below the minimum",
+		min:  4,
+		rm:   multi,
+		want: false,
+	}, {
+		desc: "Failure repeated prefix counted once",
+		min:  2,
+		rm:   repeated,
+		want: false,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: &RisFilter{MinPrefixesPerMessage: test.min}}
+		if got := r.CheckMinPrefixes(test.rm); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestMatchesWorkers(t *testing.T) {
+	filter := &RisFilter{
+		InvalidTransitAS: map[uint32]bool{174: true},
+		Origins:          []string{"12654"},
+		Prefix:           []string{"196.50.70.0/24", "2001:7fb:fe00::/40"},
+	}
+	tests := []struct {
+		desc    string
+		workers int
+	}{{
+		desc: "Default single worker",
+	}, {
+		desc:    "Single worker",
+		workers: 1,
+	}, {
+		desc:    "Several workers",
+		workers: 4,
+	}, {
+		desc:    "More workers than messages",
+		workers: 16,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:    proto.String("testdata/10-msg"),
+			Chan:    make(chan RisMessage, 1),
+			Filter:  filter,
+			Workers: test.workers,
+		}
+		// Sinks are written from every worker, a ChannelSink is safe for that.
+		sink := NewChannelSink(10)
+		r.AddSink(sink)
+		go r.Listen()
+		var got []string
+		for rm := range r.Matches() {
+			got = append(got, rm.Data.ID)
+		}
+		// Unordered with several workers.
+		sort.Strings(got)
+		want := []string{"2001:7f8:d:ff::226-1558620047.06-51675230", "2001:7f8:d:ff::226-1558620047.06-51675232"}
+		if !cmp.Equal(got, want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, want))
+		}
+		if len(sink.C) != len(want) {
+			t.Errorf("[%v]: got %v messages published wanted %v", test.desc, len(sink.C), len(want))
+		}
+	}
+}
+
+// BenchmarkMatches filters the thousand message fixture, decoded up front,
+// on an increasing number of workers.
+func BenchmarkMatches(b *testing.B) {
+	r := &RisLive{File: proto.String("testdata/1k-msgs"), Chan: make(chan RisMessage, 1000)}
+	r.Listen()
+	msgs := r.Drain()
+	f := benchmarkFilter(1000)
+	f.InvalidTransitAS = map[uint32]bool{65000: true}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := &RisLive{Chan: make(chan RisMessage, len(msgs)), Filter: f, Workers: workers}
+				r.SetFilter(f)
+				for _, rm := range msgs {
+					r.Chan <- rm
+				}
+				close(r.Chan)
+				for range r.Matches() {
+				}
+			}
+		})
+	}
+}
+
+// The demo's own filter, setting only Prefix and Origins, matches the
+// announcement of one of its prefixes from one of its origins.
+func TestDemoFilter(t *testing.T) {
+	r := &RisLive{
+		File:   proto.String("testdata/demo"),
+		Chan:   make(chan RisMessage, 3),
+		Filter: demoFilter(),
+	}
+	go r.Listen()
+	var got []string
+	for rm := range r.Matches() {
+		got = append(got, rm.Data.ID)
+	}
+	if want := []string{"msg-1"}; !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// VRP is a validated ROA payload: ASN may originate Prefix and its
+// more-specifics up to MaxLength.
+type VRP struct {
+	Prefix    string
+	MaxLength int
+	ASN       uint32
+}
+
+// VRPTable holds VRPs for checking announcements against. A VRPTable is not
+// modified once built, so is safe for concurrent use.
+type VRPTable struct {
+	prefixes *preparedFilter  // Every VRP prefix.
+	vrps     map[string][]VRP // VRP prefix, canonical, to its VRPs.
+}
+
+// NewVRPTable builds a VRPTable from vrps, each of which must have a CIDR
+// prefix and a MaxLength from the prefix length to the address length.
+func NewVRPTable(vrps []VRP) (*VRPTable, error) {
+	v := &VRPTable{vrps: map[string][]VRP{}}
+	var prefixes []string
+	for _, vrp := range vrps {
+		_, n, err := parsePrefix(vrp.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse VRP prefix(%v): %v", vrp.Prefix, err)
+		}
+		ones, bits := n.Mask.Size()
+		if vrp.MaxLength < ones || vrp.MaxLength > bits {
+			return nil, fmt.Errorf("VRP %v max length %d is not %d-%d", vrp.Prefix, vrp.MaxLength, ones, bits)
+		}
+		key := n.String()
+		if v.vrps[key] == nil {
+			prefixes = append(prefixes, key)
+		}
+		v.vrps[key] = append(v.vrps[key], vrp)
+	}
+	v.prefixes = (&RisFilter{Prefix: prefixes}).compile(discardLogger)
+	return v, nil
+}
+
+// covering returns the VRPs whose prefix covers n, most specific first.
+func (v *VRPTable) covering(n *net.IPNet) []VRP {
+	var vrps []VRP
+	for {
+		match, ok := v.prefixes.covering(n)
+		if !ok {
+			return vrps
+		}
+		vrps = append(vrps, v.vrps[match.String()]...)
+		ones, bits := match.Mask.Size()
+		if ones == 0 {
+			return vrps
+		}
+		// Carry on from the prefix holding the match.
+		mask := net.CIDRMask(ones-1, bits)
+		n = &net.IPNet{IP: match.IP.Mask(mask), Mask: mask}
+	}
+}
+
+// MaxLengthViolation returns the first prefix the message announces which is
+// covered by a VRP for its origin ASN, but longer than the MaxLength of every
+// such VRP: RPKI invalid only by its length, often a more-specific announced
+// without updating the ROA. A prefix without a VRP for its origin is not a
+// max-length violation, nor is an AS_SET origin.
+func (v *VRPTable) MaxLengthViolation(rm *RisMessageData) (prefix string, ok bool) {
+	origin := rm.OriginASN
+	if origin == 0 || len(rm.OriginSet) > 0 {
+		return "", false
+	}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			_, n, err := parsePrefix(p)
+			if err != nil {
+				continue
+			}
+			ones, _ := n.Mask.Size()
+			authorised, valid := false, false
+			for _, vrp := range v.covering(n) {
+				if vrp.ASN != origin {
+					continue
+				}
+				authorised = true
+				if ones <= vrp.MaxLength {
+					valid = true
+					break
+				}
+			}
+			if authorised && !valid {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// vrpFile is the JSON VRP export of rpki-client, Routinator and others:
+//
+//	{"roas": [{"asn": "AS64500", "prefix": "192.0.0.0/22", "maxLength": 22}]}
+//
+// The ASN may also be a number, without the AS.
+type vrpFile struct {
+	ROAs []struct {
+		ASN       json.RawMessage `json:"asn"`
+		Prefix    string          `json:"prefix"`
+		MaxLength int             `json:"maxLength"`
+	} `json:"roas"`
+}
+
+// LoadVRPs reads the VRPs of a JSON VRP export, as written by rpki-client or
+// Routinator, to build a VRPTable from.
+func LoadVRPs(path string) ([]VRP, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VRPs(%v): %v", path, err)
+	}
+	var f vrpFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode VRPs(%v): %v", path, err)
+	}
+	vrps := make([]VRP, 0, len(f.ROAs))
+	for _, roa := range f.ROAs {
+		var asn uint32
+		if err := json.Unmarshal(roa.ASN, &asn); err != nil {
+			var s string
+			if err := json.Unmarshal(roa.ASN, &s); err != nil {
+				return nil, fmt.Errorf("VRP %v asn(%s) is not a number or string", roa.Prefix, roa.ASN)
+			}
+			// AS0 ROAs are valid, and say no ASN may originate the prefix.
+			if s = strings.TrimPrefix(strings.ToUpper(s), "AS"); s != "0" {
+				if asn, err = ParseASN(s); err != nil {
+					return nil, fmt.Errorf("VRP %v: %v", roa.Prefix, err)
+				}
+			}
+		}
+		vrps = append(vrps, VRP{Prefix: roa.Prefix, MaxLength: roa.MaxLength, ASN: asn})
+	}
+	return vrps, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMaxLengthViolation(t *testing.T) {
+	tests := []struct {
+		desc       string
+		vrps       []VRP
+		msg        *RisMessageData
+		wantPrefix string
+		wantOK     bool
+	}{{
+		desc:       "Violation /24 from the authorised origin, ROA up to /22",
+		vrps:       []VRP{{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500}},
+		msg:        NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		wantPrefix: "192.0.2.0/24",
+		wantOK:     true,
+	}, {
+		desc: "Success the ROA prefix itself",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.0.0/22").Data,
+	}, {
+		desc: "Success /24 within the max length",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 24, ASN: 64500}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+	}, {
+		desc: "Success /24 from another origin is not a max length violation",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500}},
+		msg:  NewTestMessage([]uint32{3356, 64501}, "igp", "192.0.2.0/24").Data,
+	}, {
+		desc: "Success /24 allowed by a less specific ROA",
+		vrps: []VRP{
+			{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500},
+			{Prefix: "192.0.0.0/16", MaxLength: 24, ASN: 64500},
+		},
+		msg: NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+	}, {
+		desc: "Success /24 allowed by a second ROA for the prefix",
+		vrps: []VRP{
+			{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500},
+			{Prefix: "192.0.0.0/22", MaxLength: 24, ASN: 64500},
+		},
+		msg: NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+	}, {
+		desc:       "Violation from a less specific ROA, the more specific ROA is another origin's",
+		vrps:       []VRP{{Prefix: "192.0.0.0/22", MaxLength: 24, ASN: 64501}, {Prefix: "192.0.0.0/16", MaxLength: 16, ASN: 64500}},
+		msg:        NewTestMessage([]uint32{3356, 64500}, "igp", "192.0.2.0/24").Data,
+		wantPrefix: "192.0.2.0/24",
+		wantOK:     true,
+	}, {
+		desc:       "Violation the second prefix announced",
+		vrps:       []VRP{{Prefix: "2001:db8::/32", MaxLength: 40, ASN: 64500}},
+		msg:        NewTestMessage([]uint32{3356, 64500}, "igp", "2001:db8::/40", "2001:db8:ff00::/48").Data,
+		wantPrefix: "2001:db8:ff00::/48",
+		wantOK:     true,
+	}, {
+		desc: "Success no covering ROA",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500}},
+		msg:  NewTestMessage([]uint32{3356, 64500}, "igp", "198.51.100.0/24").Data,
+	}, {
+		desc: "Success AS_SET origin",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500}},
+		msg: func() *RisMessageData {
+			rm := &RisMessageData{
+				Path:          []interface{}{float64(3356), []interface{}{float64(64500)}},
+				Announcements: []*RisAnnouncement{{Prefixes: []string{"192.0.2.0/24"}}},
+			}
+			if err := digestPath(rm); err != nil {
+				t.Fatalf("failed to digest path: %v", err)
+			}
+			return rm
+		}(),
+	}}
+
+	for _, test := range tests {
+		v, err := NewVRPTable(test.vrps)
+		if err != nil {
+			t.Fatalf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		prefix, ok := v.MaxLengthViolation(test.msg)
+		if prefix != test.wantPrefix || ok != test.wantOK {
+			t.Errorf("[%v]: got/want mismatch: got %q/%v wanted %q/%v", test.desc, prefix, ok, test.wantPrefix, test.wantOK)
+		}
+	}
+}
+
+func TestNewVRPTable(t *testing.T) {
+	tests := []struct {
+		desc    string
+		vrps    []VRP
+		wantErr bool
+	}{{
+		desc: "Success",
+		vrps: []VRP{{Prefix: "192.0.0.0/22", MaxLength: 24, ASN: 64500}, {Prefix: "2001:db8::/32", MaxLength: 128, ASN: 64500}},
+	}, {
+		desc:    "Failure prefix",
+		vrps:    []VRP{{Prefix: "192.0.2.0", MaxLength: 24, ASN: 64500}},
+		wantErr: true,
+	}, {
+		desc:    "Failure max length shorter than the prefix",
+		vrps:    []VRP{{Prefix: "192.0.0.0/22", MaxLength: 21, ASN: 64500}},
+		wantErr: true,
+	}, {
+		desc:    "Failure max length longer than the address",
+		vrps:    []VRP{{Prefix: "192.0.0.0/22", MaxLength: 33, ASN: 64500}},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		_, err := NewVRPTable(test.vrps)
+		if (err != nil) != test.wantErr {
+			t.Errorf("[%v]: got error %v, wanted error: %v", test.desc, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadVRPs(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    []VRP
+		wantErr bool
+	}{{
+		desc: "Success ASNs as strings and numbers",
+		file: `{"roas": [{"asn": "AS64500", "prefix": "192.0.0.0/22", "maxLength": 22, "ta": "ripe"},
+			{"asn": 4200000000, "prefix": "2001:db8::/32", "maxLength": 48},
+			{"asn": "AS0", "prefix": "198.51.100.0/24", "maxLength": 24}]}`,
+		want: []VRP{
+			{Prefix: "192.0.0.0/22", MaxLength: 22, ASN: 64500},
+			{Prefix: "2001:db8::/32", MaxLength: 48, ASN: 4200000000},
+			{Prefix: "198.51.100.0/24", MaxLength: 24},
+		},
+	}, {
+		desc:    "Failure ASN not an ASN",
+		file:    `{"roas": [{"asn": "ASX", "prefix": "192.0.0.0/22", "maxLength": 22}]}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure not JSON",
+		file:    `roas`,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "vrps.json")
+		if err := ioutil.WriteFile(path, []byte(test.file), 0644); err != nil {
+			t.Fatalf("[%v]: failed to write fixture: %v", test.desc, err)
+		}
+		got, err := LoadVRPs(path)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
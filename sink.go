@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the messages which pass the RisLive filter, separating what
+// is matched from how it is output.
+type Sink interface {
+	Write(RisMessage) error
+}
+
+// AddSink registers a sink to be sent every message Get finds matching the filter.
+func (r *RisLive) AddSink(s Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, s)
+}
+
+// publish sends a matched message to every registered sink, a sink which fails
+// is logged and does not stop the message reaching the remaining sinks.
+func (r *RisLive) publish(rm RisMessage) {
+	r.mu.RLock()
+	sinks := r.sinks
+	r.mu.RUnlock()
+	for _, s := range sinks {
+		if err := s.Write(rm); err != nil {
+			r.log().Error("failed to publish message", "id", rm.Data.ID, "sink", fmt.Sprintf("%T", s), "error", err)
+		}
+	}
+}
+
+// StdoutSink prints a line for each message with its prefixes, origin ASN and path.
+// A StdoutSink is safe for concurrent use.
+type StdoutSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSink creates a StdoutSink printing to os.Stdout.
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{w: os.Stdout}
+}
+
+// Write prints the message.
+func (s *StdoutSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not print a message without data")
+	}
+	prefixes := []string{}
+	for _, a := range rm.Data.Announcements {
+		prefixes = append(prefixes, a.Prefixes...)
+	}
+	origin := rm.Data.OriginASN
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "Prefixes: %v Origin: %v Path: %v\n",
+		strings.Join(prefixes, ", "), origin, rm.Data.PathString())
+	return err
+}
+
+// JSONWriterSink writes each message as a line of JSON (NDJSON) to a writer.
+// A JSONWriterSink is safe for concurrent use.
+type JSONWriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONWriterSink creates a JSONWriterSink writing to w.
+func NewJSONWriterSink(w io.Writer) *JSONWriterSink {
+	return &JSONWriterSink{enc: json.NewEncoder(w)}
+}
+
+// Write encodes the message, followed by a newline.
+func (s *JSONWriterSink) Write(rm RisMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rm)
+}
+
+// PeerGroupSink collapses the messages for the same prefix and path, seen by
+// many collector peers within window, into one PeerGroup, written as a line
+// of JSON once the window has passed. Flush writes the groups still open.
+// A PeerGroupSink is safe for concurrent use.
+type PeerGroupSink struct {
+	mu  sync.Mutex
+	g   *PeerGrouper
+	enc *json.Encoder
+}
+
+// NewPeerGroupSink creates a PeerGroupSink grouping over window, writing to w.
+func NewPeerGroupSink(window time.Duration, w io.Writer) *PeerGroupSink {
+	return &PeerGroupSink{g: NewPeerGrouper(window), enc: json.NewEncoder(w)}
+}
+
+// Write adds the message to its groups, and writes the groups it completes.
+func (s *PeerGroupSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not group a message without data")
+	}
+	return s.write(s.g.Add(rm.Data))
+}
+
+// Flush writes every open group, at the end of the stream.
+func (s *PeerGroupSink) Flush() error {
+	return s.write(s.g.Flush())
+}
+
+func (s *PeerGroupSink) write(groups []PeerGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pg := range groups {
+		if err := s.enc.Encode(pg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader names the columns CSVSink writes.
+var csvHeader = []string{"timestamp", "peer", "peer_asn", "origin", "path", "prefixes"}
+
+// CSVSink writes each message as a CSV record, after a header row naming the
+// columns: the time, peer, peer ASN, origin ASN, path and announced prefixes,
+// space separated. A CSVSink is safe for concurrent use.
+type CSVSink struct {
+	mu     sync.Mutex
+	w      *csv.Writer
+	header bool // The header row has been written.
+}
+
+// NewCSVSink creates a CSVSink writing to w.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{w: csv.NewWriter(w)}
+}
+
+// Write writes the message's record, and the header row before the first.
+func (s *CSVSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not write a message without data")
+	}
+	prefixes := []string{}
+	for _, a := range rm.Data.Announcements {
+		prefixes = append(prefixes, a.Prefixes...)
+	}
+	origin := rm.Data.OriginASN
+	record := []string{
+		rm.Data.Time().UTC().Round(time.Millisecond).Format(time.RFC3339Nano),
+		rm.Data.Peer,
+		rm.Data.PeerASN,
+		fmt.Sprint(origin),
+		rm.Data.PathString(),
+		strings.Join(prefixes, " "),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		if err := s.w.Write(csvHeader); err != nil {
+			return err
+		}
+		s.header = true
+	}
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	// Flushed per record, so the output keeps up with the stream.
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// NewFormatSink creates the sink writing messages to w in format: text, a
+// line per message as StdoutSink prints, json, as JSONWriterSink, or csv, as
+// CSVSink.
+func NewFormatSink(format string, w io.Writer) (Sink, error) {
+	switch format {
+	case "text":
+		return &StdoutSink{w: w}, nil
+	case "json":
+		return NewJSONWriterSink(w), nil
+	case "csv":
+		return NewCSVSink(w), nil
+	}
+	return nil, fmt.Errorf("output format(%v) is not one of text, json or csv", format)
+}
+
+// ChannelSink sends each message to a channel, C, for the caller to receive from.
+// Write blocks while the channel is full.
+type ChannelSink struct {
+	C chan RisMessage
+}
+
+// NewChannelSink creates a ChannelSink whose channel buffers up to buffer messages.
+func NewChannelSink(buffer int) *ChannelSink {
+	return &ChannelSink{C: make(chan RisMessage, buffer)}
+}
+
+// Write sends the message to the channel.
+func (s *ChannelSink) Write(rm RisMessage) error {
+	s.C <- rm
+	return nil
+}
+
+// RawSink writes the raw BGP message of each matched message to a writer,
+// one after another. BGP messages carry their own length, so the output can
+// be split back into messages, though it is not yet framed as MRT.
+// A RawSink is safe for concurrent use.
+type RawSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRawSink creates a RawSink writing to w.
+func NewRawSink(w io.Writer) *RawSink {
+	return &RawSink{w: w}
+}
+
+// Write decodes the message's Raw field and writes the bytes. A message
+// without Raw is an error, Listen keeps Raw only with IncludeRaw set.
+func (s *RawSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not write a message without data")
+	}
+	if rm.Data.Raw == "" {
+		return fmt.Errorf("message(%v) has no raw BGP message, set IncludeRaw to keep it", rm.Data.ID)
+	}
+	b, err := rm.Data.RawBytes()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(b)
+	return err
+}
+
+// KafkaProducer is the part of a Kafka client a KafkaSink needs. Wrapping the
+// producer of whichever Kafka client library is in use keeps that library,
+// and its dependencies, out of this package.
+type KafkaProducer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// KafkaSink publishes each matched message, as JSON, to a Kafka topic keyed by
+// the message ID.
+type KafkaSink struct {
+	Topic    string
+	Producer KafkaProducer
+}
+
+// NewKafkaSink creates a KafkaSink publishing to topic through the producer p.
+func NewKafkaSink(topic string, p KafkaProducer) *KafkaSink {
+	return &KafkaSink{Topic: topic, Producer: p}
+}
+
+// Write marshals the message to JSON and hands it to the producer.
+func (k *KafkaSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not publish a message without data")
+	}
+	value, err := json.Marshal(rm)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message(%v): %v", rm.Data.ID, err)
+	}
+	if err := k.Producer.Produce(k.Topic, []byte(rm.Data.ID), value); err != nil {
+		return fmt.Errorf("failed to produce message(%v) to topic(%v): %v", rm.Data.ID, k.Topic, err)
+	}
+	return nil
+}
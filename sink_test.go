@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordSink keeps every message published to it.
+type recordSink struct {
+	msgs []RisMessage
+}
+
+func (s *recordSink) Write(rm RisMessage) error {
+	s.msgs = append(s.msgs, rm)
+	return nil
+}
+
+// failSink fails every publish.
+type failSink struct{}
+
+func (failSink) Write(RisMessage) error { return errors.New("sink failed") }
+
+func TestGetPublishesToSinks(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		want   []string
+	}{{
+		desc: "Success match published",
+		filter: &RisFilter{
+			Prefix:           []string{"196.50.70.0/24"},
+			Origins:          []string{"37650"},
+			InvalidTransitAS: map[uint32]bool{uint32(57695): true},
+		},
+		want: []string{"196.60.9.165-1558620047.08-11924763"},
+	}, {
+		desc: "Success no match, nothing published",
+		filter: &RisFilter{
+			Prefix:  []string{"196.50.70.0/24"},
+			Origins: []string{"igp"},
+		},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{
+			File:   proto.String("testdata/1-msg"),
+			Filter: test.filter,
+			Chan:   make(chan RisMessage, 10),
+		}
+		// A failing sink must not stop the message reaching the others.
+		r.AddSink(failSink{})
+		rec := &recordSink{}
+		r.AddSink(rec)
+		go r.Listen()
+		r.Get(r.Filter)
+
+		var got []string
+		for _, rm := range rec.msgs {
+			got = append(got, rm.Data.ID)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+// fakeProducer records what it is asked to produce, or fails.
+type fakeProducer struct {
+	topic      string
+	key, value []byte
+	err        error
+}
+
+func (p *fakeProducer) Produce(topic string, key, value []byte) error {
+	p.topic, p.key, p.value = topic, key, value
+	return p.err
+}
+
+func TestKafkaSink(t *testing.T) {
+	rm := RisMessage{
+		Type: "ris_message",
+		Data: &RisMessageData{ID: "msg-1", Peer: "192.0.2.1", Origin: "igp"},
+	}
+	tests := []struct {
+		desc    string
+		msg     RisMessage
+		err     error
+		wantErr bool
+	}{{
+		desc: "Success produced",
+		msg:  rm,
+	}, {
+		desc:    "Failure producer error",
+		msg:     rm,
+		err:     errors.New("broker unavailable"),
+		wantErr: true,
+	}, {
+		desc:    "Failure message without data",
+		msg:     RisMessage{Type: "ris_message"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		p := &fakeProducer{err: test.err}
+		err := NewKafkaSink("ris", p).Write(test.msg)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			var got RisMessage
+			if err := json.Unmarshal(p.value, &got); err != nil {
+				t.Fatalf("[%v]: failed to unmarshal produced value: %v", test.desc, err)
+			}
+			if p.topic != "ris" || string(p.key) != "msg-1" {
+				t.Errorf("[%v]: got topic/key %v/%v want ris/msg-1", test.desc, p.topic, string(p.key))
+			}
+			if diff := cmp.Diff(got, test.msg); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestStdoutSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := &StdoutSink{w: &buf}
+	rm := RisMessage{Data: &RisMessageData{
+		Path:         []interface{}{float64(57695), float64(37650)},
+		DigestedPath: []uint32{57695, 37650},
+		OriginASN:    37650,
+		Announcements: []*RisAnnouncement{
+			{Prefixes: []string{"196.50.70.0/24", "196.50.71.0/24"}},
+		},
+	}}
+	if err := s.Write(rm); err != nil {
+		t.Fatalf("got error when not expecting one: %v", err)
+	}
+	want := "Prefixes: 196.50.70.0/24, 196.50.71.0/24 Origin: 37650 Path: 57695 37650\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got/want mismatch, got: %q want: %q", got, want)
+	}
+}
+
+func TestJSONWriterSink(t *testing.T) {
+	msgs := []RisMessage{
+		{Type: "ris_message", Data: &RisMessageData{ID: "msg-1"}},
+		{Type: "ris_message", Data: &RisMessageData{ID: "msg-2"}},
+	}
+	var buf bytes.Buffer
+	s := NewJSONWriterSink(&buf)
+	for _, rm := range msgs {
+		if err := s.Write(rm); err != nil {
+			t.Fatalf("got error when not expecting one: %v", err)
+		}
+	}
+
+	// Each message is one line, which decodes back to the message.
+	var got []RisMessage
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rm RisMessage
+		if err := dec.Decode(&rm); err != nil {
+			t.Fatalf("failed to decode written message: %v", err)
+		}
+		got = append(got, rm)
+	}
+	if diff := cmp.Diff(got, msgs); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestChannelSink(t *testing.T) {
+	s := NewChannelSink(1)
+	rm := RisMessage{Type: "ris_message", Data: &RisMessageData{ID: "msg-1"}}
+	if err := s.Write(rm); err != nil {
+		t.Fatalf("got error when not expecting one: %v", err)
+	}
+	if got := <-s.C; !cmp.Equal(got, rm) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, rm))
+	}
+}
+
+func TestRawSink(t *testing.T) {
+	msgs := []RisMessage{
+		{Data: &RisMessageData{Raw: "FFFF0001"}},
+		{Data: &RisMessageData{Raw: "02"}},
+	}
+	var buf bytes.Buffer
+	s := NewRawSink(&buf)
+	for _, rm := range msgs {
+		if err := s.Write(rm); err != nil {
+			t.Fatalf("got error when not expecting one: %v", err)
+		}
+	}
+	if err := s.Write(RisMessage{Data: &RisMessageData{Raw: "not hex"}}); err == nil {
+		t.Errorf("did not get error writing a message which is not hex")
+	}
+
+	// Listen drops Raw without IncludeRaw, the sink must not quietly write nothing.
+	r := &RisLive{File: proto.String("testdata/1-msg"), Chan: make(chan RisMessage, 1)}
+	r.Listen()
+	if err := s.Write(<-r.Chan); err == nil || !strings.Contains(err.Error(), "IncludeRaw") {
+		t.Errorf("got error %v writing a message without raw, wanted one saying to set IncludeRaw", err)
+	}
+	if want := []byte{0xff, 0xff, 0x00, 0x01, 0x02}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got/want mismatch, got: %x want: %x", buf.Bytes(), want)
+	}
+}
+
+func TestPeerGroupSink(t *testing.T) {
+	msg := func(peer string, ts float64, prefix string) RisMessage {
+		rm := NewTestMessage([]uint32{3356, 64500}, "igp", prefix)
+		rm.Data.Peer, rm.Data.Host, rm.Data.Timestamp = peer, "rrc00", ts
+		return rm
+	}
+	var buf bytes.Buffer
+	s := NewPeerGroupSink(10*time.Second, &buf)
+	for _, rm := range []RisMessage{
+		msg("192.0.2.1", 100, "198.51.100.0/24"),
+		msg("192.0.2.2", 101, "198.51.100.0/24"),
+		// Completes the group opened at 100.
+		msg("192.0.2.1", 120, "203.0.113.0/24"),
+	} {
+		if err := s.Write(rm); err != nil {
+			t.Fatalf("got error when not expecting one: %v", err)
+		}
+	}
+	first := buf.String()
+	if err := s.Flush(); err != nil {
+		t.Fatalf("got error flushing when not expecting one: %v", err)
+	}
+
+	group := func(prefix string, first int64, peers ...string) string {
+		pg := PeerGroup{Prefix: prefix, Path: []uint32{3356, 64500}, First: time.Unix(first, 0)}
+		for _, p := range peers {
+			pg.Observers = append(pg.Observers, Observer{Peer: p, Host: "rrc00"})
+		}
+		b, err := json.Marshal(pg)
+		if err != nil {
+			t.Fatalf("failed to marshal group: %v", err)
+		}
+		return string(b) + "\n"
+	}
+	if want := group("198.51.100.0/24", 100, "192.0.2.1", "192.0.2.2"); first != want {
+		t.Errorf("got/want mismatch before Flush:\n%v\n", cmp.Diff(first, want))
+	}
+	if want := first + group("203.0.113.0/24", 120, "192.0.2.1"); buf.String() != want {
+		t.Errorf("got/want mismatch after Flush:\n%v\n", cmp.Diff(buf.String(), want))
+	}
+	if !strings.Contains(first, `"observers":[{"peer":"192.0.2.1","host":"rrc00"}`) {
+		t.Errorf("got %v, wanted the observers listed by peer and host", first)
+	}
+	if err := s.Write(RisMessage{}); err == nil {
+		t.Errorf("did not get error writing a message without data")
+	}
+}
+
+func TestNewFormatSink(t *testing.T) {
+	rm := RisMessage{Type: "ris_message", Data: &RisMessageData{
+		Timestamp:    1558620047.06,
+		Peer:         "2001:7f8:d:ff::226",
+		PeerASN:      "24482",
+		ID:           "msg-1",
+		Path:         []interface{}{float64(24482), float64(6453), float64(12654)},
+		DigestedPath: []uint32{24482, 6453, 12654},
+		OriginASN:    12654,
+		Announcements: []*RisAnnouncement{
+			{Prefixes: []string{"2001:7fb:fe00::/48", "2001:7fb:fe01::/48"}},
+		},
+	}}
+	js, err := json.Marshal(rm)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+	tests := []struct {
+		desc    string
+		format  string
+		want    string
+		wantErr bool
+	}{{
+		desc:   "Text",
+		format: "text",
+		want:   "Prefixes: 2001:7fb:fe00::/48, 2001:7fb:fe01::/48 Origin: 12654 Path: 24482 6453 12654\n",
+	}, {
+		desc:   "JSON",
+		format: "json",
+		want:   string(js) + "\n",
+	}, {
+		desc:   "CSV, header before the first record only",
+		format: "csv",
+		want: "timestamp,peer,peer_asn,origin,path,prefixes\n" +
+			"2019-05-23T14:00:47.06Z,2001:7f8:d:ff::226,24482,12654,24482 6453 12654,2001:7fb:fe00::/48 2001:7fb:fe01::/48\n",
+	}, {
+		desc:    "Unknown format",
+		format:  "xml",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		s, err := NewFormatSink(test.format, &buf)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+			continue
+		case err != nil:
+			continue
+		}
+		if err := s.Write(rm); err != nil {
+			t.Fatalf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %q want: %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCSVSinkHeaderOnce(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewCSVSink(&buf)
+	for i := 0; i < 2; i++ {
+		if err := s.Write(RisMessage{Data: &RisMessageData{Peer: "192.0.2.1"}}); err != nil {
+			t.Fatalf("got error when not expecting one: %v", err)
+		}
+	}
+	want := "timestamp,peer,peer_asn,origin,path,prefixes\n" +
+		"1970-01-01T00:00:00Z,192.0.2.1,,0,,\n" +
+		"1970-01-01T00:00:00Z,192.0.2.1,,0,,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got/want mismatch, got: %q want: %q", got, want)
+	}
+}
@@ -0,0 +1,813 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultStateSize is the number of prefixes state is kept for when no size is set.
+const defaultStateSize = 100000
+
+// lruCache is a bounded map, once full adding a new key evicts the least
+// recently used key. It is not safe for concurrent use.
+type lruCache struct {
+	size  int
+	order *list.List // Most recently used at the front.
+	items map[string]*list.Element
+}
+
+// lruEntry is a single key and value held in the lruCache.
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+// newLRUCache creates a cache holding at most size keys, or defaultStateSize
+// keys if size is not positive.
+func newLRUCache(size int) *lruCache {
+	if size <= 0 {
+		size = defaultStateSize
+	}
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// get returns the value for key, marking it as recently used.
+func (c *lruCache) get(key string) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// add sets the value for key, evicting the least recently used key if the cache is full.
+func (c *lruCache) add(key string, value interface{}) {
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// len returns the number of keys held.
+func (c *lruCache) len() int {
+	return c.order.Len()
+}
+
+// OriginChange records the origin ASN of each monitored prefix announced in the
+// message, and reports the first prefix seen with an origin other than the
+// one last recorded for it. Monitored prefixes are those within the filter
+// prefixes, or every prefix if the filter has none.
+//
+// State is kept for at most OriginStateSize prefixes, the least recently
+// announced prefixes are forgotten first.
+func (r *RisLive) OriginChange(rm *RisMessageData) (prefix string, oldASN, newASN uint32, changed bool) {
+	origin := rm.OriginASN
+	if origin == 0 {
+		return "", 0, 0, false
+	}
+	pf := r.prepare()
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.originState == nil {
+		r.originState = newLRUCache(r.OriginStateSize)
+	}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			if pf.prefix {
+				ip, _, err := net.ParseCIDR(p)
+				if err != nil || !pf.contains(ip) {
+					continue
+				}
+			}
+			last, seen := r.originState.get(p)
+			r.originState.add(p, origin)
+			if seen && last.(uint32) != origin && !changed {
+				prefix, oldASN, newASN, changed = p, last.(uint32), origin, true
+			}
+		}
+	}
+	return prefix, oldASN, newASN, changed
+}
+
+// duplicate records each prefix in the message against its origin and path,
+// and reports whether every one had already passed within DedupWindow. The
+// window runs from when a prefix last passed, repeats do not extend it.
+// A message with no prefixes is never a duplicate.
+func (r *RisLive) duplicate(rm *RisMessageData) bool {
+	at := rm.Time()
+	origin := rm.OriginASN
+	path := fmt.Sprint(rm.DigestedPath)
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.dedupState == nil {
+		r.dedupState = newLRUCache(0)
+	}
+	keys := 0
+	dup := true
+	seen := func(key string) {
+		keys++
+		if last, ok := r.dedupState.get(key); ok && at.Sub(last.(time.Time)) <= r.DedupWindow {
+			return
+		}
+		dup = false
+		r.dedupState.add(key, at)
+	}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			seen(fmt.Sprintf("announce %v %v %v", p, origin, path))
+		}
+	}
+	for _, p := range rm.Withdrawals {
+		seen("withdraw " + p)
+	}
+	return dup && keys > 0
+}
+
+// DeaggEvent reports an origin ASN which announced Count distinct
+// more-specifics of the filter prefix Aggregate within DeaggWindow, the last
+// being announced At.
+type DeaggEvent struct {
+	Aggregate string
+	Origin    uint32
+	Count     int
+	At        time.Time
+}
+
+// deaggState is when each more-specific of an aggregate was last announced
+// from one origin, and whether the origin has been reported.
+type deaggState struct {
+	announced map[string]time.Time
+	reported  bool
+}
+
+// Deaggregation records each more-specific of a filter prefix announced in
+// the message against its origin, and returns an event for each filter
+// prefix the origin has announced more than DeaggThreshold more-specifics of
+// within DeaggWindow: a sign of deaggregation, table pollution or a leak. An
+// origin is reported once, and again only after falling back within the
+// threshold. Without a threshold or filter prefixes nothing is recorded.
+//
+// State is kept for at most OriginStateSize filter prefix and origin pairs,
+// the least recently announced are forgotten first.
+func (r *RisLive) Deaggregation(rm *RisMessageData) []DeaggEvent {
+	origin := rm.OriginASN
+	if origin == 0 || r.DeaggThreshold <= 0 {
+		return nil
+	}
+	pf := r.prepare()
+	if !pf.prefix {
+		return nil
+	}
+	at := rm.Time()
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.deaggState == nil {
+		r.deaggState = newLRUCache(r.OriginStateSize)
+	}
+	touched := map[string]*deaggState{}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				continue
+			}
+			agg, ok := pf.covering(n)
+			if !ok || agg.String() == n.String() {
+				continue
+			}
+			key := fmt.Sprintf("%v %v", agg, origin)
+			v, ok := r.deaggState.get(key)
+			if !ok {
+				v = &deaggState{announced: map[string]time.Time{}}
+				r.deaggState.add(key, v)
+			}
+			st := v.(*deaggState)
+			st.announced[n.String()] = at
+			touched[agg.String()] = st
+		}
+	}
+
+	var events []DeaggEvent
+	for agg, st := range touched {
+		// Forget more-specifics which have left the window.
+		cutoff := at.Add(-r.DeaggWindow)
+		for p, last := range st.announced {
+			if last.Before(cutoff) {
+				delete(st.announced, p)
+			}
+		}
+		switch count := len(st.announced); {
+		case count > r.DeaggThreshold && !st.reported:
+			st.reported = true
+			events = append(events, DeaggEvent{Aggregate: agg, Origin: origin, Count: count, At: at})
+		case count <= r.DeaggThreshold:
+			st.reported = false
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Aggregate < events[j].Aggregate })
+	return events
+}
+
+// FlapEvent reports a prefix which changed between announced and withdrawn
+// Count times within the detector's window, the last change being At.
+type FlapEvent struct {
+	Prefix string
+	Count  int
+	At     time.Time
+}
+
+// FlapDetector tracks whether each prefix is announced or withdrawn, and the
+// times it changed between the two, to find prefixes which are flapping.
+// One built without NewFlapDetector keeps state for defaultStateSize
+// prefixes. A FlapDetector is safe for concurrent use.
+type FlapDetector struct {
+	Window    time.Duration // Changes older than this, relative to the newest, are forgotten.
+	Threshold int           // Changes within Window which make a prefix flapping.
+
+	mu     sync.Mutex
+	states *lruCache // Prefix to *flapState.
+}
+
+// flapState is the current state of one prefix and its recent changes.
+type flapState struct {
+	announced bool
+	changes   []time.Time
+}
+
+// NewFlapDetector creates a FlapDetector keeping state for at most size
+// prefixes, or defaultStateSize prefixes if size is not positive.
+func NewFlapDetector(window time.Duration, threshold, size int) *FlapDetector {
+	return &FlapDetector{
+		Window:    window,
+		Threshold: threshold,
+		states:    newLRUCache(size),
+	}
+}
+
+// Observe records the announcements and withdrawals in the message, timed by
+// the message Timestamp, and returns an event for each prefix whose changes
+// within the window reach the threshold. A prefix crossing the threshold is
+// reported once, and again only after its changes fall back below it.
+func (f *FlapDetector) Observe(rm *RisMessageData) []FlapEvent {
+	at := rm.Time()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.states == nil {
+		f.states = newLRUCache(0)
+	}
+
+	var events []FlapEvent
+	seen := map[string]bool{}
+	update := func(prefix string, announced bool) {
+		// v6 announcements may list a prefix once per next-hop.
+		if seen[prefix] {
+			return
+		}
+		seen[prefix] = true
+
+		v, ok := f.states.get(prefix)
+		if !ok {
+			f.states.add(prefix, &flapState{announced: announced})
+			return
+		}
+		st := v.(*flapState)
+		if st.announced == announced {
+			return
+		}
+		st.announced = announced
+
+		// Forget changes which have left the window.
+		cutoff := at.Add(-f.Window)
+		i := 0
+		for i < len(st.changes) && st.changes[i].Before(cutoff) {
+			i++
+		}
+		st.changes = append(st.changes[i:], at)
+		if len(st.changes) == f.Threshold {
+			events = append(events, FlapEvent{Prefix: prefix, Count: len(st.changes), At: at})
+		}
+	}
+
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			update(p, true)
+		}
+	}
+	for _, p := range rm.Withdrawals {
+		update(p, false)
+	}
+	return events
+}
+
+// MOASEvent reports a prefix announced from more than one origin ASN within
+// the detector's window, a multiple origin AS conflict. The last origin to
+// join was seen At.
+type MOASEvent struct {
+	Prefix  string
+	Origins []uint32 // Sorted.
+	At      time.Time
+}
+
+// MOASDetector finds prefixes announced from two or more origin ASNs within
+// Window, by message timestamp. Many are legitimate, anycast, so prefixes
+// within an allowlisted prefix are not checked. One built without
+// NewMOASDetector has no allowlist and keeps state for defaultStateSize
+// prefixes. A MOASDetector is safe for concurrent use.
+type MOASDetector struct {
+	Window time.Duration // Origins not seen for this long, relative to the newest, are forgotten.
+
+	allowed *preparedFilter // Allowlisted prefixes, nil for none.
+	mu      sync.Mutex
+	states  *lruCache // Prefix to map[uint32]time.Time, each origin to when last seen.
+}
+
+// NewMOASDetector creates a MOASDetector skipping the prefixes within
+// allowlist, which must all be valid CIDR prefixes, and keeping state for at
+// most size prefixes, or defaultStateSize prefixes if size is not positive.
+func NewMOASDetector(window time.Duration, allowlist []string, size int) (*MOASDetector, error) {
+	for _, a := range allowlist {
+		if _, _, err := parsePrefix(a); err != nil {
+			return nil, fmt.Errorf("failed to parse allowlisted prefix(%v): %v", a, err)
+		}
+	}
+	return &MOASDetector{
+		Window:  window,
+		allowed: (&RisFilter{Prefix: allowlist}).compile(discardLogger),
+		states:  newLRUCache(size),
+	}, nil
+}
+
+// Observe records the origin of each prefix the message announces, and
+// returns an event for each prefix this origin makes a conflict of: another
+// origin was seen for it within the window, and this origin was not.
+func (m *MOASDetector) Observe(rm *RisMessageData) []MOASEvent {
+	origin := rm.OriginASN
+	if origin == 0 {
+		return nil
+	}
+	at := rm.Time()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.states == nil {
+		m.states = newLRUCache(0)
+	}
+
+	var events []MOASEvent
+	seen := map[string]bool{}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			// v6 announcements may list a prefix once per next-hop.
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			_, n, err := parsePrefix(p)
+			if err != nil {
+				continue
+			}
+			if m.allowed != nil {
+				if _, ok := m.allowed.covering(n); ok {
+					continue
+				}
+			}
+
+			v, ok := m.states.get(p)
+			if !ok {
+				v = map[uint32]time.Time{}
+				m.states.add(p, v)
+			}
+			origins := v.(map[uint32]time.Time)
+			// Forget origins which have left the window.
+			cutoff := at.Add(-m.Window)
+			for asn, last := range origins {
+				if last.Before(cutoff) {
+					delete(origins, asn)
+				}
+			}
+			_, known := origins[origin]
+			origins[origin] = at
+			if known || len(origins) < 2 {
+				continue
+			}
+			set := map[uint32]bool{}
+			for asn := range origins {
+				set[asn] = true
+			}
+			events = append(events, MOASEvent{Prefix: p, Origins: sortedASNs(set), At: at})
+		}
+	}
+	return events
+}
+
+// VisiblePrefix is a prefix currently announced, and the origin ASNs it is
+// announced from.
+type VisiblePrefix struct {
+	Prefix  string
+	Origins []uint32
+}
+
+// AggregateTracker follows the announcements and withdrawals of prefixes
+// within a set of monitored aggregates, to report which more-specifics of
+// each aggregate are visible and from which origins. Visibility is kept per
+// peer, a prefix is visible until every peer announcing it has withdrawn it.
+// An AggregateTracker is safe for concurrent use.
+type AggregateTracker struct {
+	aggregates *preparedFilter
+
+	mu      sync.Mutex
+	visible map[string]map[string]map[string]uint32 // Aggregate to prefix to peer to origin ASN.
+}
+
+// NewAggregateTracker creates a tracker for the aggregates, which must all be
+// valid CIDR prefixes.
+func NewAggregateTracker(aggregates []string) (*AggregateTracker, error) {
+	for _, a := range aggregates {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return nil, fmt.Errorf("failed to parse aggregate(%v): %v", a, err)
+		}
+	}
+	return &AggregateTracker{
+		aggregates: (&RisFilter{Prefix: aggregates}).compile(discardLogger),
+		visible:    map[string]map[string]map[string]uint32{},
+	}, nil
+}
+
+// Observe updates the visible prefixes from the message's announcements and
+// withdrawals. Prefixes outside every aggregate are ignored.
+func (a *AggregateTracker) Observe(rm *RisMessageData) {
+	origin := rm.OriginASN
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if origin != 0 {
+		for _, anns := range rm.Announcements {
+			for _, p := range anns.Prefixes {
+				agg, ok := a.aggregate(p)
+				if !ok {
+					continue
+				}
+				if a.visible[agg] == nil {
+					a.visible[agg] = map[string]map[string]uint32{}
+				}
+				if a.visible[agg][p] == nil {
+					a.visible[agg][p] = map[string]uint32{}
+				}
+				a.visible[agg][p][rm.Peer] = origin
+			}
+		}
+	}
+	for _, p := range rm.Withdrawals {
+		agg, ok := a.aggregate(p)
+		if !ok || a.visible[agg][p] == nil {
+			continue
+		}
+		delete(a.visible[agg][p], rm.Peer)
+		if len(a.visible[agg][p]) == 0 {
+			delete(a.visible[agg], p)
+		}
+	}
+}
+
+// aggregate returns the most specific monitored aggregate covering prefix.
+func (a *AggregateTracker) aggregate(prefix string) (string, bool) {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", false
+	}
+	agg, ok := a.aggregates.covering(n)
+	if !ok {
+		return "", false
+	}
+	return agg.String(), true
+}
+
+// AggregateReport returns a snapshot of the prefixes currently visible within
+// each aggregate, keyed by aggregate. Prefixes are sorted, as are each
+// prefix's origins. Aggregates with nothing visible are left out.
+func (a *AggregateTracker) AggregateReport() map[string][]VisiblePrefix {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := map[string][]VisiblePrefix{}
+	for agg, prefixes := range a.visible {
+		for p, peers := range prefixes {
+			seen := map[uint32]bool{}
+			vp := VisiblePrefix{Prefix: p}
+			for _, origin := range peers {
+				if !seen[origin] {
+					vp.Origins = append(vp.Origins, origin)
+				}
+				seen[origin] = true
+			}
+			sort.Slice(vp.Origins, func(i, j int) bool { return vp.Origins[i] < vp.Origins[j] })
+			report[agg] = append(report[agg], vp)
+		}
+		sort.Slice(report[agg], func(i, j int) bool { return report[agg][i].Prefix < report[agg][j].Prefix })
+	}
+	return report
+}
+
+// Observer is a collector peer which saw a message.
+type Observer struct {
+	Peer string `json:"peer"`
+	Host string `json:"host"`
+}
+
+// PeerGroup is one announcement, a prefix and path, with every collector
+// peer which observed it within the grouping window.
+type PeerGroup struct {
+	Prefix    string     `json:"prefix"`
+	Path      []uint32   `json:"path"`
+	First     time.Time  `json:"first"` // The timestamp of the first observation.
+	Observers []Observer `json:"observers"`
+}
+
+// PeerGrouper collapses the messages for the same prefix and path, seen by
+// many collector peers, into a PeerGroup per announcement. A group is
+// complete once Window has passed, by message timestamp, since its first
+// observation. One built without NewPeerGrouper is ready to use. A
+// PeerGrouper is safe for concurrent use.
+type PeerGrouper struct {
+	Window time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*PeerGroup // Prefix and path to the open group.
+}
+
+// NewPeerGrouper creates a PeerGrouper collecting observers for window.
+func NewPeerGrouper(window time.Duration) *PeerGrouper {
+	return &PeerGrouper{Window: window, groups: map[string]*PeerGroup{}}
+}
+
+// Add records the message's peer against each prefix it announces, and
+// returns the groups completed by the time of this message, oldest first.
+func (g *PeerGrouper) Add(rm *RisMessageData) []PeerGroup {
+	at := rm.Time()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.groups == nil {
+		g.groups = map[string]*PeerGroup{}
+	}
+
+	done := g.complete(func(pg *PeerGroup) bool { return at.Sub(pg.First) > g.Window })
+	obs := Observer{Peer: rm.Peer, Host: rm.Host}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			key := fmt.Sprintf("%v %v", p, rm.DigestedPath)
+			pg, ok := g.groups[key]
+			if !ok {
+				pg = &PeerGroup{Prefix: p, Path: rm.DigestedPath, First: at}
+				g.groups[key] = pg
+			}
+			seen := false
+			for _, o := range pg.Observers {
+				seen = seen || o == obs
+			}
+			if !seen {
+				pg.Observers = append(pg.Observers, obs)
+			}
+		}
+	}
+	return done
+}
+
+// Flush returns every open group, oldest first, complete or not.
+func (g *PeerGrouper) Flush() []PeerGroup {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.complete(func(*PeerGroup) bool { return true })
+}
+
+// complete removes and returns the groups for which done is true, sorted by
+// first observation then prefix.
+func (g *PeerGrouper) complete(done func(*PeerGroup) bool) []PeerGroup {
+	var groups []PeerGroup
+	for key, pg := range g.groups {
+		if done(pg) {
+			groups = append(groups, *pg)
+			delete(g.groups, key)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].First.Equal(groups[j].First) {
+			return groups[i].First.Before(groups[j].First)
+		}
+		return groups[i].Prefix < groups[j].Prefix
+	})
+	return groups
+}
+
+// OriginCount is the number of prefixes announced from an origin ASN.
+type OriginCount struct {
+	ASN   uint32
+	Count int
+}
+
+// OriginCounter counts the prefixes announced per origin ASN over the stream,
+// to report the most active origins. Set with WithOriginCounter, Listen feeds
+// it every message read, otherwise the caller feeds it with Observe. An
+// OriginCounter is safe for concurrent use.
+type OriginCounter struct {
+	mu     sync.Mutex
+	counts map[uint32]int
+}
+
+// WithOriginCounter makes Listen count every message it reads, matching the
+// filter or not, in o.
+func WithOriginCounter(o *OriginCounter) Option {
+	return func(r *RisLive) {
+		r.counter = o
+	}
+}
+
+// NewOriginCounter creates an empty OriginCounter.
+func NewOriginCounter() *OriginCounter {
+	return &OriginCounter{counts: map[uint32]int{}}
+}
+
+// Observe counts each prefix the message announces against its origin ASN.
+// A prefix listed for more than one next-hop is counted once.
+func (o *OriginCounter) Observe(rm *RisMessageData) {
+	if rm.OriginASN == 0 {
+		return
+	}
+	seen := map[string]bool{}
+	for _, anns := range rm.Announcements {
+		for _, p := range anns.Prefixes {
+			seen[p] = true
+		}
+	}
+	if len(seen) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.counts[rm.OriginASN] += len(seen)
+}
+
+// TopOrigins returns the n origins which announced the most prefixes, most
+// first, ties in ASN order. Every origin is returned if n is not positive.
+func (o *OriginCounter) TopOrigins(n int) []OriginCount {
+	o.mu.Lock()
+	top := make([]OriginCount, 0, len(o.counts))
+	for asn, count := range o.counts {
+		top = append(top, OriginCount{ASN: asn, Count: count})
+	}
+	o.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].ASN < top[j].ASN
+	})
+	if n > 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// OriginMismatch is a prefix of a seeded snapshot announced from an origin
+// ASN the snapshot does not hold for it, a possible hijack or MOAS.
+type OriginMismatch struct {
+	Prefix   string
+	Origin   uint32
+	Expected []uint32 // The snapshot's origins for the prefix, sorted.
+}
+
+// OriginMap keeps the origin ASNs each prefix has been announced from over
+// the stream. Seeded with an earlier export it reports prefixes announced
+// from an origin outside the seeded set. An OriginMap is safe for concurrent use.
+type OriginMap struct {
+	mu       sync.Mutex
+	observed map[string]map[uint32]bool // Prefix to the origins seen.
+	seeded   map[string]map[uint32]bool // Prefix to the expected origins.
+}
+
+// NewOriginMap creates an empty OriginMap.
+func NewOriginMap() *OriginMap {
+	return &OriginMap{observed: map[string]map[uint32]bool{}, seeded: map[string]map[uint32]bool{}}
+}
+
+// Seed sets the expected origins of each prefix in snapshot, as returned by
+// ExportOriginMap or LoadOriginMap, replacing any seeded before. The
+// snapshot's origins are also taken as observed.
+func (o *OriginMap) Seed(snapshot map[string][]uint32) error {
+	seeded := map[string]map[uint32]bool{}
+	for prefix, origins := range snapshot {
+		_, n, err := parsePrefix(prefix)
+		if err != nil {
+			return fmt.Errorf("failed to parse snapshot prefix(%v): %v", prefix, err)
+		}
+		seeded[n.String()] = map[uint32]bool{}
+		for _, asn := range origins {
+			seeded[n.String()][asn] = true
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seeded = seeded
+	for prefix, origins := range seeded {
+		if o.observed[prefix] == nil {
+			o.observed[prefix] = map[uint32]bool{}
+		}
+		for asn := range origins {
+			o.observed[prefix][asn] = true
+		}
+	}
+	return nil
+}
+
+// Observe records the origin of each prefix the message announces, and
+// returns a mismatch for each seeded prefix the first time it is seen from
+// an origin not seeded for it. Prefixes not in the snapshot are recorded
+// without being checked. Prefixes are kept in canonical form, as Seed keeps
+// them, so "2001:DB8::/32" is "2001:db8::/32"; one which does not parse is
+// skipped.
+func (o *OriginMap) Observe(rm *RisMessageData) []OriginMismatch {
+	origin := rm.OriginASN
+	if origin == 0 {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var mismatches []OriginMismatch
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			_, n, err := parsePrefix(prefix)
+			if err != nil {
+				continue
+			}
+			p := n.String()
+			if o.observed[p] == nil {
+				o.observed[p] = map[uint32]bool{}
+			}
+			if o.observed[p][origin] {
+				continue
+			}
+			o.observed[p][origin] = true
+			if expected, ok := o.seeded[p]; ok && !expected[origin] {
+				mismatches = append(mismatches, OriginMismatch{Prefix: p, Origin: origin, Expected: sortedASNs(expected)})
+			}
+		}
+	}
+	return mismatches
+}
+
+// ExportOriginMap returns a snapshot of the origins seen for each prefix,
+// each sorted, ready to be written as JSON and seeded into a later run.
+func (o *OriginMap) ExportOriginMap() map[string][]uint32 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	export := make(map[string][]uint32, len(o.observed))
+	for prefix, origins := range o.observed {
+		export[prefix] = sortedASNs(origins)
+	}
+	return export
+}
+
+// LoadOriginMap reads a snapshot written as JSON from an ExportOriginMap,
+// to Seed an OriginMap with.
+func LoadOriginMap(path string) (map[string][]uint32, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read origin map(%v): %v", path, err)
+	}
+	var snapshot map[string][]uint32
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode origin map(%v): %v", path, err)
+	}
+	return snapshot, nil
+}
+
+// sortedASNs returns the members of the set in order.
+func sortedASNs(set map[uint32]bool) []uint32 {
+	asns := make([]uint32, 0, len(set))
+	for asn := range set {
+		asns = append(asns, asn)
+	}
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+	return asns
+}
@@ -0,0 +1,756 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a", 1)
+	c.add("b", 2)
+	// Touch a, so b is the least recently used when c arrives.
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("a missing from the cache")
+	}
+	c.add("c", 3)
+
+	if got := c.len(); got != 2 {
+		t.Errorf("got/want mismatch on length, got: %v want: %v", got, 2)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Errorf("b was not evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		got, ok := c.get(key)
+		if !ok || got.(int) != want {
+			t.Errorf("got/want mismatch for %v, got: %v want: %v", key, got, want)
+		}
+	}
+}
+
+func TestOriginChange(t *testing.T) {
+	type result struct {
+		Prefix  string
+		Old     uint32
+		New     uint32
+		Changed bool
+	}
+	announce := func(origin uint32, prefixes ...string) *RisMessageData {
+		return &RisMessageData{
+			DigestedPath:  []uint32{3356, origin},
+			OriginASN:     origin,
+			Announcements: []*RisAnnouncement{{Prefixes: prefixes}},
+		}
+	}
+
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		size   int
+		msgs   []*RisMessageData
+		want   []result
+	}{{
+		desc:   "Success origin changed",
+		filter: &RisFilter{},
+		msgs:   []*RisMessageData{announce(15169, "8.8.8.0/24"), announce(64512, "8.8.8.0/24")},
+		want:   []result{{}, {Prefix: "8.8.8.0/24", Old: 15169, New: 64512, Changed: true}},
+	}, {
+		desc:   "Success origin unchanged",
+		filter: &RisFilter{},
+		msgs:   []*RisMessageData{announce(15169, "8.8.8.0/24"), announce(15169, "8.8.8.0/24")},
+		want:   []result{{}, {}},
+	}, {
+		desc:   "Success other prefix does not change origin",
+		filter: &RisFilter{},
+		msgs:   []*RisMessageData{announce(15169, "8.8.8.0/24"), announce(64512, "8.8.4.0/24")},
+		want:   []result{{}, {}},
+	}, {
+		desc:   "Success unmonitored prefix ignored",
+		filter: &RisFilter{Prefix: []string{"8.8.4.0/24"}},
+		msgs:   []*RisMessageData{announce(15169, "8.8.8.0/24"), announce(64512, "8.8.8.0/24")},
+		want:   []result{{}, {}},
+	}, {
+		desc:   "Success monitored more specific",
+		filter: &RisFilter{Prefix: []string{"8.8.0.0/16"}},
+		msgs:   []*RisMessageData{announce(15169, "8.8.8.0/24"), announce(64512, "8.8.8.0/24")},
+		want:   []result{{}, {Prefix: "8.8.8.0/24", Old: 15169, New: 64512, Changed: true}},
+	}, {
+		desc:   "Success evicted prefix is forgotten",
+		filter: &RisFilter{},
+		size:   1,
+		msgs: []*RisMessageData{
+			announce(15169, "8.8.8.0/24"),
+			announce(15169, "8.8.4.0/24"),
+			announce(64512, "8.8.8.0/24"),
+		},
+		want: []result{{}, {}, {}},
+	}, {
+		desc:   "Success no path",
+		filter: &RisFilter{},
+		msgs: []*RisMessageData{
+			announce(15169, "8.8.8.0/24"),
+			{Announcements: []*RisAnnouncement{{Prefixes: []string{"8.8.8.0/24"}}}},
+		},
+		want: []result{{}, {}},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter, OriginStateSize: test.size}
+		var got []result
+		for _, msg := range test.msgs {
+			var res result
+			res.Prefix, res.Old, res.New, res.Changed = r.OriginChange(msg)
+			got = append(got, res)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestFlapDetector(t *testing.T) {
+	const prefix = "192.0.2.0/24"
+	announce := func(ts float64) *RisMessageData {
+		return &RisMessageData{
+			Timestamp:     ts,
+			Announcements: []*RisAnnouncement{{Prefixes: []string{prefix}}},
+		}
+	}
+	withdraw := func(ts float64) *RisMessageData {
+		return &RisMessageData{Timestamp: ts, Withdrawals: []string{prefix}}
+	}
+
+	tests := []struct {
+		desc      string
+		window    time.Duration
+		threshold int
+		msgs      []*RisMessageData
+		want      []FlapEvent
+	}{{
+		desc:      "Success flap within the window",
+		window:    time.Minute,
+		threshold: 3,
+		msgs:      []*RisMessageData{announce(100), withdraw(110), announce(120), withdraw(130)},
+		want:      []FlapEvent{{Prefix: prefix, Count: 3, At: time.Unix(130, 0)}},
+	}, {
+		desc:      "Success flap reported once while above the threshold",
+		window:    time.Minute,
+		threshold: 2,
+		msgs:      []*RisMessageData{announce(100), withdraw(110), announce(120), withdraw(130)},
+		want:      []FlapEvent{{Prefix: prefix, Count: 2, At: time.Unix(120, 0)}},
+	}, {
+		desc:      "Success changes spread beyond the window",
+		window:    time.Minute,
+		threshold: 3,
+		msgs:      []*RisMessageData{announce(100), withdraw(110), announce(200), withdraw(300)},
+	}, {
+		desc:      "Success repeated announcements are not changes",
+		window:    time.Minute,
+		threshold: 2,
+		msgs:      []*RisMessageData{announce(100), announce(110), announce(120), announce(130)},
+	}}
+
+	for _, test := range tests {
+		fd := NewFlapDetector(test.window, test.threshold, 0)
+		// A detector built as a literal behaves the same.
+		literal := &FlapDetector{Window: test.window, Threshold: test.threshold}
+		var got, gotLiteral []FlapEvent
+		for _, msg := range test.msgs {
+			got = append(got, fd.Observe(msg)...)
+			gotLiteral = append(gotLiteral, literal.Observe(msg)...)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if diff := cmp.Diff(gotLiteral, test.want); diff != "" {
+			t.Errorf("[%v]: literal got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestAggregateReport(t *testing.T) {
+	msg := func(peer string, path []uint32, announced, withdrawn []string) *RisMessageData {
+		var origin uint32
+		if len(path) > 0 {
+			origin = path[len(path)-1]
+		}
+		return &RisMessageData{
+			Peer:          peer,
+			DigestedPath:  path,
+			OriginASN:     origin,
+			Announcements: []*RisAnnouncement{{Prefixes: announced}},
+			Withdrawals:   withdrawn,
+		}
+	}
+
+	tests := []struct {
+		desc       string
+		aggregates []string
+		msgs       []*RisMessageData
+		want       map[string][]VisiblePrefix
+	}{{
+		desc:       "Success more-specifics grouped under their aggregate",
+		aggregates: []string{"192.0.0.0/16", "2001:db8::/32"},
+		msgs: []*RisMessageData{
+			msg("peer1", []uint32{3356, 64500}, []string{"192.0.2.0/24", "192.0.3.0/24"}, nil),
+			msg("peer2", []uint32{174, 64501}, []string{"192.0.2.0/24"}, nil),
+			msg("peer1", []uint32{3356, 64500}, []string{"2001:db8:1::/48"}, nil),
+			msg("peer1", []uint32{3356, 64500}, []string{"198.51.100.0/24"}, nil),
+		},
+		want: map[string][]VisiblePrefix{
+			"192.0.0.0/16": {
+				{Prefix: "192.0.2.0/24", Origins: []uint32{64500, 64501}},
+				{Prefix: "192.0.3.0/24", Origins: []uint32{64500}},
+			},
+			"2001:db8::/32": {
+				{Prefix: "2001:db8:1::/48", Origins: []uint32{64500}},
+			},
+		},
+	}, {
+		desc:       "Success prefix grouped under the most specific aggregate",
+		aggregates: []string{"192.0.0.0/16", "192.0.2.0/23"},
+		msgs: []*RisMessageData{
+			msg("peer1", []uint32{3356, 64500}, []string{"192.0.2.0/24", "192.0.8.0/24"}, nil),
+		},
+		want: map[string][]VisiblePrefix{
+			"192.0.0.0/16": {{Prefix: "192.0.8.0/24", Origins: []uint32{64500}}},
+			"192.0.2.0/23": {{Prefix: "192.0.2.0/24", Origins: []uint32{64500}}},
+		},
+	}, {
+		desc:       "Success visible until every peer withdraws",
+		aggregates: []string{"192.0.0.0/16"},
+		msgs: []*RisMessageData{
+			msg("peer1", []uint32{3356, 64500}, []string{"192.0.2.0/24", "192.0.3.0/24"}, nil),
+			msg("peer2", []uint32{174, 64500}, []string{"192.0.2.0/24"}, nil),
+			msg("peer1", nil, nil, []string{"192.0.2.0/24", "192.0.3.0/24"}),
+		},
+		want: map[string][]VisiblePrefix{
+			"192.0.0.0/16": {{Prefix: "192.0.2.0/24", Origins: []uint32{64500}}},
+		},
+	}, {
+		desc:       "Success all withdrawn",
+		aggregates: []string{"192.0.0.0/16"},
+		msgs: []*RisMessageData{
+			msg("peer1", []uint32{3356, 64500}, []string{"192.0.2.0/24"}, nil),
+			msg("peer1", nil, nil, []string{"192.0.2.0/24"}),
+		},
+		want: map[string][]VisiblePrefix{},
+	}}
+
+	for _, test := range tests {
+		a, err := NewAggregateTracker(test.aggregates)
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tracker: %v", test.desc, err)
+		}
+		for _, m := range test.msgs {
+			a.Observe(m)
+		}
+		if diff := cmp.Diff(a.AggregateReport(), test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+
+	if _, err := NewAggregateTracker([]string{"192.b.0.0/16"}); err == nil {
+		t.Errorf("did not get error creating a tracker with an invalid aggregate")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	msg := func(peer string, ts float64, path []uint32, prefixes ...string) *RisMessageData {
+		rmd := NewTestMessage(path, "igp", prefixes...).Data
+		rmd.Peer = peer
+		rmd.Timestamp = ts
+		return rmd
+	}
+
+	tests := []struct {
+		desc string
+		msgs []*RisMessageData
+		want []bool
+	}{{
+		desc: "Success same prefix, origin and path from two peers",
+		msgs: []*RisMessageData{
+			msg("192.0.2.1", 100, []uint32{3356, 64500}, "198.51.100.0/24"),
+			msg("192.0.2.2", 101, []uint32{3356, 64500}, "198.51.100.0/24"),
+		},
+		want: []bool{false, true},
+	}, {
+		desc: "Success different path passes",
+		msgs: []*RisMessageData{
+			msg("192.0.2.1", 100, []uint32{3356, 64500}, "198.51.100.0/24"),
+			msg("192.0.2.2", 101, []uint32{174, 64500}, "198.51.100.0/24"),
+		},
+		want: []bool{false, false},
+	}, {
+		desc: "Success repeat after the window passes",
+		msgs: []*RisMessageData{
+			msg("192.0.2.1", 100, []uint32{3356, 64500}, "198.51.100.0/24"),
+			msg("192.0.2.2", 130, []uint32{3356, 64500}, "198.51.100.0/24"),
+			msg("192.0.2.3", 161, []uint32{3356, 64500}, "198.51.100.0/24"),
+		},
+		want: []bool{false, true, false},
+	}, {
+		desc: "Success one new prefix passes the whole message",
+		msgs: []*RisMessageData{
+			msg("192.0.2.1", 100, []uint32{3356, 64500}, "198.51.100.0/24"),
+			msg("192.0.2.2", 101, []uint32{3356, 64500}, "198.51.100.0/24", "203.0.113.0/24"),
+		},
+		want: []bool{false, false},
+	}, {
+		desc: "Success repeated withdrawal",
+		msgs: []*RisMessageData{
+			{Timestamp: 100, Withdrawals: []string{"198.51.100.0/24"}},
+			{Timestamp: 101, Withdrawals: []string{"198.51.100.0/24"}},
+		},
+		want: []bool{false, true},
+	}, {
+		desc: "Success no prefixes is never a duplicate",
+		msgs: []*RisMessageData{{Timestamp: 100}, {Timestamp: 101}},
+		want: []bool{false, false},
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{DedupWindow: time.Minute}
+		var got []bool
+		for _, m := range test.msgs {
+			got = append(got, r.duplicate(m))
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestPeerGrouper(t *testing.T) {
+	msg := func(peer, host string, ts float64, path []uint32, prefixes ...string) *RisMessageData {
+		rmd := NewTestMessage(path, "igp", prefixes...).Data
+		rmd.Peer, rmd.Host, rmd.Timestamp = peer, host, ts
+		return rmd
+	}
+	path := []uint32{3356, 64500}
+
+	g := NewPeerGrouper(10 * time.Second)
+	var got []PeerGroup
+	for _, m := range []*RisMessageData{
+		msg("192.0.2.1", "rrc00", 100, path, "198.51.100.0/24"),
+		msg("192.0.2.2", "rrc01", 101, path, "198.51.100.0/24"),
+		// The same peer again is not a new observer.
+		msg("192.0.2.2", "rrc01", 102, path, "198.51.100.0/24"),
+		msg("192.0.2.3", "rrc00", 103, []uint32{174, 64500}, "198.51.100.0/24"),
+		// Completes the groups opened at 100 and 103.
+		msg("192.0.2.1", "rrc00", 120, path, "203.0.113.0/24"),
+	} {
+		got = append(got, g.Add(m)...)
+	}
+	got = append(got, g.Flush()...)
+
+	want := []PeerGroup{{
+		Prefix: "198.51.100.0/24",
+		Path:   path,
+		First:  time.Unix(100, 0),
+		Observers: []Observer{
+			{Peer: "192.0.2.1", Host: "rrc00"},
+			{Peer: "192.0.2.2", Host: "rrc01"},
+		},
+	}, {
+		Prefix:    "198.51.100.0/24",
+		Path:      []uint32{174, 64500},
+		First:     time.Unix(103, 0),
+		Observers: []Observer{{Peer: "192.0.2.3", Host: "rrc00"}},
+	}, {
+		Prefix:    "203.0.113.0/24",
+		Path:      path,
+		First:     time.Unix(120, 0),
+		Observers: []Observer{{Peer: "192.0.2.1", Host: "rrc00"}},
+	}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+// A grouper built as a literal is ready to use.
+func TestPeerGrouperLiteral(t *testing.T) {
+	g := &PeerGrouper{Window: 10 * time.Second}
+	g.Add(NewTestMessage([]uint32{3356, 64500}, "igp", "198.51.100.0/24").Data)
+	if got := g.Flush(); len(got) != 1 || got[0].Prefix != "198.51.100.0/24" {
+		t.Errorf("got groups %v, wanted one for 198.51.100.0/24", got)
+	}
+}
+
+func TestTopOrigins(t *testing.T) {
+	oc := NewOriginCounter()
+	r := &RisLive{File: proto.String("testdata/10-msg")}
+	sub := r.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for rm := range sub {
+			oc.Observe(rm.Data)
+		}
+	}()
+	r.Listen()
+	<-done
+
+	tests := []struct {
+		desc string
+		n    int
+		want []OriginCount
+	}{{
+		desc: "Top origin",
+		n:    1,
+		want: []OriginCount{{ASN: 12654, Count: 4}},
+	}, {
+		desc: "Top three, ties in ASN order",
+		n:    3,
+		want: []OriginCount{{ASN: 12654, Count: 4}, {ASN: 22884, Count: 1}, {ASN: 37006, Count: 1}},
+	}, {
+		desc: "Every origin",
+		n:    0,
+		want: []OriginCount{
+			{ASN: 12654, Count: 4}, {ASN: 22884, Count: 1}, {ASN: 37006, Count: 1},
+			{ASN: 37187, Count: 1}, {ASN: 37650, Count: 1},
+		},
+	}, {
+		desc: "More than there are origins",
+		n:    10,
+		want: []OriginCount{
+			{ASN: 12654, Count: 4}, {ASN: 22884, Count: 1}, {ASN: 37006, Count: 1},
+			{ASN: 37187, Count: 1}, {ASN: 37650, Count: 1},
+		},
+	}}
+
+	for _, test := range tests {
+		got := oc.TopOrigins(test.n)
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		}
+	}
+}
+
+// WithOriginCounter counts every message Listen reads, without feeding it.
+func TestWithOriginCounter(t *testing.T) {
+	oc := NewOriginCounter()
+	buffer := 10
+	r := NewRisLive(proto.String(""), proto.String("testdata/10-msg"), proto.String(""), &RisFilter{Origins: []string{"64500"}}, &buffer, WithOriginCounter(oc))
+	r.Listen()
+
+	want := []OriginCount{{ASN: 12654, Count: 4}, {ASN: 22884, Count: 1}}
+	if got := oc.TopOrigins(2); !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+}
+
+func TestDeaggregation(t *testing.T) {
+	announce := func(ts float64, origin uint32, prefixes ...string) *RisMessageData {
+		return &RisMessageData{
+			Timestamp:     ts,
+			DigestedPath:  []uint32{3356, origin},
+			OriginASN:     origin,
+			Announcements: []*RisAnnouncement{{Prefixes: prefixes}},
+		}
+	}
+	// The /24s of 10.1.0.0/16 announced from origin, one a second from ts.
+	slash24s := func(ts float64, origin uint32, n int) []*RisMessageData {
+		var msgs []*RisMessageData
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, announce(ts+float64(i), origin, fmt.Sprintf("10.1.%d.0/24", i)))
+		}
+		return msgs
+	}
+	filter := &RisFilter{Prefix: []string{"10.1.0.0/16"}}
+
+	tests := []struct {
+		desc      string
+		filter    *RisFilter
+		threshold int
+		window    time.Duration
+		msgs      []*RisMessageData
+		want      []DeaggEvent
+	}{{
+		desc:      "Success many /24s from one origin reported once",
+		filter:    filter,
+		threshold: 10,
+		window:    time.Minute,
+		msgs:      slash24s(1000, 64500, 20),
+		want:      []DeaggEvent{{Aggregate: "10.1.0.0/16", Origin: 64500, Count: 11, At: time.Unix(1010, 0)}},
+	}, {
+		desc:      "Success within the threshold",
+		filter:    filter,
+		threshold: 10,
+		window:    time.Minute,
+		msgs:      slash24s(1000, 64500, 10),
+	}, {
+		desc:      "Success repeats of one more-specific counted once",
+		filter:    filter,
+		threshold: 1,
+		window:    time.Minute,
+		msgs:      []*RisMessageData{announce(1000, 64500, "10.1.0.0/24"), announce(1001, 64500, "10.1.0.0/24")},
+	}, {
+		desc:      "Success origins counted apart",
+		filter:    filter,
+		threshold: 10,
+		window:    time.Minute,
+		msgs:      append(slash24s(1000, 64500, 6), slash24s(1006, 64501, 6)...),
+	}, {
+		desc:      "Success more-specifics leave the window",
+		filter:    filter,
+		threshold: 10,
+		window:    5 * time.Second,
+		msgs:      slash24s(1000, 64500, 20),
+	}, {
+		desc:      "Success aggregate itself not counted",
+		filter:    filter,
+		threshold: 1,
+		window:    time.Minute,
+		msgs:      []*RisMessageData{announce(1000, 64500, "10.1.0.0/16", "10.1.0.0/24")},
+	}, {
+		desc:      "Success reported again after falling back",
+		filter:    filter,
+		threshold: 2,
+		window:    5 * time.Second,
+		msgs: []*RisMessageData{
+			announce(1000, 64500, "10.1.0.0/24", "10.1.1.0/24", "10.1.2.0/24"),
+			announce(1010, 64500, "10.1.3.0/24"),
+			announce(1011, 64500, "10.1.4.0/24", "10.1.5.0/24"),
+		},
+		want: []DeaggEvent{
+			{Aggregate: "10.1.0.0/16", Origin: 64500, Count: 3, At: time.Unix(1000, 0)},
+			{Aggregate: "10.1.0.0/16", Origin: 64500, Count: 3, At: time.Unix(1011, 0)},
+		},
+	}, {
+		desc:      "Success unmonitored prefixes ignored",
+		filter:    filter,
+		threshold: 1,
+		window:    time.Minute,
+		msgs:      []*RisMessageData{announce(1000, 64500, "10.2.0.0/24", "10.2.1.0/24")},
+	}, {
+		desc:      "Success no filter prefixes",
+		filter:    &RisFilter{},
+		threshold: 1,
+		window:    time.Minute,
+		msgs:      slash24s(1000, 64500, 5),
+	}, {
+		desc:   "Success disabled",
+		filter: filter,
+		window: time.Minute,
+		msgs:   slash24s(1000, 64500, 5),
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter, DeaggThreshold: test.threshold, DeaggWindow: test.window}
+		var got []DeaggEvent
+		for _, msg := range test.msgs {
+			got = append(got, r.Deaggregation(msg)...)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+// Prefixes are kept as Seed keeps them, however the message writes them.
+func TestOriginMapCanonical(t *testing.T) {
+	o := NewOriginMap()
+	if err := o.Seed(map[string][]uint32{"2001:db8::/32": {64500}}); err != nil {
+		t.Fatalf("got error when not expecting one: %v", err)
+	}
+	got := o.Observe(&RisMessageData{
+		DigestedPath:  []uint32{3356, 64666},
+		OriginASN:     64666,
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"2001:DB8::/32", "not-a-prefix"}}},
+	})
+	want := []OriginMismatch{{Prefix: "2001:db8::/32", Origin: 64666, Expected: []uint32{64500}}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	wantExport := map[string][]uint32{"2001:db8::/32": {64500, 64666}}
+	if diff := cmp.Diff(o.ExportOriginMap(), wantExport); diff != "" {
+		t.Errorf("export got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestOriginMap(t *testing.T) {
+	announce := func(origin uint32, prefixes ...string) *RisMessageData {
+		return &RisMessageData{
+			DigestedPath:  []uint32{3356, origin},
+			OriginASN:     origin,
+			Announcements: []*RisAnnouncement{{Prefixes: prefixes}},
+		}
+	}
+	// A first run, exported as JSON for the second run to seed from.
+	first := NewOriginMap()
+	first.Observe(announce(64500, "192.0.2.0/24", "198.51.100.0/24"))
+	first.Observe(announce(64501, "198.51.100.0/24"))
+	snapshot := first.ExportOriginMap()
+	wantSnapshot := map[string][]uint32{"192.0.2.0/24": {64500}, "198.51.100.0/24": {64500, 64501}}
+	if diff := cmp.Diff(snapshot, wantSnapshot); diff != "" {
+		t.Fatalf("export got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("failed to marshal snapshot: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "origins.json")
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		msgs []*RisMessageData
+		want []OriginMismatch
+	}{{
+		desc: "Success seeded origin",
+		msgs: []*RisMessageData{announce(64500, "192.0.2.0/24"), announce(64501, "198.51.100.0/24")},
+	}, {
+		desc: "Success MOAS against the snapshot",
+		msgs: []*RisMessageData{announce(64500, "192.0.2.0/24"), announce(64666, "192.0.2.0/24")},
+		want: []OriginMismatch{{Prefix: "192.0.2.0/24", Origin: 64666, Expected: []uint32{64500}}},
+	}, {
+		desc: "Success mismatch reported once",
+		msgs: []*RisMessageData{announce(64666, "198.51.100.0/24"), announce(64666, "198.51.100.0/24")},
+		want: []OriginMismatch{{Prefix: "198.51.100.0/24", Origin: 64666, Expected: []uint32{64500, 64501}}},
+	}, {
+		desc: "Success prefix written with host bits checked as the seeded prefix",
+		msgs: []*RisMessageData{announce(64666, "192.0.2.1/24")},
+		want: []OriginMismatch{{Prefix: "192.0.2.0/24", Origin: 64666, Expected: []uint32{64500}}},
+	}, {
+		desc: "Success prefix outside the snapshot not checked",
+		msgs: []*RisMessageData{announce(64500, "203.0.113.0/24"), announce(64666, "203.0.113.0/24")},
+	}, {
+		desc: "Success no path",
+		msgs: []*RisMessageData{{Announcements: []*RisAnnouncement{{Prefixes: []string{"192.0.2.0/24"}}}}},
+	}}
+
+	for _, test := range tests {
+		seed, err := LoadOriginMap(file)
+		if err != nil {
+			t.Fatalf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		o := NewOriginMap()
+		if err := o.Seed(seed); err != nil {
+			t.Fatalf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		var got []OriginMismatch
+		for _, msg := range test.msgs {
+			got = append(got, o.Observe(msg)...)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+
+	if err := NewOriginMap().Seed(map[string][]uint32{"192.0.2": {64500}}); err == nil {
+		t.Errorf("did not get error seeding a bad prefix")
+	}
+	if _, err := LoadOriginMap("testdata/no-such-origin-map.json"); err == nil {
+		t.Errorf("did not get error loading a missing snapshot")
+	}
+}
+
+func TestMOASDetector(t *testing.T) {
+	announce := func(ts float64, prefix string, path ...uint32) *RisMessageData {
+		var origin uint32
+		if len(path) > 0 {
+			origin = path[len(path)-1]
+		}
+		return &RisMessageData{
+			Timestamp:     ts,
+			DigestedPath:  path,
+			OriginASN:     origin,
+			Announcements: []*RisAnnouncement{{Prefixes: []string{prefix}}},
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		allowlist []string
+		msgs      []*RisMessageData
+		want      []MOASEvent
+	}{{
+		desc: "Success second origin within the window",
+		msgs: []*RisMessageData{
+			announce(100, "192.0.2.0/24", 174, 64500),
+			announce(110, "192.0.2.0/24", 174, 64500),
+			announce(120, "192.0.2.0/24", 3356, 64501),
+			announce(130, "192.0.2.0/24", 3356, 64501),
+		},
+		want: []MOASEvent{{Prefix: "192.0.2.0/24", Origins: []uint32{64500, 64501}, At: time.Unix(120, 0)}},
+	}, {
+		desc: "Success third origin reported again",
+		msgs: []*RisMessageData{
+			announce(100, "192.0.2.0/24", 64500),
+			announce(110, "192.0.2.0/24", 64501),
+			announce(120, "192.0.2.0/24", 64502),
+		},
+		want: []MOASEvent{
+			{Prefix: "192.0.2.0/24", Origins: []uint32{64500, 64501}, At: time.Unix(110, 0)},
+			{Prefix: "192.0.2.0/24", Origins: []uint32{64500, 64501, 64502}, At: time.Unix(120, 0)},
+		},
+	}, {
+		desc: "Success origin change beyond the window",
+		msgs: []*RisMessageData{
+			announce(100, "192.0.2.0/24", 64500),
+			announce(200, "192.0.2.0/24", 64501),
+		},
+	}, {
+		desc: "Success different prefixes do not conflict",
+		msgs: []*RisMessageData{
+			announce(100, "192.0.2.0/24", 64500),
+			announce(110, "198.51.100.0/24", 64501),
+		},
+	}, {
+		desc:      "Success allowlisted anycast prefix suppressed",
+		allowlist: []string{"192.0.2.0/23"},
+		msgs: []*RisMessageData{
+			announce(100, "192.0.2.0/24", 64500),
+			announce(110, "192.0.2.0/24", 64501),
+			announce(120, "198.51.100.0/24", 64500),
+			announce(130, "198.51.100.0/24", 64501),
+		},
+		want: []MOASEvent{{Prefix: "198.51.100.0/24", Origins: []uint32{64500, 64501}, At: time.Unix(130, 0)}},
+	}}
+
+	for _, test := range tests {
+		m, err := NewMOASDetector(time.Minute, test.allowlist, 0)
+		if err != nil {
+			t.Fatalf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		var got []MOASEvent
+		for _, msg := range test.msgs {
+			got = append(got, m.Observe(msg)...)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+// A detector built as a literal has no allowlist, every prefix is checked.
+func TestMOASDetectorLiteral(t *testing.T) {
+	m := &MOASDetector{Window: time.Minute}
+	var got []MOASEvent
+	for i, origin := range []uint32{64500, 64501} {
+		rm := NewTestMessage([]uint32{3356, origin}, "igp", "192.0.2.0/24").Data
+		rm.Timestamp = float64(100 + i*10)
+		got = append(got, m.Observe(rm)...)
+	}
+	want := []MOASEvent{{Prefix: "192.0.2.0/24", Origins: []uint32{64500, 64501}, At: time.Unix(110, 0)}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestNewMOASDetectorBadAllowlist(t *testing.T) {
+	if _, err := NewMOASDetector(time.Minute, []string{"not a prefix"}, 0); err == nil {
+		t.Errorf("did not get error for an allowlist which is not a prefix")
+	}
+}
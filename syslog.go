@@ -0,0 +1,83 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// syslogWriter is the part of a *syslog.Writer used by SyslogSink.
+type syslogWriter interface {
+	Emerg(string) error
+	Alert(string) error
+	Crit(string) error
+	Err(string) error
+	Warning(string) error
+	Notice(string) error
+	Info(string) error
+	Debug(string) error
+}
+
+// SyslogSink logs a one line alert for each matched message to syslog.
+type SyslogSink struct {
+	Priority syslog.Priority // The facility and severity messages are logged with.
+	w        syslogWriter
+}
+
+// NewSyslogSink creates a SyslogSink logging to the local syslog daemon with
+// the given facility and severity, each line tagged with tag.
+func NewSyslogSink(priority syslog.Priority, tag string) (*SyslogSink, error) {
+	w, err := syslog.New(priority, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	return &SyslogSink{Priority: priority, w: w}, nil
+}
+
+// Write logs the message at the sink's severity.
+func (s *SyslogSink) Write(rm RisMessage) error {
+	if rm.Data == nil {
+		return errors.New("can not log a message without data")
+	}
+	line := syslogLine(rm.Data)
+	// The low 3 bits of a Priority are the severity.
+	switch s.Priority & 0x07 {
+	case syslog.LOG_EMERG:
+		return s.w.Emerg(line)
+	case syslog.LOG_ALERT:
+		return s.w.Alert(line)
+	case syslog.LOG_CRIT:
+		return s.w.Crit(line)
+	case syslog.LOG_ERR:
+		return s.w.Err(line)
+	case syslog.LOG_WARNING:
+		return s.w.Warning(line)
+	case syslog.LOG_NOTICE:
+		return s.w.Notice(line)
+	case syslog.LOG_INFO:
+		return s.w.Info(line)
+	default:
+		return s.w.Debug(line)
+	}
+}
+
+// syslogLine renders the message as a concise alert, ie:
+//
+//	prefix=8.8.8.0/24 origin=15169 path="3356 15169" peer=192.0.2.1 collector=rrc00
+func syslogLine(rm *RisMessageData) string {
+	prefixes := []string{}
+	for _, a := range rm.Announcements {
+		prefixes = append(prefixes, a.Prefixes...)
+	}
+	path := []string{}
+	for _, asn := range rm.DigestedPath {
+		path = append(path, fmt.Sprint(asn))
+	}
+	origin := rm.OriginASN
+	return fmt.Sprintf("prefix=%v origin=%v path=%q peer=%v collector=%v",
+		strings.Join(prefixes, ","), origin, strings.Join(path, " "), rm.Peer, rm.Host)
+}
@@ -0,0 +1,85 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log/syslog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSyslog records each line by the severity it was logged at.
+type fakeSyslog struct {
+	lines map[string][]string
+}
+
+func (f *fakeSyslog) log(sev, m string) error {
+	if f.lines == nil {
+		f.lines = map[string][]string{}
+	}
+	f.lines[sev] = append(f.lines[sev], m)
+	return nil
+}
+
+func (f *fakeSyslog) Emerg(m string) error   { return f.log("emerg", m) }
+func (f *fakeSyslog) Alert(m string) error   { return f.log("alert", m) }
+func (f *fakeSyslog) Crit(m string) error    { return f.log("crit", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.log("err", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.log("warning", m) }
+func (f *fakeSyslog) Notice(m string) error  { return f.log("notice", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.log("info", m) }
+func (f *fakeSyslog) Debug(m string) error   { return f.log("debug", m) }
+
+func TestSyslogSink(t *testing.T) {
+	rm := RisMessage{Type: "ris_message", Data: &RisMessageData{
+		Peer:         "196.60.9.165",
+		Host:         "rrc19",
+		DigestedPath: []uint32{57695, 37650},
+		OriginASN:    37650,
+		Announcements: []*RisAnnouncement{
+			{Prefixes: []string{"196.50.70.0/24"}},
+		},
+	}}
+	line := `prefix=196.50.70.0/24 origin=37650 path="57695 37650" peer=196.60.9.165 collector=rrc19`
+
+	tests := []struct {
+		desc     string
+		priority syslog.Priority
+		msg      RisMessage
+		want     map[string][]string
+		wantErr  bool
+	}{{
+		desc:     "Success warning",
+		priority: syslog.LOG_DAEMON | syslog.LOG_WARNING,
+		msg:      rm,
+		want:     map[string][]string{"warning": {line}},
+	}, {
+		desc:     "Success alert",
+		priority: syslog.LOG_LOCAL0 | syslog.LOG_ALERT,
+		msg:      rm,
+		want:     map[string][]string{"alert": {line}},
+	}, {
+		desc:     "Failure message without data",
+		priority: syslog.LOG_DAEMON | syslog.LOG_WARNING,
+		msg:      RisMessage{Type: "ris_message"},
+		wantErr:  true,
+	}}
+
+	for _, test := range tests {
+		w := &fakeSyslog{}
+		s := &SyslogSink{Priority: test.priority, w: w}
+		err := s.Write(test.msg)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(w.lines, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+// NewTestMessage builds a fully populated UPDATE ris_message, as Listen would
+// deliver it, with the path already digested. The path's first ASN is the
+// peer ASN, the prefixes are announced in a single announcement.
+func NewTestMessage(path []uint32, origin string, prefixes ...string) RisMessage {
+	p := []interface{}{}
+	for _, asn := range path {
+		p = append(p, float64(asn))
+	}
+	peerASN := ""
+	var originASN uint32
+	if len(path) > 0 {
+		peerASN = fmt.Sprint(path[0])
+		originASN = path[len(path)-1]
+	}
+	const peer = "192.0.2.1"
+	return RisMessage{
+		Type: "ris_message",
+		Data: &RisMessageData{
+			Timestamp:    1558620047.08,
+			Peer:         peer,
+			PeerASN:      peerASN,
+			ID:           "192.0.2.1-1558620047.08-1",
+			Host:         "rrc00",
+			Type:         "UPDATE",
+			Path:         p,
+			DigestedPath: append([]uint32{}, path...),
+			OriginASN:    originASN,
+			Origin:       origin,
+			Announcements: []*RisAnnouncement{{
+				NextHop:  peer,
+				Prefixes: prefixes,
+			}},
+		},
+	}
+}
+
+// fakeClock is a Clock which only moves when Advance is called.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), c: c})
+	return c
+}
+
+// Advance moves the clock on by d, firing the waits which have ended.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	var left []fakeWaiter
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			left = append(left, w)
+			continue
+		}
+		w.c <- f.now
+	}
+	f.waiters = left
+}
+
+// BlockUntil waits, up to a few seconds, for n waits to be pending.
+func (f *fakeClock) BlockUntil(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		pending := len(f.waiters)
+		f.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v pending waits on the clock, wanted %v", pending, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// The helper must build what Listen delivers for the same message.
+func TestNewTestMessage(t *testing.T) {
+	want := NewTestMessage([]uint32{64500, 64501}, "igp", "192.0.2.0/24", "198.51.100.0/24")
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "1-msg")
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	r := &RisLive{File: proto.String(file), Filter: &RisFilter{}, Chan: make(chan RisMessage, 1)}
+	go r.Listen()
+	got := <-r.Chan
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
@@ -9,13 +9,22 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 )
 
+// ErrNoMatch is returned by the lookups when no prefix in the tree contains
+// the address or network searched for.
+var ErrNoMatch = errors.New("no match found")
+
 // Tree is the binary (trie) tree which stores preefixes.
+// A Tree holds the address family of its root, v4 or v6, a prefix or address of the
+// other family is not inserted and matches nothing; keep a Tree per family for both.
+// A Tree is safe for concurrent use, Insert and Delete may run alongside Lpm, PrefixLpm and Walk.
 type Tree struct {
-	Root     *Node // The top level, least specific, prefix in the tree.
-	elements int32 // total number of elements stored in the tree.
+	Root     *Node        // The top level, least specific, prefix in the tree.
+	elements int32        // total number of elements stored in the tree.
+	mu       sync.RWMutex // Held for writing by Insert and Delete, for reading by lookups and walks.
 }
 
 // Prefix is a single Node's prefix, the IP (192.168.0.0/32) and Network (192.168.0.0/16).
@@ -54,52 +63,268 @@ func New(root string) (*Tree, error) {
 }
 
 // PrefixLpm implements a Longest Prefix Match for a prefix in the LPM tree.
+// Only networks at least as short as n's mask are considered, a stored prefix
+// more specific than n does not cover n and is never returned. A mask longer
+// than n's address, an IPv4 address with a 16 byte mask, is an error.
 func (t *Tree) PrefixLpm(n *net.IPNet) (*net.IPNet, error) {
-	return t.Lpm(n.IP)
+	if n == nil {
+		return nil, fmt.Errorf("can not LPM a nil prefix: %v", n)
+	}
+	ip := normalizeIP(n.IP)
+	ones, _ := n.Mask.Size()
+	if ones > len(ip)*8 {
+		return nil, fmt.Errorf("can not LPM %v, a /%d mask is longer than the address", n, ones)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.Root.search(ip, ones)
 }
 
 // Lpm performs a longest prefix match in a Tree for a net.IP.
-// Matching is done recursively down the L/R sides of each fork in the tree
-// until neither L nor R forks match the request.
+// Matching descends the L or R side of each fork in the tree, by each bit of
+// the address, until there is no node further down.
 //
-// The match is returned or an error if there is no match.
+// The most specific match is returned, or ErrNoMatch if there is no match.
 func (t *Tree) Lpm(n net.IP) (*net.IPNet, error) {
 	if n == nil {
 		return nil, fmt.Errorf("can not LPM a nil prefix: %v", n)
 	}
 
-	// Searching the root, this is recursive down the root/nodes.
-	return t.Root.Search(n)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The search walks down from the root one bit of n at a time.
+	return t.Root.Search(normalizeIP(n))
 }
 
 // Insert adds a prefix to the tree, provided the prefix doesn't already exist in the tree.
+// Prefixes are stored one bit per level below the root, nodes created along the way
+// which do not hold a prefix of their own are left with a nil Prefix.
 func (t *Tree) Insert(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+	n = &net.IPNet{IP: normalizeIP(n.IP), Mask: n.Mask}
+	if !t.covers(n) {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ones, _ := n.Mask.Size()
+	depth, _ := t.Root.Prefix.Network.Mask.Size()
+
+	node := t.Root
+	for ; depth < ones; depth++ {
+		child := &node.l
+		if bitAt(n.IP, depth) == 1 {
+			child = &node.r
+		}
+		if *child == nil {
+			*child = &Node{parent: node}
+		}
+		node = *child
+	}
+	if node.Prefix != nil {
+		return false
+	}
+
+	ip := n.IP.Mask(n.Mask)
+	node.Name = n.String()
+	node.Prefix = &Prefix{IP: ip, Network: &net.IPNet{IP: ip, Mask: n.Mask}}
+	t.elements++
 	return true
 }
 
+// Delete removes a prefix from the tree, returning true if the prefix was stored.
+// Nodes left holding neither a prefix nor children are unlinked from the tree.
+// The root prefix can not be deleted.
+func (t *Tree) Delete(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+	n = &net.IPNet{IP: normalizeIP(n.IP), Mask: n.Mask}
+	if !t.covers(n) {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := t.find(n)
+	if node == nil || node == t.Root {
+		return false
+	}
+	node.Name = ""
+	node.Prefix = nil
+	t.elements--
+
+	// Collapse the now empty nodes back up towards the root.
+	for node != t.Root && node.Prefix == nil && node.l == nil && node.r == nil {
+		parent := node.parent
+		if parent.l == node {
+			parent.l = nil
+		} else {
+			parent.r = nil
+		}
+		node.parent = nil
+		node = parent
+	}
+	return true
+}
+
+// Get returns the node holding exactly the prefix n, the mask as well as the
+// network must match, and whether the prefix is stored.
+func (t *Tree) Get(n *net.IPNet) (*Node, bool) {
+	if n == nil {
+		return nil, false
+	}
+	n = &net.IPNet{IP: normalizeIP(n.IP), Mask: n.Mask}
+	if !t.covers(n) {
+		return nil, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.find(n)
+	return node, node != nil
+}
+
+// Contains reports whether exactly the prefix n is stored in the tree.
+func (t *Tree) Contains(n *net.IPNet) bool {
+	_, ok := t.Get(n)
+	return ok
+}
+
+// find walks to the node for n, returning it if it holds a prefix, or nil.
+// n must be normalized and covered by the root, the caller holds the lock.
+func (t *Tree) find(n *net.IPNet) *Node {
+	ones, _ := n.Mask.Size()
+	depth, _ := t.Root.Prefix.Network.Mask.Size()
+
+	node := t.Root
+	for ; depth < ones && node != nil; depth++ {
+		if bitAt(n.IP, depth) == 0 {
+			node = node.l
+		} else {
+			node = node.r
+		}
+	}
+	if node == nil || node.Prefix == nil {
+		return nil
+	}
+	return node
+}
+
+// Len returns the number of prefixes stored in the tree, including the root.
+func (t *Tree) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return int(t.elements)
+}
+
+// Walk visits every prefix stored in the tree, depth first, calling fn with each
+// network. The walk stops early if fn returns false.
+// The order is canonical, whatever the order of insertion: by network address,
+// then by mask length, a prefix before its more-specifics. A tree holds a
+// single family, walk the v4 tree before the v6 tree to order by family too.
+// fn must not modify the tree, the tree is read locked for the length of the walk.
+func (t *Tree) Walk(fn func(*net.IPNet) bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.Root.walk(fn)
+}
+
+// String lists the prefixes stored in the tree, space separated, in Walk order.
+func (t *Tree) String() string {
+	var prefixes []string
+	t.Walk(func(n *net.IPNet) bool {
+		prefixes = append(prefixes, n.String())
+		return true
+	})
+	return strings.Join(prefixes, " ")
+}
+
+// walk visits n and then its left and right branches, returning false once fn
+// has asked for the walk to stop.
+func (n *Node) walk(fn func(*net.IPNet) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.Prefix != nil && n.Prefix.Network != nil && !fn(n.Prefix.Network) {
+		return false
+	}
+	return n.l.walk(fn) && n.r.walk(fn)
+}
+
+// covers reports whether n is of the same family as, and within, the root prefix.
+func (t *Tree) covers(n *net.IPNet) bool {
+	root := t.Root.Prefix.Network
+	rootOnes, rootBits := root.Mask.Size()
+	ones, bits := n.Mask.Size()
+	if bits != rootBits || ones < rootOnes || len(n.IP)*8 != bits {
+		return false
+	}
+	return root.Contains(n.IP)
+}
+
+// normalizeIP returns IPv4 addresses in their 4 byte form, net.ParseIP and
+// net.ParseCIDR disagree on the length of a v4 address and the tree is walked
+// a bit at a time, so both inserts and lookups must agree on the form used.
+func normalizeIP(ip net.IP) net.IP {
+	if AddressFamily(ip) == 4 {
+		return ip.To4()
+	}
+	return ip
+}
+
+// AddressFamily returns the address family of ip, 4 or 6, or 0 if ip is not
+// an address. An IPv4 address in its 16 byte, IPv4 mapped, form is family 4.
+func AddressFamily(ip net.IP) int {
+	switch {
+	case ip.To4() != nil:
+		return 4
+	case len(ip) == net.IPv6len:
+		return 6
+	}
+	return 0
+}
+
+// bitAt returns the i'th bit, counting from the most significant, of ip.
+func bitAt(ip net.IP, i int) byte {
+	return (ip[i/8] >> (7 - uint(i%8))) & 1
+}
+
+// Search returns the most specific network stored at, or below, n which contains ip.
+// The search descends one bit of ip per level, so only a single path is followed.
 func (n *Node) Search(ip net.IP) (*net.IPNet, error) {
+	return n.search(ip, len(ip)*8)
+}
+
+// search is Search, descending no further than limit bits into ip.
+func (n *Node) search(ip net.IP, limit int) (*net.IPNet, error) {
 	if ip == nil {
 		return nil, errors.New("ip to search is nil")
 	}
-
-	var result *net.IPNet
-	// Search down the L tree leg, if ip is in l.Prefix, descend.
-	if n.l.Prefix.Network.Contains(ip) {
-		var err error
-		result, err = n.l.Search(ip)
-		if err != nil {
-			return nil, fmt.Errorf("failed searching a left branch: %s", err)
-		}
+	if n.Prefix == nil || n.Prefix.Network == nil {
+		return nil, errors.New("search must start at a node which holds a prefix")
+	}
+	if !n.Prefix.Network.Contains(ip) {
+		return nil, fmt.Errorf("ip: %v is not within %v: %w", ip, n.Prefix.Network, ErrNoMatch)
 	}
 
-	// No success on the left branch, search the right.
-	if result == nil {
-		var err error
-		result, err = n.r.Search(ip)
-		if err != nil {
-			return nil, fmt.Errorf("failed searching a right branch: %s", err)
+	result := n.Prefix.Network
+	depth, _ := n.Prefix.Network.Mask.Size()
+	for node := n; depth < limit; depth++ {
+		if bitAt(ip, depth) == 0 {
+			node = node.l
+		} else {
+			node = node.r
+		}
+		if node == nil {
+			break
+		}
+		if node.Prefix != nil && node.Prefix.Network != nil {
+			result = node.Prefix.Network
 		}
 	}
-	// Search down the R tree leg.
 	return result, nil
 }
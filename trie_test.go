@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -44,3 +49,750 @@ func TestSearch(t *testing.T) {
 		}
 	}
 }
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		desc   string
+		root   string
+		insert []string
+		stop   int
+		want   []string
+	}{{
+		desc: "Success root only",
+		root: "0.0.0.0/0",
+		want: []string{"0.0.0.0/0"},
+	}, {
+		desc:   "Success all inserted prefixes",
+		root:   "0.0.0.0/0",
+		insert: []string{"192.168.0.0/16", "10.0.0.0/8", "192.168.1.0/24", "10.1.0.0/16"},
+		want:   []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "192.168.0.0/16", "192.168.1.0/24"},
+	}, {
+		desc:   "Success duplicate insert visited once",
+		root:   "0.0.0.0/0",
+		insert: []string{"10.0.0.0/8", "10.0.0.0/8"},
+		want:   []string{"0.0.0.0/0", "10.0.0.0/8"},
+	}, {
+		desc:   "Success v6 prefixes",
+		root:   "::/0",
+		insert: []string{"2001:db8::/32", "2001:db8:1::/48"},
+		want:   []string{"::/0", "2001:db8::/32", "2001:db8:1::/48"},
+	}, {
+		desc:   "Success stop walking early",
+		root:   "0.0.0.0/0",
+		insert: []string{"192.168.0.0/16", "10.0.0.0/8", "192.168.1.0/24"},
+		stop:   2,
+		want:   []string{"0.0.0.0/0", "10.0.0.0/8"},
+	}}
+
+	for _, test := range tests {
+		trie, err := New(test.root)
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+		}
+		for _, p := range test.insert {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, p, err)
+			}
+			trie.Insert(n)
+		}
+
+		var got []string
+		trie.Walk(func(n *net.IPNet) bool {
+			got = append(got, n.String())
+			return test.stop == 0 || len(got) < test.stop
+		})
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: Diff in got/want(+/-):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestWalkCanonicalOrder(t *testing.T) {
+	tests := []struct {
+		desc string
+		root string
+		want []string // In canonical order.
+	}{{
+		desc: "v4",
+		root: "0.0.0.0/0",
+		want: []string{
+			"0.0.0.0/0", "0.0.0.0/8", "10.0.0.0/8", "10.0.0.0/16", "10.0.0.0/24",
+			"10.0.1.0/24", "10.1.0.0/16", "10.128.0.0/9", "192.0.2.0/24", "192.0.2.0/25",
+			"192.0.2.128/25", "255.255.255.255/32",
+		},
+	}, {
+		desc: "v6",
+		root: "::/0",
+		want: []string{
+			"::/0", "::/8", "2001:db8::/32", "2001:db8::/48", "2001:db8:0:1::/64",
+			"2001:db8:1::/48", "2001:db8:8000::/33", "fe80::/10",
+		},
+	}}
+
+	for _, test := range tests {
+		// Several shuffles, each seeded so a failure can be reproduced.
+		for seed := int64(0); seed < 20; seed++ {
+			insert := append([]string{}, test.want[1:]...)
+			rand.New(rand.NewSource(seed)).Shuffle(len(insert), func(i, j int) {
+				insert[i], insert[j] = insert[j], insert[i]
+			})
+			trie, err := New(test.root)
+			if err != nil {
+				t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+			}
+			for _, p := range insert {
+				_, n, err := net.ParseCIDR(p)
+				if err != nil {
+					t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, p, err)
+				}
+				trie.Insert(n)
+			}
+
+			var got []string
+			trie.Walk(func(n *net.IPNet) bool {
+				got = append(got, n.String())
+				return true
+			})
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: seed %d, inserted %v: Diff in got/want(+/-):\n%v\n", test.desc, seed, insert, diff)
+			}
+			if got, want := trie.String(), strings.Join(test.want, " "); got != want {
+				t.Errorf("[%v]: seed %d: String() got/want mismatch, got: %v want: %v", test.desc, seed, got, want)
+			}
+		}
+	}
+}
+
+// Run with -race, inserts happen in one goroutine while several others look up.
+func TestConcurrentInsertLpm(t *testing.T) {
+	trie, err := New("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 256; i++ {
+			_, n, err := net.ParseCIDR(fmt.Sprintf("10.%d.0.0/16", i))
+			if err != nil {
+				t.Errorf("failed to parse prefix: %v", err)
+				return
+			}
+			trie.Insert(n)
+		}
+	}()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 256; i++ {
+				ip := net.IPv4(10, byte(i), 1, 1).To4()
+				if _, err := trie.Lpm(ip); err != nil {
+					t.Errorf("failed to lookup %v: %v", ip, err)
+				}
+				trie.Walk(func(*net.IPNet) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := trie.Lpm(net.IPv4(10, 255, 1, 1).To4())
+	if err != nil {
+		t.Fatalf("failed to lookup after inserts: %v", err)
+	}
+	if want := "10.255.0.0/16"; got.String() != want {
+		t.Errorf("got/want mismatch, got: %v want: %v", got, want)
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		desc   string
+		insert []string
+		want   int
+	}{{
+		desc: "Success root only",
+		want: 1,
+	}, {
+		desc:   "Success two inserts",
+		insert: []string{"10.0.0.0/8", "192.168.0.0/16"},
+		want:   3,
+	}, {
+		desc:   "Success duplicate insert not counted",
+		insert: []string{"10.0.0.0/8", "192.168.0.0/16", "10.0.0.0/8"},
+		want:   3,
+	}, {
+		desc:   "Success wrong family insert not counted",
+		insert: []string{"10.0.0.0/8", "2001:db8::/32"},
+		want:   2,
+	}}
+
+	for _, test := range tests {
+		trie, err := New("0.0.0.0/0")
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+		}
+		for _, p := range test.insert {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, p, err)
+			}
+			trie.Insert(n)
+		}
+		if got := trie.Len(); got != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestPrefixLpm(t *testing.T) {
+	trie, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.1.0/24", "172.16.16.0/20"} {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatalf("failed to parse prefix(%v): %v", p, err)
+		}
+		trie.Insert(n)
+	}
+
+	tests := []struct {
+		desc   string
+		prefix string
+		want   string
+	}{{
+		desc:   "Success exact /8",
+		prefix: "10.0.0.0/8",
+		want:   "10.0.0.0/8",
+	}, {
+		desc:   "Success exact /16",
+		prefix: "10.1.0.0/16",
+		want:   "10.1.0.0/16",
+	}, {
+		desc:   "Success exact /24",
+		prefix: "10.1.1.0/24",
+		want:   "10.1.1.0/24",
+	}, {
+		desc:   "Success exact non-octet /20",
+		prefix: "172.16.16.0/20",
+		want:   "172.16.16.0/20",
+	}, {
+		desc:   "Success /24 inside the /20",
+		prefix: "172.16.31.0/24",
+		want:   "172.16.16.0/20",
+	}, {
+		desc:   "Success /12 covering the /20 is not matched by it",
+		prefix: "172.16.0.0/12",
+		want:   "0.0.0.0/0",
+	}, {
+		desc:   "Success /15 covering the /16 falls back to the /8",
+		prefix: "10.0.0.0/15",
+		want:   "10.0.0.0/8",
+	}}
+
+	for _, test := range tests {
+		_, n, err := net.ParseCIDR(test.prefix)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, test.prefix, err)
+		}
+		got, err := trie.PrefixLpm(n)
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+// An IPv4 mapped address with a 16 byte mask is shortened to 4 bytes, the
+// mask must not then walk the tree past the end of the address.
+func TestPrefixLpmMaskLongerThanAddress(t *testing.T) {
+	trie, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	_, host, err := net.ParseCIDR("10.1.1.1/32")
+	if err != nil {
+		t.Fatalf("failed to parse prefix: %v", err)
+	}
+	trie.Insert(host)
+
+	mapped := &net.IPNet{IP: net.ParseIP("10.1.1.1"), Mask: net.CIDRMask(120, 128)}
+	if got, err := trie.PrefixLpm(mapped); err == nil {
+		t.Errorf("got %v, wanted an error for a /120 mask on an IPv4 address", got)
+	}
+}
+
+func TestLpmNonOctetMask(t *testing.T) {
+	trie, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	for _, p := range []string{"216.239.32.0/19", "216.239.0.0/17"} {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatalf("failed to parse prefix(%v): %v", p, err)
+		}
+		if !trie.Insert(n) {
+			t.Fatalf("failed to insert prefix(%v)", p)
+		}
+	}
+
+	tests := []struct {
+		desc string
+		ip   net.IP
+		want string
+	}{{
+		desc: "Success inside the /19",
+		ip:   net.IPv4(216, 239, 45, 1).To4(),
+		want: "216.239.32.0/19",
+	}, {
+		desc: "Success last address of the /19",
+		ip:   net.IPv4(216, 239, 63, 255).To4(),
+		want: "216.239.32.0/19",
+	}, {
+		desc: "Success outside the /19, inside the /17",
+		ip:   net.IPv4(216, 239, 64, 1).To4(),
+		want: "216.239.0.0/17",
+	}, {
+		desc: "Success below the /19, inside the /17",
+		ip:   net.IPv4(216, 239, 31, 255).To4(),
+		want: "216.239.0.0/17",
+	}, {
+		desc: "Success outside both",
+		ip:   net.IPv4(216, 239, 128, 1).To4(),
+		want: "0.0.0.0/0",
+	}}
+
+	for _, test := range tests {
+		got, err := trie.Lpm(test.ip)
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestLpmNormalizeIPv4(t *testing.T) {
+	trie, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	// A v4 network with a 16 byte address, as built by hand rather than net.ParseCIDR.
+	inserted := &net.IPNet{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(16, 32)}
+	if !trie.Insert(inserted) {
+		t.Fatalf("failed to insert %v", inserted)
+	}
+
+	tests := []struct {
+		desc string
+		ip   net.IP
+		want string
+	}{{
+		desc: "Success 16 byte v4 address",
+		ip:   net.ParseIP("192.168.1.1"),
+		want: "192.168.0.0/16",
+	}, {
+		desc: "Success 4 byte v4 address",
+		ip:   net.ParseIP("192.168.1.1").To4(),
+		want: "192.168.0.0/16",
+	}, {
+		desc: "Success 16 byte v4 address outside the prefix",
+		ip:   net.ParseIP("192.169.1.1"),
+		want: "0.0.0.0/0",
+	}}
+
+	for _, test := range tests {
+		got, err := trie.Lpm(test.ip)
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		desc    string
+		insert  []string
+		del     string
+		want    bool
+		lookup  net.IP
+		wantLpm string
+		wantLen int
+	}{{
+		desc:    "Success delete the more specific",
+		insert:  []string{"10.0.0.0/8", "10.1.0.0/16"},
+		del:     "10.1.0.0/16",
+		want:    true,
+		lookup:  net.IPv4(10, 1, 1, 1).To4(),
+		wantLpm: "10.0.0.0/8",
+		wantLen: 2,
+	}, {
+		desc:    "Success delete the less specific",
+		insert:  []string{"10.0.0.0/8", "10.1.0.0/16"},
+		del:     "10.0.0.0/8",
+		want:    true,
+		lookup:  net.IPv4(10, 2, 1, 1).To4(),
+		wantLpm: "0.0.0.0/0",
+		wantLen: 2,
+	}, {
+		desc:    "Success the more specific survives deleting the less specific",
+		insert:  []string{"10.0.0.0/8", "10.1.0.0/16"},
+		del:     "10.0.0.0/8",
+		want:    true,
+		lookup:  net.IPv4(10, 1, 1, 1).To4(),
+		wantLpm: "10.1.0.0/16",
+		wantLen: 2,
+	}, {
+		desc:    "Failure prefix not stored",
+		insert:  []string{"10.0.0.0/8", "10.1.0.0/16"},
+		del:     "10.2.0.0/16",
+		want:    false,
+		lookup:  net.IPv4(10, 2, 1, 1).To4(),
+		wantLpm: "10.0.0.0/8",
+		wantLen: 3,
+	}, {
+		desc:    "Failure root can not be deleted",
+		insert:  []string{"10.0.0.0/8"},
+		del:     "0.0.0.0/0",
+		want:    false,
+		lookup:  net.IPv4(11, 1, 1, 1).To4(),
+		wantLpm: "0.0.0.0/0",
+		wantLen: 2,
+	}}
+
+	for _, test := range tests {
+		trie, err := New("0.0.0.0/0")
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+		}
+		for _, p := range test.insert {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, p, err)
+			}
+			trie.Insert(n)
+		}
+		_, n, err := net.ParseCIDR(test.del)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, test.del, err)
+		}
+
+		if got := trie.Delete(n); got != test.want {
+			t.Errorf("[%v]: got/want mismatch deleting, got: %v want: %v", test.desc, got, test.want)
+		}
+		got, err := trie.Lpm(test.lookup)
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got.String() != test.wantLpm {
+			t.Errorf("[%v]: got/want mismatch on lookup, got: %v want: %v", test.desc, got, test.wantLpm)
+		}
+		if got := trie.Len(); got != test.wantLen {
+			t.Errorf("[%v]: got/want mismatch on length, got: %v want: %v", test.desc, got, test.wantLen)
+		}
+	}
+}
+
+func TestDeleteCollapsesNodes(t *testing.T) {
+	trie, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	_, n, err := net.ParseCIDR("10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to parse prefix: %v", err)
+	}
+	trie.Insert(n)
+	if !trie.Delete(n) {
+		t.Fatalf("failed to delete %v", n)
+	}
+	if trie.Root.l != nil || trie.Root.r != nil {
+		t.Errorf("empty nodes left below the root after delete: l: %v r: %v", trie.Root.l, trie.Root.r)
+	}
+}
+
+func TestTreeGet(t *testing.T) {
+	tests := []struct {
+		desc   string
+		insert []string
+		get    string
+		want   bool
+	}{{
+		desc:   "Success exact prefix stored",
+		insert: []string{"10.0.0.0/8"},
+		get:    "10.0.0.0/8",
+		want:   true,
+	}, {
+		desc:   "Success more specific not stored",
+		insert: []string{"10.0.0.0/8"},
+		get:    "10.0.0.0/16",
+		want:   false,
+	}, {
+		desc:   "Success less specific not stored",
+		insert: []string{"10.1.0.0/16"},
+		get:    "10.0.0.0/8",
+		want:   false,
+	}, {
+		desc:   "Success the root is stored",
+		insert: []string{"10.0.0.0/8"},
+		get:    "0.0.0.0/0",
+		want:   true,
+	}, {
+		desc:   "Success other family not stored",
+		insert: []string{"10.0.0.0/8"},
+		get:    "2001:db8::/32",
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		trie, err := New("0.0.0.0/0")
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+		}
+		for _, p := range test.insert {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, p, err)
+			}
+			trie.Insert(n)
+		}
+		_, n, err := net.ParseCIDR(test.get)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, test.get, err)
+		}
+
+		if got := trie.Contains(n); got != test.want {
+			t.Errorf("[%v]: got/want mismatch on contains, got: %v want: %v", test.desc, got, test.want)
+		}
+		node, ok := trie.Get(n)
+		if ok != test.want {
+			t.Errorf("[%v]: got/want mismatch on get, got: %v want: %v", test.desc, ok, test.want)
+			continue
+		}
+		if ok && node.Prefix.Network.String() != test.get {
+			t.Errorf("[%v]: got/want mismatch on node, got: %v want: %v", test.desc, node.Prefix.Network, test.get)
+		}
+	}
+}
+
+func TestLpmNested(t *testing.T) {
+	tests := []struct {
+		desc      string
+		ip        net.IP
+		prefix    string
+		want      string
+		wantNoHit bool
+	}{{
+		desc: "Success most specific of three",
+		ip:   net.IPv4(10, 1, 1, 1).To4(),
+		want: "10.1.1.0/24",
+	}, {
+		desc: "Success middle of three",
+		ip:   net.IPv4(10, 1, 2, 1).To4(),
+		want: "10.1.0.0/16",
+	}, {
+		desc: "Success least specific of three",
+		ip:   net.IPv4(10, 2, 1, 1).To4(),
+		want: "10.0.0.0/8",
+	}, {
+		desc:   "Success prefix within the /24",
+		prefix: "10.1.1.128/25",
+		want:   "10.1.1.0/24",
+	}, {
+		desc:   "Success prefix covering the /24",
+		prefix: "10.1.0.0/23",
+		want:   "10.1.0.0/16",
+	}, {
+		desc:      "Failure outside the tree",
+		ip:        net.IPv4(11, 1, 1, 1).To4(),
+		wantNoHit: true,
+	}, {
+		desc:      "Failure prefix outside the tree",
+		prefix:    "11.0.0.0/16",
+		wantNoHit: true,
+	}}
+
+	trie, err := New("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	for _, p := range []string{"10.1.0.0/16", "10.1.1.0/24"} {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatalf("failed to parse prefix(%v): %v", p, err)
+		}
+		trie.Insert(n)
+	}
+
+	for _, test := range tests {
+		var got *net.IPNet
+		var err error
+		if test.prefix != "" {
+			_, n, perr := net.ParseCIDR(test.prefix)
+			if perr != nil {
+				t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, test.prefix, perr)
+			}
+			got, err = trie.PrefixLpm(n)
+		} else {
+			got, err = trie.Lpm(test.ip)
+		}
+		switch {
+		case test.wantNoHit:
+			if !errors.Is(err, ErrNoMatch) {
+				t.Errorf("[%v]: got error %v wanted ErrNoMatch", test.desc, err)
+			}
+		case err != nil:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case got.String() != test.want:
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestTreeIPv6(t *testing.T) {
+	tests := []struct {
+		desc       string
+		insert     string
+		wantInsert bool
+		lookup     net.IP
+		want       string
+		wantErr    bool
+	}{{
+		desc:       "Success v6 prefix resolves an address within it",
+		insert:     "2001:db8::/32",
+		wantInsert: true,
+		lookup:     net.ParseIP("2001:db8:1::1"),
+		want:       "2001:db8::/32",
+	}, {
+		desc:       "Success v6 prefix past the first 64 bits",
+		insert:     "2001:db8:0:0:1::/80",
+		wantInsert: true,
+		lookup:     net.ParseIP("2001:db8::1:0:0:1"),
+		want:       "2001:db8:0:0:1::/80",
+	}, {
+		desc:       "Success v6 host route",
+		insert:     "2001:db8::1/128",
+		wantInsert: true,
+		lookup:     net.ParseIP("2001:db8::1"),
+		want:       "2001:db8::1/128",
+	}, {
+		desc:       "Success address outside the prefix falls back to the root",
+		insert:     "2001:db8::/32",
+		wantInsert: true,
+		lookup:     net.ParseIP("2001:db9::1"),
+		want:       "::/0",
+	}, {
+		desc:       "Failure v4 prefix rejected by a v6 tree",
+		insert:     "10.0.0.0/8",
+		wantInsert: false,
+		lookup:     net.IPv4(10, 1, 1, 1),
+		wantErr:    true,
+	}}
+
+	for _, test := range tests {
+		trie, err := New("::/0")
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tree: %v", test.desc, err)
+		}
+		_, n, err := net.ParseCIDR(test.insert)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse prefix(%v): %v", test.desc, test.insert, err)
+		}
+		if got := trie.Insert(n); got != test.wantInsert {
+			t.Errorf("[%v]: got/want mismatch inserting, got: %v want: %v", test.desc, got, test.wantInsert)
+		}
+
+		got, err := trie.Lpm(test.lookup)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one, got: %v", test.desc, got)
+		case err == nil && got.String() != test.want:
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestTreeMixedFamilies(t *testing.T) {
+	v4, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create v4 tree: %v", err)
+	}
+	v6, err := New("::/0")
+	if err != nil {
+		t.Fatalf("failed to create v6 tree: %v", err)
+	}
+	for _, p := range []string{"10.0.0.0/8", "2001:db8::/32"} {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatalf("failed to parse prefix(%v): %v", p, err)
+		}
+		// Each prefix is only taken by the tree of its own family.
+		if v4.Insert(n) == v6.Insert(n) {
+			t.Errorf("prefix %v inserted into both or neither tree", p)
+		}
+	}
+	if got := v4.Len() + v6.Len(); got != 4 {
+		t.Errorf("got/want mismatch on length, got: %v want: 4", got)
+	}
+	if _, err := v4.Lpm(net.ParseIP("2001:db8::1")); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("got error %v looking up v6 in the v4 tree, wanted ErrNoMatch", err)
+	}
+	if _, err := v6.Lpm(net.ParseIP("10.1.1.1")); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("got error %v looking up v4 in the v6 tree, wanted ErrNoMatch", err)
+	}
+}
+
+func TestAddressFamily(t *testing.T) {
+	tests := []struct {
+		desc string
+		ip   net.IP
+		want int
+	}{{
+		desc: "IPv4 address",
+		ip:   net.ParseIP("192.0.2.1"),
+		want: 4,
+	}, {
+		desc: "IPv4 address, 4 byte form",
+		ip:   net.ParseIP("192.0.2.1").To4(),
+		want: 4,
+	}, {
+		desc: "IPv4 mapped IPv6 address",
+		ip:   net.ParseIP("::ffff:192.0.2.1"),
+		want: 4,
+	}, {
+		desc: "IPv6 address",
+		ip:   net.ParseIP("2001:db8::1"),
+		want: 6,
+	}, {
+		desc: "Nil address",
+		want: 0,
+	}, {
+		desc: "Short address",
+		ip:   net.IP{192, 0, 2},
+		want: 0,
+	}}
+
+	for _, test := range tests {
+		if got := AddressFamily(test.ip); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
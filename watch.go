@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+)
+
+// WatchPrefix returns a filter on a single aggregate, matching announcements
+// of the aggregate itself and of any more-specific of it: the prefix check of
+// watching your own address space. Use it as the RisLive Filter, setting
+// the other filter fields on the result to narrow it further, or use Watch
+// for the feed of the prefix alone, withdrawals included.
+func WatchPrefix(cidr string) *RisFilter {
+	return &RisFilter{Prefix: []string{cidr}}
+}
+
+// Watch returns a channel sent every message which announces or withdraws
+// cidr, or any more-specific of it. Only the prefix is checked, the RisLive
+// Filter does not apply. Watch subscribes to the stream, so call it before
+// Listen; the channel is closed when Listen returns, and a watcher too slow
+// to keep up holds back Listen as any subscriber does.
+func (r *RisLive) Watch(cidr string) (<-chan RisMessage, error) {
+	f := WatchPrefix(cidr)
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	pf := f.compile(r.log())
+	sub := r.Subscribe()
+	c := make(chan RisMessage, cap(sub))
+	go func() {
+		defer close(c)
+		for rm := range sub {
+			if rm.Data != nil && pf.touches(rm.Data) {
+				c <- rm
+			}
+		}
+	}()
+	return c, nil
+}
+
+// touches reports whether the message announces or withdraws a prefix equal
+// to, or more specific than, a filter prefix. A less specific prefix holding
+// a filter prefix does not touch it.
+func (pf *preparedFilter) touches(rm *RisMessageData) bool {
+	for _, anns := range rm.Announcements {
+		for _, prefix := range anns.Prefixes {
+			if pf.within(prefix) {
+				return true
+			}
+		}
+	}
+	for _, prefix := range rm.Withdrawals {
+		if pf.within(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether the whole of prefix falls within a filter prefix.
+func (pf *preparedFilter) within(prefix string) bool {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+	_, ok := pf.covering(n)
+	return ok
+}
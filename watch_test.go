@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cidr    string
+		want    []string
+		wantErr bool
+	}{{
+		desc: "Success aggregate and its more-specifics",
+		cidr: "203.0.113.0/24",
+		want: []string{"msg-1", "msg-2", "msg-3", "msg-6"},
+	}, {
+		desc: "Success more-specific of the aggregate only",
+		cidr: "203.0.113.128/25",
+		want: []string{"msg-2"},
+	}, {
+		desc: "Success withdrawn and announced",
+		cidr: "198.51.100.0/24",
+		want: []string{"msg-4", "msg-6", "msg-7"},
+	}, {
+		desc: "Success v6 aggregate",
+		cidr: "2001:db8::/16",
+		want: []string{"msg-8"},
+	}, {
+		desc:    "Failure not a prefix",
+		cidr:    "203.0.113.0",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{File: proto.String("testdata/more-specifics")}
+		c, err := r.Watch(test.cidr)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+			continue
+		case err != nil:
+			continue
+		}
+		done := make(chan []string)
+		go func() {
+			var got []string
+			for rm := range c {
+				got = append(got, rm.Data.ID)
+			}
+			done <- got
+		}()
+		r.Listen()
+		if got := <-done; !cmp.Equal(got, test.want) {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		}
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	r := &RisLive{Filter: WatchPrefix("203.0.113.0/24")}
+	tests := []struct {
+		desc   string
+		prefix string
+		want   bool
+	}{{
+		desc:   "Success the aggregate",
+		prefix: "203.0.113.0/24",
+		want:   true,
+	}, {
+		desc:   "Success a more-specific",
+		prefix: "203.0.113.128/25",
+		want:   true,
+	}, {
+		desc:   "Failure outside the aggregate",
+		prefix: "198.51.100.0/24",
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		rm := NewTestMessage([]uint32{64496, 64500}, "igp", test.prefix)
+		if got := r.CheckPrefix(rm.Data); got != test.want {
+			t.Errorf("[%v]: got/want mismatch: got %v wanted %v", test.desc, got, test.want)
+		}
+	}
+}
+
+// WatchPrefix works as the RisLive Filter too, matching announcements of the
+// aggregate and its more-specifics.
+func TestWatchPrefixMatches(t *testing.T) {
+	r := &RisLive{
+		File:   proto.String("testdata/more-specifics"),
+		Chan:   make(chan RisMessage, 8),
+		Filter: WatchPrefix("203.0.113.0/24"),
+	}
+	go r.Listen()
+	var got []string
+	for rm := range r.Matches() {
+		got = append(got, rm.Data.ID)
+	}
+	if want := []string{"msg-1", "msg-2", "msg-6"}; !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+}
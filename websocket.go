@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// risLiveWebSocket is the RIS Live websocket endpoint, used when the RisLive
+// URL is not itself a ws:// or wss:// URL.
+const risLiveWebSocket = "wss://ris-live.ripe.net/v1/ws/"
+
+// RisSubscribe is the data of a ris_subscribe message, the filter RIS Live
+// applies on the server before sending messages over the websocket.
+type RisSubscribe struct {
+	Host         string   `json:"host,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Prefix       []string `json:"prefix,omitempty"`
+	MoreSpecific bool     `json:"moreSpecific,omitempty"`
+	Require      string   `json:"require,omitempty"`
+	Path         string   `json:"path,omitempty"`
+
+	SocketOptions *RisSocketOptions `json:"socketOptions,omitempty"`
+}
+
+// RisSocketOptions are the options of the websocket a subscription is sent on.
+type RisSocketOptions struct {
+	IncludeRaw bool `json:"includeRaw"` // Send each message's raw BGP message.
+}
+
+// risClientMessage is a message sent from the client to RIS Live.
+type risClientMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// WithWebSocket makes Listen read from the RIS Live websocket endpoint,
+// subscribing to UPDATE messages for the filter prefixes and their
+// more-specifics, rather than from the HTTP firehose. The filter is still
+// applied to every message received.
+func WithWebSocket() Option {
+	return func(r *RisLive) {
+		r.webSocket = true
+	}
+}
+
+// subscription builds the ris_subscribe data for the current filter.
+func (r *RisLive) subscription() *RisSubscribe {
+	s := &RisSubscribe{
+		Type:          "UPDATE",
+		SocketOptions: &RisSocketOptions{IncludeRaw: r.IncludeRaw},
+	}
+	pf := r.prepare()
+	if f := pf.filter; f != nil && f.Mode == MatchAny {
+		// A message may match on any one part, RIS Live can not narrow by one.
+		return s
+	}
+	if f := pf.filter; f != nil && len(f.Prefix) > 0 {
+		s.Prefix = f.Prefix
+		s.MoreSpecific = true
+	}
+	// RIS Live takes a single require key, more are left to the client side check.
+	if len(pf.require) == 1 {
+		s.Require = pf.require[0]
+	}
+	if pf.pathRE != nil {
+		if path, ok := subscriptionPath(pf.filter.ASPathRegex); ok {
+			s.Path = path
+		}
+	}
+	return s
+}
+
+// subscriptionPath translates an ASPathRegex into the RIS Live path
+// parameter, ASNs separated by commas, anchored by ^ and $ as the regex is.
+// Only a regex of ASNs and anchors translates, "^3356 174" to "^3356,174",
+// any other is left to the client side check. Both match whole ASNs, see
+// compileASPathRegex, so a message RIS Live sends also passes the check.
+func subscriptionPath(re string) (string, bool) {
+	start, end := "", ""
+	if strings.HasPrefix(re, "^") {
+		start, re = "^", re[1:]
+	}
+	if strings.HasSuffix(re, "$") {
+		end, re = "$", re[:len(re)-1]
+	}
+	asns := strings.Split(re, " ")
+	for _, asn := range asns {
+		if asn == "" || strings.Trim(asn, "0123456789") != "" {
+			return "", false
+		}
+	}
+	return start + strings.Join(asns, ",") + end, true
+}
+
+// webSocketURL returns the URL to dial, the RisLive URL if it is a websocket
+// URL, otherwise the RIS Live websocket endpoint. The client name is sent as
+// the client query parameter, as RIS Live asks.
+func (r *RisLive) webSocketURL() (string, error) {
+	raw := risLiveWebSocket
+	if r.URL != nil {
+		if u, err := url.Parse(*r.URL); err == nil && (u.Scheme == "ws" || u.Scheme == "wss") {
+			raw = *r.URL
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse websocket url(%v): %v", raw, err)
+	}
+	if r.UA != nil && *r.UA != "" {
+		q := u.Query()
+		q.Set("client", *r.UA)
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// dial opens a websocket to RIS Live.
+func (r *RisLive) dial() (*websocket.Conn, error) {
+	u, err := r.webSocketURL()
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	h.Set("User-Agent", r.userAgent())
+	conn, _, err := r.dialer().Dial(u, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial websocket(%v): %v", u, err)
+	}
+	return conn, nil
+}
+
+// dialWebSocket connects to RIS Live, sends the subscription, and returns the
+// stream of messages as a reader for the JSON decoder.
+func (r *RisLive) dialWebSocket() (io.ReadCloser, error) {
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+	sub := risClientMessage{Type: "ris_subscribe", Data: r.subscription()}
+	if err := conn.WriteJSON(sub); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send subscription: %v", err)
+	}
+	return &wsReader{conn: conn}, nil
+}
+
+// collectorsTimeout bounds how long Collectors waits for the collector list.
+const collectorsTimeout = 30 * time.Second
+
+// Collectors asks RIS Live for the route collectors, the valid Host values
+// for host filtering. The list is only available over the websocket, so a
+// websocket is opened for the request alone, whether or not Listen reads from
+// the websocket or the HTTP firehose.
+func (r *RisLive) Collectors() ([]string, error) {
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(collectorsTimeout))
+	if err := conn.WriteJSON(risClientMessage{Type: "request_rrc_list"}); err != nil {
+		return nil, fmt.Errorf("failed to request the collector list: %v", err)
+	}
+	for {
+		var f rawFrame
+		if err := conn.ReadJSON(&f); err != nil {
+			return nil, fmt.Errorf("failed to read the collector list: %v", err)
+		}
+		switch f.Type {
+		case "ris_rrc_list":
+			cf, err := decodeControl(f)
+			if err != nil {
+				return nil, err
+			}
+			return cf.(RisRRCList), nil
+		case "ris_error":
+			cf, err := decodeControl(f)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("RIS Live refused the collector list: %v", cf.(*RisErrorData).Message)
+		}
+		// Anything else sent meanwhile is not the reply.
+	}
+}
+
+// wsReader reads the websocket's messages back to back, so the frames can be
+// decoded just as the HTTP firehose is. The connection closing normally, or
+// going away, ends the stream.
+type wsReader struct {
+	conn *websocket.Conn
+	cur  io.Reader
+}
+
+func (w *wsReader) Read(p []byte) (int, error) {
+	for {
+		if w.cur == nil {
+			_, rd, err := w.conn.NextReader()
+			// Only a clean close ends the stream, an abnormal closure or a
+			// server error is a failed read.
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			w.cur = rd
+		}
+		n, err := w.cur.Read(p)
+		if err == io.EOF {
+			if n > 0 {
+				// The frame's end is seen again on the next Read.
+				return n, nil
+			}
+			// Each frame is ended with a newline, as the firehose ends each
+			// message, so the decoder can resynchronise after a bad frame.
+			w.cur = nil
+			if len(p) == 0 {
+				return 0, nil
+			}
+			p[0] = '\n'
+			return 1, nil
+		}
+		return n, err
+	}
+}
+
+func (w *wsReader) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/websocket"
+)
+
+// wsTestServer accepts one websocket, sends the first client message it
+// receives, the subscription or a request, on subs, then sends each line of
+// the file f as a message and closes. Only a ris_subscribe or a
+// request_rrc_list is answered, as RIS Live answers, anything else is closed
+// on.
+func wsTestServer(t *testing.T, f string, subs chan<- risClientMessage) *httptest.Server {
+	fd, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatalf("failed to read fixture(%v): %v", f, err)
+	}
+	var up websocket.Upgrader
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		sub := risClientMessage{Data: &RisSubscribe{}}
+		if err := conn.ReadJSON(&sub); err != nil {
+			t.Errorf("failed to read subscription: %v", err)
+			return
+		}
+		subs <- sub
+		switch sub.Type {
+		case "ris_subscribe", "request_rrc_list":
+		default:
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(fd)), "\n") {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+				t.Errorf("failed to write message: %v", err)
+				return
+			}
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+}
+
+func TestListenWebSocket(t *testing.T) {
+	subs := make(chan risClientMessage, 1)
+	ts := wsTestServer(t, "testdata/10-msg", subs)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	rf := &RisFilter{Prefix: []string{"2001:7fb:fe00::/40"}}
+	buffer := 10
+	r := NewRisLive(&url, proto.String(""), proto.String("rislive-test"), rf, &buffer, WithWebSocket())
+	go r.Listen()
+
+	var got []string
+	for rm := range r.Chan {
+		got = append(got, rm.Data.ID)
+	}
+	if len(got) != 10 {
+		t.Errorf("got %d messages, want 10", len(got))
+	}
+	if want := "196.60.9.165-1558620047.08-11924763"; len(got) == 0 || got[0] != want {
+		t.Errorf("got first message %v, want %v", got, want)
+	}
+
+	wantSub := risClientMessage{
+		Type: "ris_subscribe",
+		Data: &RisSubscribe{
+			Type:          "UPDATE",
+			Prefix:        []string{"2001:7fb:fe00::/40"},
+			MoreSpecific:  true,
+			SocketOptions: &RisSocketOptions{},
+		},
+	}
+	if diff := cmp.Diff(<-subs, wantSub); diff != "" {
+		t.Errorf("subscription mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+// Only a normal close, or the server going away, is the clean end of the
+// stream, any other close is a failed read.
+func TestListenWebSocketClose(t *testing.T) {
+	const msg = `{"type":"ris_message","data":{"timestamp":1558620047.0,"id":"msg-1"}}`
+	tests := []struct {
+		desc    string
+		code    int // 0 drops the connection without a close frame.
+		wantEnd EndStatus
+	}{{
+		desc:    "Normal closure",
+		code:    websocket.CloseNormalClosure,
+		wantEnd: EndClean,
+	}, {
+		desc:    "Going away",
+		code:    websocket.CloseGoingAway,
+		wantEnd: EndClean,
+	}, {
+		desc:    "Server error",
+		code:    websocket.CloseInternalServerErr,
+		wantEnd: EndFailed,
+	}, {
+		desc:    "Abnormal closure, the connection dropped",
+		wantEnd: EndFailed,
+	}}
+
+	for _, test := range tests {
+		var up websocket.Upgrader
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := up.Upgrade(w, r, nil)
+			if err != nil {
+				t.Errorf("[%v]: failed to upgrade: %v", test.desc, err)
+				return
+			}
+			defer conn.Close()
+			var sub risClientMessage
+			if err := conn.ReadJSON(&sub); err != nil {
+				t.Errorf("[%v]: failed to read subscription: %v", test.desc, err)
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(msg))
+			if test.code != 0 {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(test.code, ""))
+			}
+		}))
+		url := "ws" + strings.TrimPrefix(ts.URL, "http")
+		buffer := 10
+		r := NewRisLive(&url, proto.String(""), proto.String("rislive-test"), &RisFilter{}, &buffer, WithWebSocket())
+		r.Listen()
+		ts.Close()
+		if r.Records != 1 {
+			t.Errorf("[%v]: got/want mismatch: got %v records wanted 1", test.desc, r.Records)
+		}
+		if end := r.End(); end != test.wantEnd {
+			t.Errorf("[%v]: got/want mismatch: got end %v wanted %v", test.desc, end, test.wantEnd)
+		}
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	tests := []struct {
+		desc string
+		url  string
+		ua   string
+		want string
+	}{{
+		desc: "Success http url uses the RIS Live endpoint",
+		url:  "https://ris-live.ripe.net/v1/stream/?format=json",
+		ua:   "rislive-test",
+		want: "wss://ris-live.ripe.net/v1/ws/?client=rislive-test",
+	}, {
+		desc: "Success websocket url used as is",
+		url:  "ws://127.0.0.1:8080/ws/",
+		want: "ws://127.0.0.1:8080/ws/",
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{URL: proto.String(test.url), UA: proto.String(test.ua)}
+		got, err := r.webSocketURL()
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestSubscriptionJSON(t *testing.T) {
+	tests := []struct {
+		desc       string
+		filter     *RisFilter
+		includeRaw bool
+		want       string
+	}{{
+		desc:   "Success empty filter",
+		filter: &RisFilter{},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success single require key sent",
+		filter: &RisFilter{Require: []string{"announcements"}},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","require":"announcements","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success several require keys left to the client",
+		filter: &RisFilter{Require: []string{"announcements", "community"}},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success path regex of ASNs sent as the path",
+		filter: &RisFilter{ASPathRegex: "^3356 174"},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","path":"^3356,174","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success other path regex left to the client",
+		filter: &RisFilter{ASPathRegex: "^3356 .* 64500$"},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success path regex which does not compile is not sent",
+		filter: &RisFilter{ASPathRegex: "^3356 (174"},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:   "Success match any, nothing narrowed by RIS Live",
+		filter: &RisFilter{Mode: MatchAny, Prefix: []string{"192.0.2.0/24"}, Require: []string{"announcements"}, ASPathRegex: "^3356 174"},
+		want:   `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":false}}}`,
+	}, {
+		desc:       "Success raw included",
+		filter:     &RisFilter{},
+		includeRaw: true,
+		want:       `{"type":"ris_subscribe","data":{"type":"UPDATE","socketOptions":{"includeRaw":true}}}`,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter, IncludeRaw: test.includeRaw}
+		b, err := json.Marshal(risClientMessage{Type: "ris_subscribe", Data: r.subscription()})
+		if err != nil {
+			t.Fatalf("[%v]: failed to marshal subscription: %v", test.desc, err)
+		}
+		if got := string(b); got != test.want {
+			t.Errorf("[%v]: got/want mismatch, got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestSubscriptionPath(t *testing.T) {
+	tests := []struct {
+		desc   string
+		regex  string
+		want   string
+		wantOK bool
+	}{{
+		desc:   "One ASN",
+		regex:  "3356",
+		want:   "3356",
+		wantOK: true,
+	}, {
+		desc:   "ASNs anchored at the start",
+		regex:  "^3356 174",
+		want:   "^3356,174",
+		wantOK: true,
+	}, {
+		desc:   "ASNs anchored at both ends",
+		regex:  "^3356 174 64500$",
+		want:   "^3356,174,64500$",
+		wantOK: true,
+	}, {
+		desc:   "Origin ASN",
+		regex:  "64500$",
+		want:   "64500$",
+		wantOK: true,
+	}, {
+		desc:  "Wildcard",
+		regex: "^3356 .* 64500$",
+	}, {
+		desc:  "Alternation",
+		regex: "3356|174",
+	}, {
+		desc:  "Two spaces",
+		regex: "3356  174",
+	}, {
+		desc:  "Only anchors",
+		regex: "^$",
+	}}
+
+	for _, test := range tests {
+		got, ok := subscriptionPath(test.regex)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("[%v]: got/want mismatch: got %q/%v wanted %q/%v", test.desc, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+// The path is sent to RIS Live, and still checked on every message received.
+func TestListenWebSocketPath(t *testing.T) {
+	subs := make(chan risClientMessage, 1)
+	ts := wsTestServer(t, "testdata/10-msg", subs)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	rf := &RisFilter{ASPathRegex: "^24482 6453 174"}
+	buffer := 10
+	r := NewRisLive(&url, proto.String(""), proto.String("rislive-test"), rf, &buffer, WithWebSocket())
+	go r.Listen()
+
+	var got []string
+	for rm := range r.Chan {
+		if r.CheckASPathRegex(rm.Data) {
+			got = append(got, rm.Data.ID)
+		}
+	}
+	want := []string{"2001:7f8:d:ff::226-1558620047.06-51675230", "2001:7f8:d:ff::226-1558620047.06-51675232"}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", cmp.Diff(got, want))
+	}
+
+	wantSub := risClientMessage{
+		Type: "ris_subscribe",
+		Data: &RisSubscribe{
+			Type:          "UPDATE",
+			Path:          "^24482,6453,174",
+			SocketOptions: &RisSocketOptions{},
+		},
+	}
+	if diff := cmp.Diff(<-subs, wantSub); diff != "" {
+		t.Errorf("subscription mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestCollectors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    []string
+		wantErr bool
+	}{{
+		desc: "Collector list, after another frame",
+		file: "testdata/rrc-list",
+		want: []string{"rrc00", "rrc01", "rrc03", "rrc04", "rrc05", "rrc06", "rrc07"},
+	}, {
+		desc:    "RIS Live error",
+		file:    "testdata/rrc-error",
+		wantErr: true,
+	}, {
+		desc:    "Closed without a list",
+		file:    "testdata/1-msg",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		reqs := make(chan risClientMessage, 1)
+		ts := wsTestServer(t, test.file, reqs)
+		url := "ws" + strings.TrimPrefix(ts.URL, "http")
+		r := &RisLive{URL: &url, UA: proto.String("rislive-test")}
+		got, err := r.Collectors()
+		ts.Close()
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+			}
+		}
+		if req := <-reqs; req.Type != "request_rrc_list" {
+			t.Errorf("[%v]: got request type %v wanted request_rrc_list", test.desc, req.Type)
+		}
+	}
+}